@@ -89,11 +89,24 @@ func main() {
 
 	log.Info().Msg("Facilitator initialized successfully")
 
+	// Create components shared by the gateway and admin servers
+	services, err := server.NewServices(cfg, f)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create services")
+	}
+	defer services.Close()
+
 	// Create gateway server
-	gatewayServer := server.NewGatewayServer(cfg, f)
+	gatewayServer := server.NewGatewayServer(cfg, services)
 
 	// Create admin server
-	adminServer := server.NewAdminServer(cfg, f)
+	adminServer := server.NewAdminServer(cfg, services)
+
+	// Create forward proxy server if enabled
+	var forwardProxyServer *server.ForwardProxyServer
+	if cfg.ForwardProxy.Enabled {
+		forwardProxyServer = server.NewForwardProxyServer(cfg, services)
+	}
 
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -115,6 +128,16 @@ func main() {
 		}
 	}()
 
+	// Start forward proxy server in a goroutine
+	if forwardProxyServer != nil {
+		go func() {
+			if err := forwardProxyServer.Start(); err != nil {
+				log.Error().Err(err).Msg("Forward proxy server failed to start")
+				cancel()
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -132,7 +155,14 @@ func main() {
 
 	log.Info().Msg("Shutting down gracefully...")
 
-	// Stop both servers
+	// Stop all servers
+	if forwardProxyServer != nil {
+		if err := forwardProxyServer.Stop(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Error during forward proxy server shutdown")
+			os.Exit(1)
+		}
+	}
+
 	if err := gatewayServer.Stop(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("Error during gateway server shutdown")
 		os.Exit(1)
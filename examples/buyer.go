@@ -11,10 +11,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/agent-guide/go-x402-facilitator/pkg/client"
-	facilitatorTypes "github.com/agent-guide/go-x402-facilitator/pkg/types"
+	"go-agent-guide/internal/buyer"
 	"github.com/agent-guide/go-x402-facilitator/pkg/utils"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 var (
@@ -77,10 +75,10 @@ func init() {
 
 // PaymentRequiredResponse represents the 402 Payment Required response
 type PaymentRequiredResponse struct {
-	Error               string                               `json:"error"`
-	Message             string                               `json:"message"`
-	Code                int                                  `json:"code"`
-	PaymentRequirements facilitatorTypes.PaymentRequirements `json:"paymentRequirements"`
+	Error               string             `json:"error"`
+	Message             string             `json:"message"`
+	Code                int                `json:"code"`
+	PaymentRequirements buyer.PaymentOffer `json:"paymentRequirements"`
 }
 
 // ResourceResponse represents the response from accessing a resource
@@ -126,26 +124,11 @@ func (b *Buyer) AccessResourceGateway(resourcePath string) error {
 	fmt.Printf("   Description: %s\n", paymentReq.Description)
 
 	// Step 2: Create payment payload
-	fmt.Println("Creating payment payload...")
-	var validDuration int64 = 300
-	now := time.Now().Unix()
-	validAfter := now - 600000
-	validBefore := now + validDuration
-	// Generate nonce
-	nonce := fmt.Sprintf(
-		"0x%x",
-		crypto.Keccak256Hash([]byte(fmt.Sprintf("%d-%s-%s", now, b.account.WalletAddress.Hex(), paymentReq.PayTo))).Hex(),
-	)
-	fmt.Printf("Nonce: %s\n", nonce)
 	fmt.Println("\n[Step 2] Creating payment payload...")
-	payload, err := client.CreatePaymentPayload(
-		paymentReq,
-		b.account.PrivateKey,
-		validAfter,
-		validBefore,
-		ChainID,
-		nonce,
-	)
+	payload, err := buyer.CreatePayment(paymentReq, b.account.PrivateKey, ChainID, buyer.ValidityWindow{
+		ValidFor:  buyer.DefaultValidFor,
+		ClockSkew: buyer.DefaultClockSkew,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create payment payload: %w", err)
 	}
@@ -185,7 +168,7 @@ func (b *Buyer) AccessResourceGateway(resourcePath string) error {
 
 // requestResourceWithoutPayment requests a resource without payment header
 // Returns payment requirements from 402 response
-func (b *Buyer) requestResourceWithoutPayment(resourcePath string) (*facilitatorTypes.PaymentRequirements, error) {
+func (b *Buyer) requestResourceWithoutPayment(resourcePath string) (*buyer.PaymentOffer, error) {
 	// Ensure resource path starts with /
 	if !strings.HasPrefix(resourcePath, "/") {
 		resourcePath = "/" + resourcePath
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/store"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Audit results of denied admin requests
+const (
+	AuditUnauthenticated = "unauthenticated" // Missing, invalid or expired credential
+	AuditForbidden       = "forbidden"       // Authenticated, but the role does not allow the route
+)
+
+// auditRetained is how many recent entries are kept in memory for the admin API
+const auditRetained = 1000
+
+// AuditEntry records a denied admin request
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Identity string    `json:"identity,omitempty"` // Principal name, or the claimed basic-auth user
+	Role     string    `json:"role,omitempty"`
+	Method   string    `json:"method"`
+	Route    string    `json:"route"`
+	Path     string    `json:"path"`
+	ClientIP string    `json:"clientIp"`
+	Status   int       `json:"status"`
+	Result   string    `json:"result"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// AuditLog is the persistent log of denied admin requests
+// The full history stays in the journal; the most recent entries are kept in memory.
+type AuditLog struct {
+	mu      sync.Mutex
+	journal *store.Journal
+	recent  []AuditEntry
+}
+
+// NewAuditLog opens the audit journal at path
+func NewAuditLog(path string) (*AuditLog, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AuditLog{journal: journal}
+	err = journal.Replay(func(data json.RawMessage) error {
+		var entry AuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil
+		}
+		a.appendLocked(entry)
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+
+	return a, nil
+}
+
+// Record appends an entry to the audit log
+func (a *AuditLog) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	log.Warn().
+		Str("identity", entry.Identity).
+		Str("role", entry.Role).
+		Str("method", entry.Method).
+		Str("route", entry.Route).
+		Str("client_ip", entry.ClientIP).
+		Int("status", entry.Status).
+		Str("result", entry.Result).
+		Str("reason", entry.Reason).
+		Msg("Admin request denied")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.journal.Append(&entry); err != nil {
+		log.Error().Err(err).Msg("Failed to write audit log entry")
+	}
+	a.appendLocked(entry)
+}
+
+// List returns up to limit recent entries (all retained if limit <= 0), newest first
+func (a *AuditLog) List(limit int) []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if limit <= 0 || limit > auditRetained {
+		limit = auditRetained
+	}
+	entries := make([]AuditEntry, 0, limit)
+	for i := len(a.recent) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, a.recent[i])
+	}
+	return entries
+}
+
+// Close closes the audit journal
+func (a *AuditLog) Close() error {
+	return a.journal.Close()
+}
+
+// appendLocked keeps an entry in memory; callers must hold a.mu
+// The slice is trimmed back to auditRetained entries once it holds twice as many
+func (a *AuditLog) appendLocked(entry AuditEntry) {
+	a.recent = append(a.recent, entry)
+	if len(a.recent) > 2*auditRetained {
+		a.recent = append([]AuditEntry(nil), a.recent[len(a.recent)-auditRetained:]...)
+	}
+}
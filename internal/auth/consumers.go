@@ -0,0 +1,432 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// APIKeyHeader is the header carrying a consumer API key; "Authorization: Bearer" is accepted as well
+const APIKeyHeader = "X-API-Key"
+
+// ScopeAll grants a consumer key access to every api_key resource
+const ScopeAll = "*"
+
+const (
+	// consumerKeyPrefix is the prefix of consumer API keys
+	consumerKeyPrefix = "agk_"
+	// consumerKeyShownLength is how much of a key is kept in clear to recognize it
+	consumerKeyShownLength = len(consumerKeyPrefix) + 8
+)
+
+var (
+	// ErrConsumerKeyNotFound is returned when a key ID does not exist
+	ErrConsumerKeyNotFound = errors.New("consumer key not found")
+	// ErrInvalidConsumerKey is returned when an API key is unknown, revoked or expired
+	ErrInvalidConsumerKey = errors.New("invalid API key")
+)
+
+// ConsumerKey is an API key issued to a consumer
+// Only the SHA-256 hash of the key is stored; the key itself is returned once when issued.
+type ConsumerKey struct {
+	ID         string            `json:"id"`
+	Consumer   string            `json:"consumer"` // Consumer ID recorded with authenticated requests
+	Prefix     string            `json:"prefix"`   // Start of the key, to recognize it
+	Hash       string            `json:"hash,omitempty"`
+	Scopes     []string          `json:"scopes"` // "*", "resource:/path" or "group:name"
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	ExpiresAt  *time.Time        `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time        `json:"revokedAt,omitempty"`
+	LastUsedAt *time.Time        `json:"lastUsedAt,omitempty"` // Kept in memory only
+}
+
+// ConsumerKeyUpdate changes the settings of a key; nil fields are left unchanged
+type ConsumerKeyUpdate struct {
+	Scopes    []string
+	Metadata  map[string]string
+	ExpiresAt *time.Time // A zero time removes the expiry
+}
+
+// ConsumerKeys stores consumer API keys in an embedded bbolt database
+// Keys are stored by hash, with a secondary index from key ID to hash.
+type ConsumerKeys struct {
+	mu       sync.Mutex
+	db       *bolt.DB
+	lastUsed map[string]time.Time // key ID -> last use, kept in memory only
+}
+
+var (
+	// consumerKeysBucket holds keys by hash
+	consumerKeysBucket = []byte("keys")
+	// consumerKeyIDsBucket maps key IDs to hashes
+	consumerKeyIDsBucket = []byte("ids")
+)
+
+// NewConsumerKeys opens the consumer key database at path
+// If the database is new and a consumer key journal written by earlier versions exists at
+// legacyPath, its keys are imported and the journal is renamed with an .imported suffix.
+func NewConsumerKeys(path, legacyPath string) (*ConsumerKeys, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open consumer key database: %w", err)
+	}
+
+	k := &ConsumerKeys{
+		db:       db,
+		lastUsed: make(map[string]time.Time),
+	}
+
+	count := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		keys, err := tx.CreateBucketIfNotExists(consumerKeysBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(consumerKeyIDsBucket); err != nil {
+			return err
+		}
+		count = keys.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize consumer key database: %w", err)
+	}
+
+	if count == 0 && legacyPath != "" {
+		imported, err := k.importJournal(legacyPath)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to import consumer keys from %s: %w", legacyPath, err)
+		}
+		count = imported
+	}
+
+	log.Info().Int("keys", count).Str("path", path).Msg("Consumer keys loaded")
+	return k, nil
+}
+
+// importJournal copies the last snapshot of each key in a legacy journal into the database
+func (k *ConsumerKeys) importJournal(path string) (int, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return 0, err
+	}
+	keys := make(map[string]*ConsumerKey)
+	err = journal.Replay(func(data json.RawMessage) error {
+		var key ConsumerKey
+		if err := json.Unmarshal(data, &key); err != nil || key.ID == "" || key.Hash == "" {
+			return nil
+		}
+		key.LastUsedAt = nil
+		keys[key.ID] = &key
+		return nil
+	})
+	journal.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	err = k.db.Update(func(tx *bolt.Tx) error {
+		for _, key := range keys {
+			if err := putConsumerKey(tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return 0, err
+	}
+
+	log.Info().Int("keys", len(keys)).Str("path", path).Msg("Imported consumer key journal")
+	return len(keys), nil
+}
+
+// Issue creates a key for a consumer and returns it with the plaintext API key, which is not stored
+func (k *ConsumerKeys) Issue(consumer string, scopes []string, metadata map[string]string, expiresAt *time.Time) (*ConsumerKey, string, error) {
+	consumer = strings.TrimSpace(consumer)
+	if consumer == "" {
+		return nil, "", fmt.Errorf("consumer is required")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expiresAt must be in the future")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	apiKey := consumerKeyPrefix + hex.EncodeToString(buf)
+
+	key := &ConsumerKey{
+		ID:        uuid.New().String(),
+		Consumer:  consumer,
+		Prefix:    apiKey[:consumerKeyShownLength],
+		Hash:      hashConsumerKey(apiKey),
+		Scopes:    scopes,
+		Metadata:  metadata,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	err := k.db.Update(func(tx *bolt.Tx) error {
+		return putConsumerKey(tx, key)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store consumer key: %w", err)
+	}
+
+	return key.snapshot(), apiKey, nil
+}
+
+// Update changes the scopes, metadata or expiry of a key
+func (k *ConsumerKeys) Update(id string, update ConsumerKeyUpdate) (*ConsumerKey, error) {
+	if update.Scopes != nil {
+		if err := ValidateScopes(update.Scopes); err != nil {
+			return nil, err
+		}
+	}
+
+	return k.modify(id, func(key *ConsumerKey) bool {
+		if update.Scopes != nil {
+			key.Scopes = update.Scopes
+		}
+		if update.Metadata != nil {
+			key.Metadata = update.Metadata
+		}
+		if update.ExpiresAt != nil {
+			key.ExpiresAt = update.ExpiresAt
+			if update.ExpiresAt.IsZero() {
+				key.ExpiresAt = nil
+			}
+		}
+		return true
+	})
+}
+
+// Revoke revokes a key; revoking a revoked key is a no-op
+func (k *ConsumerKeys) Revoke(id string) (*ConsumerKey, error) {
+	return k.modify(id, func(key *ConsumerKey) bool {
+		if key.RevokedAt != nil {
+			return false
+		}
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		return true
+	})
+}
+
+// Authenticate returns the key matching an API key if it is neither revoked nor expired
+func (k *ConsumerKeys) Authenticate(apiKey string) (*ConsumerKey, error) {
+	var key *ConsumerKey
+	err := k.db.View(func(tx *bolt.Tx) error {
+		var err error
+		key, err = getConsumerKey(tx, hashConsumerKey(apiKey))
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, ErrConsumerKeyNotFound) {
+			log.Error().Err(err).Msg("Failed to read consumer key")
+		}
+		return nil, ErrInvalidConsumerKey
+	}
+	if !key.activeAt(time.Now()) {
+		return nil, ErrInvalidConsumerKey
+	}
+
+	now := time.Now().UTC()
+	k.mu.Lock()
+	k.lastUsed[key.ID] = now
+	k.mu.Unlock()
+
+	key.LastUsedAt = &now
+	return key.snapshot(), nil
+}
+
+// Get returns a key by ID
+func (k *ConsumerKeys) Get(id string) (*ConsumerKey, error) {
+	var key *ConsumerKey
+	err := k.db.View(func(tx *bolt.Tx) error {
+		hash := tx.Bucket(consumerKeyIDsBucket).Get([]byte(id))
+		if hash == nil {
+			return ErrConsumerKeyNotFound
+		}
+		var err error
+		key, err = getConsumerKey(tx, string(hash))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.withLastUsed(key).snapshot(), nil
+}
+
+// List returns the keys of a consumer (all if empty), oldest first
+func (k *ConsumerKeys) List(consumer string) ([]*ConsumerKey, error) {
+	var keys []*ConsumerKey
+	err := k.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(consumerKeysBucket).ForEach(func(_, data []byte) error {
+			var key ConsumerKey
+			if err := json.Unmarshal(data, &key); err != nil {
+				return err
+			}
+			if consumer != "" && key.Consumer != consumer {
+				return nil
+			}
+			keys = append(keys, k.withLastUsed(&key).snapshot())
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consumer keys: %w", err)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Close closes the consumer key database
+func (k *ConsumerKeys) Close() error {
+	return k.db.Close()
+}
+
+// modify applies change to a key in one transaction; the key is written back only if change returns true
+func (k *ConsumerKeys) modify(id string, change func(key *ConsumerKey) bool) (*ConsumerKey, error) {
+	var key *ConsumerKey
+	err := k.db.Update(func(tx *bolt.Tx) error {
+		hash := tx.Bucket(consumerKeyIDsBucket).Get([]byte(id))
+		if hash == nil {
+			return ErrConsumerKeyNotFound
+		}
+		var err error
+		if key, err = getConsumerKey(tx, string(hash)); err != nil {
+			return err
+		}
+		if !change(key) {
+			return nil
+		}
+		return putConsumerKey(tx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.withLastUsed(key).snapshot(), nil
+}
+
+// withLastUsed sets the in-memory last use time on a key read from the database
+func (k *ConsumerKeys) withLastUsed(key *ConsumerKey) *ConsumerKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if lastUsed, ok := k.lastUsed[key.ID]; ok {
+		key.LastUsedAt = &lastUsed
+	}
+	return key
+}
+
+// getConsumerKey reads a key by hash
+func getConsumerKey(tx *bolt.Tx, hash string) (*ConsumerKey, error) {
+	data := tx.Bucket(consumerKeysBucket).Get([]byte(hash))
+	if data == nil {
+		return nil, ErrConsumerKeyNotFound
+	}
+	var key ConsumerKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("corrupt consumer key record: %w", err)
+	}
+	return &key, nil
+}
+
+// putConsumerKey writes a key by hash and indexes it by ID
+func putConsumerKey(tx *bolt.Tx, key *ConsumerKey) error {
+	record := *key
+	record.LastUsedAt = nil
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(consumerKeysBucket).Put([]byte(key.Hash), data); err != nil {
+		return err
+	}
+	return tx.Bucket(consumerKeyIDsBucket).Put([]byte(key.ID), []byte(key.Hash))
+}
+
+// Allows reports whether the key grants access to a resource path or one of its groups
+func (key *ConsumerKey) Allows(resource string, groups ...string) bool {
+	for _, scope := range key.Scopes {
+		if scope == ScopeAll || scope == "resource:"+resource {
+			return true
+		}
+		for _, group := range groups {
+			if group != "" && scope == "group:"+group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// activeAt reports whether the key is usable at a time
+func (key *ConsumerKey) activeAt(now time.Time) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt))
+}
+
+// snapshot returns a copy of the key without its hash
+func (key *ConsumerKey) snapshot() *ConsumerKey {
+	copied := *key
+	copied.Hash = ""
+	return &copied
+}
+
+// ValidateScopes checks that every scope is "*", "resource:/path" or "group:name"
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if scope == ScopeAll {
+			continue
+		}
+		kind, name, found := strings.Cut(scope, ":")
+		if !found || name == "" || (kind != "resource" && kind != "group") {
+			return fmt.Errorf(`invalid scope %q: use "*", "resource:/path" or "group:name"`, scope)
+		}
+		if kind == "resource" && !strings.HasPrefix(name, "/") {
+			return fmt.Errorf("invalid scope %q: resource paths start with /", scope)
+		}
+	}
+	return nil
+}
+
+// hashConsumerKey returns the stored hash of an API key
+func hashConsumerKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
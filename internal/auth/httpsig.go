@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// HTTP message signature headers (RFC 9421)
+const (
+	SignatureInputHeader = "Signature-Input"
+	SignatureHeader      = "Signature"
+	ContentDigestHeader  = "Content-Digest"
+)
+
+// SignatureAlgEIP191 is the alg parameter of requests signed with EIP-191 personal_sign
+const SignatureAlgEIP191 = "eip191"
+
+// signedBodyLimit caps the body read to check the content digest of a signed request
+const signedBodyLimit = 10 << 20
+
+// ErrRequestSignature is returned when a signed request is malformed, stale, replayed or not signed by its keyid
+var ErrRequestSignature = errors.New("invalid request signature")
+
+// signatureInput is the parsed member of a Signature-Input header
+type signatureInput struct {
+	label      string
+	components []string
+	params     string // Serialized parameters, as covered by @signature-params
+	created    int64
+	expires    int64
+	keyID      string
+	alg        string
+}
+
+// VerifyRequest verifies an RFC 9421 HTTP message signature made with a wallet key
+// The keyid parameter names the signing address and alg must be "eip191". The signature must cover
+// @method and @path, @query if the request has a query, and content-digest if it has a body.
+// It returns the lowercase signing address; each signature is accepted once.
+func (w *WalletAuth) VerifyRequest(r *http.Request) (string, error) {
+	input, err := parseSignatureInput(r.Header.Get(SignatureInputHeader))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequestSignature, err)
+	}
+
+	signature, err := findSignature(r.Header.Get(SignatureHeader), input.label)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequestSignature, err)
+	}
+
+	if input.alg != SignatureAlgEIP191 {
+		return "", fmt.Errorf("%w: alg must be %q", ErrRequestSignature, SignatureAlgEIP191)
+	}
+	if !common.IsHexAddress(input.keyID) {
+		return "", fmt.Errorf("%w: keyid must be a wallet address", ErrRequestSignature)
+	}
+
+	now := time.Now()
+	if input.created == 0 {
+		return "", fmt.Errorf("%w: created is required", ErrRequestSignature)
+	}
+	created := time.Unix(input.created, 0)
+	if created.After(now.Add(walletClockSkew)) || now.Sub(created) > w.cfg.SignatureMaxAge {
+		return "", fmt.Errorf("%w: signature is too old or created in the future", ErrRequestSignature)
+	}
+	if input.expires != 0 && !now.Before(time.Unix(input.expires, 0)) {
+		return "", fmt.Errorf("%w: signature expired", ErrRequestSignature)
+	}
+
+	required := []string{"@method", "@path"}
+	if r.URL.RawQuery != "" {
+		required = append(required, "@query")
+	}
+	if r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody {
+		required = append(required, "content-digest")
+	}
+	for _, component := range required {
+		if !slices.Contains(input.components, component) {
+			return "", fmt.Errorf("%w: signature must cover %s", ErrRequestSignature, component)
+		}
+	}
+
+	if slices.Contains(input.components, "content-digest") {
+		if err := verifyContentDigest(r); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrRequestSignature, err)
+		}
+	}
+
+	base, err := signatureBase(r, input)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequestSignature, err)
+	}
+
+	signer, err := recoverPersonalSigner(base, signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequestSignature, err)
+	}
+	if signer != common.HexToAddress(input.keyID) {
+		return "", ErrWalletSignature
+	}
+
+	// Signatures are only replayable while fresh, so they are remembered for the maximum age
+	if !w.markSignatureSeen(string(signature), created.Add(w.cfg.SignatureMaxAge+walletClockSkew)) {
+		return "", fmt.Errorf("%w: signature already used", ErrRequestSignature)
+	}
+
+	return strings.ToLower(signer.Hex()), nil
+}
+
+// signatureBase builds the signature base of the covered components (RFC 9421 section 2.5)
+func signatureBase(r *http.Request, input *signatureInput) ([]byte, error) {
+	var b strings.Builder
+	for _, component := range input.components {
+		var value string
+		switch component {
+		case "@method":
+			value = r.Method
+		case "@authority":
+			value = strings.ToLower(r.Host)
+		case "@path":
+			value = r.URL.EscapedPath()
+			if value == "" {
+				value = "/"
+			}
+		case "@query":
+			value = "?" + r.URL.RawQuery
+		default:
+			if strings.HasPrefix(component, "@") {
+				return nil, fmt.Errorf("unsupported component %s", component)
+			}
+			values := r.Header.Values(component)
+			if len(values) == 0 {
+				return nil, fmt.Errorf("covered header %s is missing", component)
+			}
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.TrimSpace(v)
+			}
+			value = strings.Join(trimmed, ", ")
+		}
+		fmt.Fprintf(&b, "%q: %s\n", component, value)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", input.params)
+	return []byte(b.String()), nil
+}
+
+// verifyContentDigest checks the Content-Digest header against the body and restores the body
+func verifyContentDigest(r *http.Request) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, signedBodyLimit+1))
+		r.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		if len(body) > signedBodyLimit {
+			return fmt.Errorf("signed body exceeds %d bytes", signedBodyLimit)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	for _, member := range strings.Split(r.Header.Get(ContentDigestHeader), ",") {
+		alg, value, found := strings.Cut(strings.TrimSpace(member), "=")
+		if !found {
+			continue
+		}
+		var sum []byte
+		switch alg {
+		case "sha-256":
+			digest := sha256.Sum256(body)
+			sum = digest[:]
+		case "sha-512":
+			digest := sha512.Sum512(body)
+			sum = digest[:]
+		default:
+			continue
+		}
+		expected, err := decodeByteSequence(value)
+		if err != nil {
+			return fmt.Errorf("invalid content digest: %w", err)
+		}
+		if subtle.ConstantTimeCompare(sum, expected) != 1 {
+			return fmt.Errorf("content digest does not match body")
+		}
+		return nil
+	}
+	return fmt.Errorf("content-digest with sha-256 or sha-512 is required")
+}
+
+// parseSignatureInput parses the first member of a Signature-Input header, such as
+// sig1=("@method" "@path");created=1700000000;keyid="0x...";alg="eip191"
+func parseSignatureInput(header string) (*signatureInput, error) {
+	member, _, _ := strings.Cut(header, ",")
+	label, rest, found := strings.Cut(strings.TrimSpace(member), "=")
+	if !found || label == "" || !strings.HasPrefix(rest, "(") {
+		return nil, fmt.Errorf("malformed %s header", SignatureInputHeader)
+	}
+
+	end := strings.Index(rest, ")")
+	if end < 0 {
+		return nil, fmt.Errorf("malformed %s header", SignatureInputHeader)
+	}
+	input := &signatureInput{label: label, params: rest}
+	for _, item := range strings.Fields(rest[1:end]) {
+		component, err := strconv.Unquote(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid component %s", item)
+		}
+		input.components = append(input.components, strings.ToLower(component))
+	}
+
+	for _, param := range strings.Split(rest[end+1:], ";") {
+		if param == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(param, "=")
+		var err error
+		switch key {
+		case "created":
+			input.created, err = strconv.ParseInt(value, 10, 64)
+		case "expires":
+			input.expires, err = strconv.ParseInt(value, 10, 64)
+		case "keyid":
+			input.keyID, err = strconv.Unquote(value)
+		case "alg":
+			input.alg, err = strconv.Unquote(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter", key)
+		}
+	}
+	return input, nil
+}
+
+// findSignature returns the signature with the given label from a Signature header
+func findSignature(header, label string) ([]byte, error) {
+	for _, member := range strings.Split(header, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(member), "=")
+		if found && name == label {
+			return decodeByteSequence(value)
+		}
+	}
+	return nil, fmt.Errorf("no %s for %s", SignatureHeader, label)
+}
+
+// decodeByteSequence decodes a structured-field byte sequence such as :base64:
+func decodeByteSequence(value string) ([]byte, error) {
+	if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+		return nil, fmt.Errorf("expected a :base64: value")
+	}
+	return base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+}
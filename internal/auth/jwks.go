@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultJWKSRefresh is how long a JWKS fetched from a URL is used before it is fetched again
+const DefaultJWKSRefresh = 5 * time.Minute
+
+const (
+	jwksFetchTimeout = 10 * time.Second
+	jwksMaxSize      = 1 << 20
+	// jwksMinRefetch throttles refetches triggered by tokens with an unknown key ID
+	jwksMinRefetch = 30 * time.Second
+)
+
+// jsonWebKey is a key of a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// verificationKey is a parsed JWKS key: *rsa.PublicKey, *ecdsa.PublicKey or []byte
+type verificationKey struct {
+	id  string
+	alg string // Algorithm the key is restricted to, empty if any compatible one
+	key interface{}
+}
+
+// keySet is the cached content of one JWKS file or URL
+type keySet struct {
+	mu       sync.Mutex
+	keys     []verificationKey
+	loadedAt time.Time
+	modTime  time.Time // Modification time of a JWKS file when it was read
+}
+
+// KeySets caches JSON Web Key Sets by source
+// Files are re-read when they change; URLs are fetched again after their refresh interval,
+// or early when a token names a key ID the cached set does not have.
+type KeySets struct {
+	mu     sync.Mutex
+	sets   map[string]*keySet
+	client *http.Client
+}
+
+// NewKeySets creates an empty JWKS cache
+func NewKeySets() *KeySets {
+	return &KeySets{
+		sets:   make(map[string]*keySet),
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+// keys returns the keys of a JWKS file path or http(s) URL
+// refetch forces a URL to be fetched again unless it was fetched within jwksMinRefetch
+func (k *KeySets) keys(ctx context.Context, source string, refresh time.Duration, refetch bool) ([]verificationKey, error) {
+	k.mu.Lock()
+	set, exists := k.sets[source]
+	if !exists {
+		set = &keySet{}
+		k.sets[source] = set
+	}
+	k.mu.Unlock()
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if !isURL(source) {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		if set.loadedAt.IsZero() || !info.ModTime().Equal(set.modTime) {
+			data, err := os.ReadFile(source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+			}
+			keys, err := parseJWKS(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JWKS file %s: %w", source, err)
+			}
+			set.keys, set.loadedAt, set.modTime = keys, time.Now(), info.ModTime()
+		}
+		return set.keys, nil
+	}
+
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefresh
+	}
+	age := time.Since(set.loadedAt)
+	if !set.loadedAt.IsZero() && age < refresh && (!refetch || age < jwksMinRefetch) {
+		return set.keys, nil
+	}
+
+	keys, err := k.fetch(ctx, source)
+	if err != nil {
+		if set.keys != nil {
+			// Keep serving the last good set while the issuer is unreachable
+			log.Warn().Err(err).Str("jwks_url", source).Msg("Failed to refresh JWKS, using cached keys")
+			set.loadedAt = time.Now()
+			return set.keys, nil
+		}
+		return nil, err
+	}
+	set.keys, set.loadedAt = keys, time.Now()
+	return set.keys, nil
+}
+
+// fetch downloads and parses a JWKS URL
+func (k *KeySets) fetch(ctx context.Context, url string) ([]verificationKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS URL: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s returned status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS from %s: %w", url, err)
+	}
+	log.Info().Str("jwks_url", url).Int("keys", len(keys)).Msg("JWKS loaded")
+	return keys, nil
+}
+
+// parseJWKS parses the signing keys of a JWKS document; keys of unsupported types are skipped
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys := make([]verificationKey, 0, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		keys = append(keys, verificationKey{id: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes a JWK, returning nil for unsupported key types
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on curve P-256")
+		}
+		return key, nil
+	case "oct":
+		secret, err := decodeBase64URL(jwk.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret: %w", err)
+		}
+		return secret, nil
+	default:
+		return nil, nil
+	}
+}
+
+// decodeBase64URL decodes unpadded (or padded) base64url
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// isURL reports whether a JWKS source is fetched over HTTP rather than read from a file
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
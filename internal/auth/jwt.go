@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	// ErrInvalidToken is returned when a JWT is malformed, badly signed, expired or from the wrong issuer or audience
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrClaimsRejected is returned when a valid JWT does not satisfy the required claims
+	ErrClaimsRejected = errors.New("required claims not satisfied")
+)
+
+// JWTConfig configures the verification of JWTs for a resource
+type JWTConfig struct {
+	Secret         string            // HS256 shared secret
+	JWKSFile       string            // Local JWKS file with RS256/ES256 (or oct) keys
+	JWKSURL        string            // JWKS URL with RS256/ES256 (or oct) keys
+	JWKSRefresh    time.Duration     // How long a fetched JWKS is cached (default DefaultJWKSRefresh)
+	Issuer         string            // Required "iss", empty to accept any
+	Audience       []string          // "aud" must contain one of these, empty to accept any
+	Algorithms     []string          // Accepted algorithms, default: those the configured keys support
+	Leeway         time.Duration     // Clock skew tolerated on exp, nbf and iat
+	RequiredClaims []ClaimRule       // Claims the token must carry
+	ForwardClaims  map[string]string // Upstream header -> claim name
+}
+
+// ClaimRule requires a claim to be present and, if Values is set, to hold one of them
+// Array claims and space-separated strings (such as "scope") match if any element matches
+type ClaimRule struct {
+	Claim  string   `json:"claim"`
+	Values []string `json:"values,omitempty"`
+}
+
+// JWTVerifier verifies JWTs against a JWTConfig
+type JWTVerifier struct {
+	cfg        JWTConfig
+	keySets    *KeySets
+	algorithms []string
+}
+
+// NewJWTVerifier validates a JWT configuration and creates its verifier
+// keySets caches the JWKS and should be shared across verifiers
+func NewJWTVerifier(cfg JWTConfig, keySets *KeySets) (*JWTVerifier, error) {
+	if cfg.JWKSFile != "" && cfg.JWKSURL != "" {
+		return nil, fmt.Errorf("jwks_file and jwks_url are mutually exclusive")
+	}
+	if cfg.JWKSURL != "" && !isURL(cfg.JWKSURL) {
+		return nil, fmt.Errorf("jwks_url must be an http(s) URL")
+	}
+	hasJWKS := cfg.JWKSFile != "" || cfg.JWKSURL != ""
+	if cfg.Secret == "" && !hasJWKS {
+		return nil, fmt.Errorf("a secret, jwks_file or jwks_url is required")
+	}
+	if cfg.Leeway < 0 {
+		return nil, fmt.Errorf("leeway must not be negative")
+	}
+	for _, rule := range cfg.RequiredClaims {
+		if rule.Claim == "" {
+			return nil, fmt.Errorf("required claim without a name")
+		}
+	}
+	for header, claim := range cfg.ForwardClaims {
+		if header == "" || claim == "" {
+			return nil, fmt.Errorf("forward_claims entries need a header and a claim")
+		}
+	}
+
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		if cfg.Secret != "" {
+			algorithms = append(algorithms, AlgHS256)
+		}
+		if hasJWKS {
+			algorithms = append(algorithms, AlgRS256, AlgES256)
+		}
+	}
+	for _, alg := range algorithms {
+		switch alg {
+		case AlgHS256:
+			if cfg.Secret == "" && !hasJWKS {
+				return nil, fmt.Errorf("HS256 requires a secret")
+			}
+		case AlgRS256, AlgES256:
+			if !hasJWKS {
+				return nil, fmt.Errorf("%s requires jwks_file or jwks_url", alg)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported algorithm %q (supported: HS256, RS256, ES256)", alg)
+		}
+	}
+
+	return &JWTVerifier{cfg: cfg, keySets: keySets, algorithms: algorithms}, nil
+}
+
+// Verify checks the signature, expiry, issuer, audience and required claims of a token
+// Errors wrap ErrInvalidToken or ErrClaimsRejected
+func (v *JWTVerifier) Verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(v.algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.cfg.Leeway),
+	}
+	if v.cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.cfg.Issuer))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.NewParser(options...).ParseWithClaims(tokenString, claims, v.keyFunc(ctx)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if len(v.cfg.Audience) > 0 {
+		audience, err := claims.GetAudience()
+		if err != nil || !containsAny(audience, v.cfg.Audience) {
+			return nil, fmt.Errorf("%w: audience not accepted", ErrInvalidToken)
+		}
+	}
+
+	for _, rule := range v.cfg.RequiredClaims {
+		value, exists := claims[rule.Claim]
+		if !exists || value == nil {
+			return nil, fmt.Errorf("%w: missing claim %q", ErrClaimsRejected, rule.Claim)
+		}
+		if len(rule.Values) > 0 && !containsAny(claimValues(value), rule.Values) {
+			return nil, fmt.Errorf("%w: claim %q has none of the required values", ErrClaimsRejected, rule.Claim)
+		}
+	}
+
+	return claims, nil
+}
+
+// ForwardHeaders returns the upstream headers configured in forward_claims for a verified token
+// Headers of claims the token does not carry are returned with an empty value so callers can strip them
+func (v *JWTVerifier) ForwardHeaders(claims jwt.MapClaims) map[string]string {
+	headers := make(map[string]string, len(v.cfg.ForwardClaims))
+	for header, claim := range v.cfg.ForwardClaims {
+		headers[header] = formatClaim(claims[claim])
+	}
+	return headers
+}
+
+// keyFunc selects the verification key of a token by algorithm and key ID
+func (v *JWTVerifier) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		alg := token.Method.Alg()
+		kid, _ := token.Header["kid"].(string)
+
+		source, refresh := v.cfg.JWKSFile, v.cfg.JWKSRefresh
+		if source == "" {
+			source = v.cfg.JWKSURL
+		}
+
+		// Tokens naming a key ID are looked up in the JWKS; the shared secret covers the rest
+		if alg == AlgHS256 && v.cfg.Secret != "" && (kid == "" || source == "") {
+			return []byte(v.cfg.Secret), nil
+		}
+		if source == "" {
+			return nil, fmt.Errorf("no key for %s", alg)
+		}
+
+		keys, err := v.keySets.keys(ctx, source, refresh, false)
+		if err != nil {
+			return nil, err
+		}
+		if key := matchKey(keys, kid, alg); key != nil {
+			return key, nil
+		}
+		if kid != "" && isURL(source) {
+			// The issuer may have rotated its keys since the last fetch
+			if keys, err = v.keySets.keys(ctx, source, refresh, true); err != nil {
+				return nil, err
+			}
+			if key := matchKey(keys, kid, alg); key != nil {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("no %s key with kid %q", alg, kid)
+	}
+}
+
+// matchKey returns the first key compatible with alg, and with the key ID if the token names one
+func matchKey(keys []verificationKey, kid, alg string) interface{} {
+	for _, key := range keys {
+		if kid != "" && key.id != kid {
+			continue
+		}
+		if key.alg != "" && key.alg != alg {
+			continue
+		}
+		switch k := key.key.(type) {
+		case []byte:
+			if alg == AlgHS256 {
+				return k
+			}
+		case *rsa.PublicKey:
+			if alg == AlgRS256 {
+				return k
+			}
+		case *ecdsa.PublicKey:
+			if alg == AlgES256 && k.Curve == elliptic.P256() {
+				return k
+			}
+		}
+	}
+	return nil
+}
+
+// claimValues flattens a claim into strings for matching
+func claimValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, formatClaim(item))
+		}
+		return values
+	default:
+		return []string{formatClaim(v)}
+	}
+}
+
+// formatClaim renders a claim as a header value: arrays are comma-separated, objects are JSON
+func formatClaim(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, formatClaim(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// containsAny reports whether values and accepted share an element
+func containsAny(values, accepted []string) bool {
+	for _, value := range values {
+		for _, a := range accepted {
+			if value == a {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testJWKS serves a JSON Web Key Set that tests can replace, counting the fetches
+type testJWKS struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+}
+
+func newTestJWKS(t *testing.T, keys ...map[string]string) *testJWKS {
+	t.Helper()
+	s := &testJWKS{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// rotate replaces the served keys
+func (s *testJWKS) rotate(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *testJWKS) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	return key
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate EC key: %v", err)
+	}
+	return key
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": AlgRS256,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// validClaims returns claims that pass a verifier without issuer, audience or required claims
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign %s token: %v", method.Alg(), err)
+	}
+	return signed
+}
+
+func newTestVerifier(t *testing.T, cfg JWTConfig) *JWTVerifier {
+	t.Helper()
+	verifier, err := NewJWTVerifier(cfg, NewKeySets())
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	return verifier
+}
+
+func TestJWTVerifierAlgorithms(t *testing.T) {
+	rsaKey, ecKey := newRSAKey(t), newECKey(t)
+	jwks := newTestJWKS(t, rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+
+	tests := []struct {
+		name  string
+		cfg   JWTConfig
+		token string
+	}{
+		{"HS256 secret", JWTConfig{Secret: testSecret}, signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims())},
+		{"RS256 JWKS", JWTConfig{JWKSURL: jwks.URL}, signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims())},
+		{"ES256 JWKS", JWTConfig{JWKSURL: jwks.URL}, signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, validClaims())},
+		{"RS256 without kid", JWTConfig{JWKSURL: jwks.URL}, signToken(t, jwt.SigningMethodRS256, "", rsaKey, validClaims())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := newTestVerifier(t, tt.cfg).Verify(context.Background(), tt.token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims["sub"] != "user-1" {
+				t.Errorf("sub = %v, want user-1", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, otherKey := newRSAKey(t), newRSAKey(t)
+	jwks := newTestJWKS(t, rsaJWK("rsa-1", &rsaKey.PublicKey))
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		cfg   JWTConfig
+		token string
+	}{
+		{
+			// The classic confusion attack: HMAC keyed with the public key the verifier knows
+			name:  "HS256 signed with the RSA public key",
+			cfg:   JWTConfig{JWKSURL: jwks.URL},
+			token: signToken(t, jwt.SigningMethodHS256, "rsa-1", publicDER, validClaims()),
+		},
+		{
+			name:  "HS256 naming an RSA kid when HS256 is accepted",
+			cfg:   JWTConfig{Secret: testSecret, JWKSURL: jwks.URL, Algorithms: []string{AlgHS256, AlgRS256}},
+			token: signToken(t, jwt.SigningMethodHS256, "rsa-1", publicDER, validClaims()),
+		},
+		{
+			name:  "alg none",
+			cfg:   JWTConfig{Secret: testSecret},
+			token: signToken(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims()),
+		},
+		{
+			name:  "RS256 when only ES256 is accepted",
+			cfg:   JWTConfig{JWKSURL: jwks.URL, Algorithms: []string{AlgES256}},
+			token: signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()),
+		},
+		{
+			name:  "RS256 signed by another key",
+			cfg:   JWTConfig{JWKSURL: jwks.URL},
+			token: signToken(t, jwt.SigningMethodRS256, "rsa-1", otherKey, validClaims()),
+		},
+		{
+			name:  "HS256 with the wrong secret",
+			cfg:   JWTConfig{Secret: testSecret},
+			token: signToken(t, jwt.SigningMethodHS256, "", []byte("another secret"), validClaims()),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestVerifier(t, tt.cfg).Verify(context.Background(), tt.token)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRefetchesRotatedKeys(t *testing.T) {
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	jwks := newTestJWKS(t, rsaJWK("old", &oldKey.PublicKey))
+	keySets := NewKeySets()
+	verifier, err := NewJWTVerifier(JWTConfig{JWKSURL: jwks.URL}, keySets)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := verifier.Verify(ctx, signToken(t, jwt.SigningMethodRS256, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify with the old key: %v", err)
+	}
+	if got := jwks.fetchCount(); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	jwks.rotate(rsaJWK("new", &newKey.PublicKey))
+	newToken := signToken(t, jwt.SigningMethodRS256, "new", newKey, validClaims())
+
+	// Unknown key IDs refetch at most once per jwksMinRefetch
+	if _, err := verifier.Verify(ctx, newToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify right after the fetch = %v, want ErrInvalidToken", err)
+	}
+	if got := jwks.fetchCount(); got != 1 {
+		t.Fatalf("fetches = %d, want 1 while refetches are throttled", got)
+	}
+
+	keySets.sets[jwks.URL].loadedAt = time.Now().Add(-jwksMinRefetch)
+	if _, err := verifier.Verify(ctx, newToken); err != nil {
+		t.Fatalf("Verify with the rotated key: %v", err)
+	}
+	if got := jwks.fetchCount(); got != 2 {
+		t.Fatalf("fetches = %d, want 2", got)
+	}
+
+	// The old key is gone from the refetched set
+	if _, err := verifier.Verify(ctx, signToken(t, jwt.SigningMethodRS256, "old", oldKey, validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify with the removed key = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTVerifierRegisteredClaims(t *testing.T) {
+	cfg := JWTConfig{
+		Secret:   testSecret,
+		Issuer:   "https://issuer.example",
+		Audience: []string{"api", "gateway"},
+		Leeway:   time.Minute,
+	}
+	verifier := newTestVerifier(t, cfg)
+	now := time.Now()
+
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub": "user-1",
+			"iss": "https://issuer.example",
+			"aud": "api",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		edit(c)
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"valid", claims(func(jwt.MapClaims) {}), true},
+		{"audience array", claims(func(c jwt.MapClaims) { c["aud"] = []string{"other", "gateway"} }), true},
+		{"expired within leeway", claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-30 * time.Second).Unix() }), true},
+		{"wrong issuer", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }), false},
+		{"missing issuer", claims(func(c jwt.MapClaims) { delete(c, "iss") }), false},
+		{"wrong audience", claims(func(c jwt.MapClaims) { c["aud"] = []string{"other"} }), false},
+		{"missing audience", claims(func(c jwt.MapClaims) { delete(c, "aud") }), false},
+		{"expired", claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() }), false},
+		{"missing exp", claims(func(c jwt.MapClaims) { delete(c, "exp") }), false},
+		{"not yet valid", claims(func(c jwt.MapClaims) { c["nbf"] = now.Add(10 * time.Minute).Unix() }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), tt.claims)
+			_, err := verifier.Verify(context.Background(), token)
+			if tt.valid && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRequiredClaims(t *testing.T) {
+	verifier := newTestVerifier(t, JWTConfig{
+		Secret: testSecret,
+		RequiredClaims: []ClaimRule{
+			{Claim: "tenant"},
+			{Claim: "scope", Values: []string{"read:data"}},
+			{Claim: "roles", Values: []string{"admin", "analyst"}},
+		},
+	})
+
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		c["tenant"] = "acme"
+		c["scope"] = "openid read:data"
+		c["roles"] = []string{"viewer", "analyst"}
+		edit(c)
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"all satisfied", claims(func(jwt.MapClaims) {}), true},
+		{"missing claim", claims(func(c jwt.MapClaims) { delete(c, "tenant") }), false},
+		{"null claim", claims(func(c jwt.MapClaims) { c["tenant"] = nil }), false},
+		{"scope without the value", claims(func(c jwt.MapClaims) { c["scope"] = "openid read:data:all" }), false},
+		{"array without the value", claims(func(c jwt.MapClaims) { c["roles"] = []string{"viewer"} }), false},
+		{"string instead of array", claims(func(c jwt.MapClaims) { c["roles"] = "admin" }), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), tt.claims)
+			_, err := verifier.Verify(context.Background(), token)
+			if tt.valid && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrClaimsRejected) {
+				t.Fatalf("Verify error = %v, want ErrClaimsRejected", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierForwardHeaders(t *testing.T) {
+	verifier := newTestVerifier(t, JWTConfig{
+		Secret: testSecret,
+		ForwardClaims: map[string]string{
+			"X-User-Id":     "sub",
+			"X-User-Roles":  "roles",
+			"X-User-Tenant": "tenant",
+			"X-User-Level":  "level",
+		},
+	})
+	claims := validClaims()
+	claims["roles"] = []string{"admin", "analyst"}
+	claims["level"] = 3
+
+	verified, err := verifier.Verify(context.Background(), signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	headers := verifier.ForwardHeaders(verified)
+
+	want := map[string]string{
+		"X-User-Id":     "user-1",
+		"X-User-Roles":  "admin,analyst",
+		"X-User-Tenant": "", // Missing claims are returned empty so the header is stripped
+		"X-User-Level":  "3",
+	}
+	if len(headers) != len(want) {
+		t.Fatalf("headers = %v, want %v", headers, want)
+	}
+	for header, value := range want {
+		got, exists := headers[header]
+		if !exists || got != value {
+			t.Errorf("%s = %q (present %v), want %q", header, got, exists, value)
+		}
+	}
+}
+
+func TestNewJWTVerifierValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  JWTConfig
+		want string
+	}{
+		{"no key", JWTConfig{}, "a secret, jwks_file or jwks_url is required"},
+		{"file and url", JWTConfig{JWKSFile: "jwks.json", JWKSURL: "https://issuer.example/jwks"}, "mutually exclusive"},
+		{"url scheme", JWTConfig{JWKSURL: "ftp://issuer.example/jwks"}, "http(s) URL"},
+		{"RS256 without JWKS", JWTConfig{Secret: testSecret, Algorithms: []string{AlgRS256}}, "requires jwks_file or jwks_url"},
+		{"unsupported algorithm", JWTConfig{Secret: testSecret, Algorithms: []string{"none"}}, "unsupported algorithm"},
+		{"unnamed claim", JWTConfig{Secret: testSecret, RequiredClaims: []ClaimRule{{}}}, "without a name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWTVerifier(tt.cfg, NewKeySets())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("NewJWTVerifier error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Authentication scopes failures are counted in
+const (
+	ScopeGateway = "gateway" // Resource authentication
+	ScopeAdmin   = "admin"   // Admin API authentication
+)
+
+// Lockout event types and unlock reasons
+const (
+	EventLockout = "lockout"
+	EventUnlock  = "unlock"
+
+	UnlockExpired = "expired" // The lockout duration passed
+	UnlockAdmin   = "admin"   // Lifted through the admin API
+)
+
+// lockoutEventsRetained is how many recent lockout and unlock events are kept for the admin API
+const lockoutEventsRetained = 1000
+
+// lockoutSweepInterval is how often expired lockouts and stale failure counts are dropped
+const lockoutSweepInterval = time.Minute
+
+var (
+	authFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_failures_total",
+			Help: "Total number of failed authentication attempts",
+		},
+		[]string{"scope"},
+	)
+
+	authLockoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_lockouts_total",
+			Help: "Total number of client IPs and credentials locked after failed authentication",
+		},
+		[]string{"scope", "kind"},
+	)
+
+	authUnlocksTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_unlocks_total",
+			Help: "Total number of lifted authentication lockouts",
+		},
+		[]string{"scope", "reason"},
+	)
+
+	authLockedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_locked_requests_total",
+			Help: "Total number of requests refused because their client IP or credential is locked",
+		},
+		[]string{"scope"},
+	)
+
+	authLockoutsActive = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "auth_lockouts_active",
+			Help: "Number of client IPs and credentials currently locked",
+		},
+		[]string{"scope"},
+	)
+)
+
+// SecretsEqual compares two secrets in constant time
+// Both are hashed first, so the comparison does not reveal the length of the expected secret.
+func SecretsEqual(presented, expected string) bool {
+	a, b := sha256.Sum256([]byte(presented)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// Lockout represents a locked client IP or credential
+type Lockout struct {
+	Scope       string    `json:"scope"`
+	Key         string    `json:"key"` // "ip:<address>" or "credential:<prefix>"
+	Failures    int       `json:"failures"`
+	LockedAt    time.Time `json:"lockedAt"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// LockoutEvent records a lockout or an unlock
+type LockoutEvent struct {
+	Time        time.Time  `json:"time"`
+	Type        string     `json:"type"` // "lockout" or "unlock"
+	Scope       string     `json:"scope"`
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures,omitempty"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+	Reason      string     `json:"reason,omitempty"` // Unlock reason: "expired" or "admin"
+}
+
+// failureCount tracks the failures of one key
+type failureCount struct {
+	failures    int
+	first       time.Time // Start of the counting window
+	lockedAt    time.Time
+	lockedUntil time.Time
+}
+
+// FailureTracker counts failed authentication attempts by client IP and credential prefix,
+// and delays or locks out keys that fail too often
+type FailureTracker struct {
+	cfg config.BruteForceConfig
+
+	mu        sync.Mutex
+	counts    map[string]*failureCount // Keyed by scope and key
+	events    []LockoutEvent
+	lastSweep time.Time
+}
+
+// NewFailureTracker creates a tracker from the brute_force configuration
+func NewFailureTracker(cfg config.BruteForceConfig) *FailureTracker {
+	return &FailureTracker{
+		cfg:    cfg,
+		counts: make(map[string]*failureCount),
+	}
+}
+
+// Keys returns the keys failures of a request are counted by: its client IP first and,
+// if a credential was presented, the credential's leading characters
+func (t *FailureTracker) Keys(clientIP, credential string) []string {
+	keys := []string{"ip:" + clientIP}
+	if credential != "" {
+		prefix := credential
+		if len(prefix) > t.cfg.CredentialPrefix {
+			prefix = prefix[:t.cfg.CredentialPrefix]
+		}
+		keys = append(keys, "credential:"+prefix)
+	}
+	return keys
+}
+
+// Locked returns how long the first locked key stays locked, or false if none is locked
+func (t *FailureTracker) Locked(scope string, keys ...string) (time.Duration, bool) {
+	if !t.cfg.Enabled {
+		return 0, false
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(now)
+
+	for _, key := range keys {
+		if count, exists := t.counts[scope+"|"+key]; exists && now.Before(count.lockedUntil) {
+			authLockedRequestsTotal.WithLabelValues(scope).Inc()
+			return count.lockedUntil.Sub(now), true
+		}
+	}
+	return 0, false
+}
+
+// Fail records a failed attempt for each key and returns how long to delay the response
+// A key is locked once its failures within the window reach lockout_after.
+func (t *FailureTracker) Fail(scope string, keys ...string) time.Duration {
+	if !t.cfg.Enabled {
+		return 0
+	}
+	authFailuresTotal.WithLabelValues(scope).Inc()
+
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(now)
+
+	most := 0
+	for _, key := range keys {
+		id := scope + "|" + key
+		count, exists := t.counts[id]
+		if !exists {
+			count = &failureCount{first: now}
+			t.counts[id] = count
+		}
+		t.expireLocked(scope, key, count, now)
+		if now.Sub(count.first) > t.cfg.Window {
+			count.failures, count.first = 0, now
+		}
+		count.failures++
+		most = max(most, count.failures)
+
+		if t.cfg.LockoutAfter > 0 && count.failures >= t.cfg.LockoutAfter && !now.Before(count.lockedUntil) {
+			count.lockedAt, count.lockedUntil = now, now.Add(t.cfg.LockoutDuration)
+			t.lockLocked(scope, key, count)
+		}
+	}
+	return t.delay(most)
+}
+
+// Succeed forgets the failures of a credential after it authenticated
+// Client IP failures are kept, so valid logins cannot be interleaved to reset a guessing client.
+func (t *FailureTracker) Succeed(scope string, keys ...string) {
+	if !t.cfg.Enabled {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "credential:") {
+			continue
+		}
+		id := scope + "|" + key
+		if count, exists := t.counts[id]; exists {
+			now := time.Now()
+			t.expireLocked(scope, key, count, now)
+			if !now.Before(count.lockedUntil) {
+				delete(t.counts, id)
+			}
+		}
+	}
+}
+
+// Lockouts returns the keys that are currently locked, soonest to unlock first
+func (t *FailureTracker) Lockouts() []Lockout {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(now)
+
+	lockouts := make([]Lockout, 0)
+	for id, count := range t.counts {
+		if !now.Before(count.lockedUntil) {
+			continue
+		}
+		scope, key, _ := strings.Cut(id, "|")
+		lockouts = append(lockouts, Lockout{
+			Scope:       scope,
+			Key:         key,
+			Failures:    count.failures,
+			LockedAt:    count.lockedAt,
+			LockedUntil: count.lockedUntil,
+		})
+	}
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LockedUntil.Before(lockouts[j].LockedUntil)
+	})
+	return lockouts
+}
+
+// Unlock lifts the lockout of a key and forgets its failures
+// It returns false if the key is not locked.
+func (t *FailureTracker) Unlock(scope, key string) bool {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := scope + "|" + key
+	count, exists := t.counts[id]
+	if !exists || !now.Before(count.lockedUntil) {
+		return false
+	}
+	delete(t.counts, id)
+	t.unlockLocked(scope, key, UnlockAdmin, now)
+	return true
+}
+
+// Events returns up to limit recent lockout and unlock events (all retained if limit <= 0), newest first
+func (t *FailureTracker) Events(limit int) []LockoutEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(time.Now())
+
+	if limit <= 0 || limit > lockoutEventsRetained {
+		limit = lockoutEventsRetained
+	}
+	events := make([]LockoutEvent, 0, min(limit, len(t.events)))
+	for i := len(t.events) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, t.events[i])
+	}
+	return events
+}
+
+// delay returns the response delay after the given number of failures
+func (t *FailureTracker) delay(failures int) time.Duration {
+	if t.cfg.DelayAfter <= 0 || failures <= t.cfg.DelayAfter {
+		return 0
+	}
+	delay := t.cfg.Delay
+	for i := t.cfg.DelayAfter + 1; i < failures && delay < t.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, t.cfg.MaxDelay)
+}
+
+// lockLocked records a new lockout; callers must hold t.mu
+func (t *FailureTracker) lockLocked(scope, key string, count *failureCount) {
+	kind, _, _ := strings.Cut(key, ":")
+	authLockoutsTotal.WithLabelValues(scope, kind).Inc()
+	authLockoutsActive.WithLabelValues(scope).Inc()
+	log.Warn().
+		Str("scope", scope).
+		Str("key", key).
+		Int("failures", count.failures).
+		Time("locked_until", count.lockedUntil).
+		Msg("Locked out after failed authentication attempts")
+
+	lockedUntil := count.lockedUntil
+	t.appendEventLocked(LockoutEvent{
+		Time:        count.lockedAt,
+		Type:        EventLockout,
+		Scope:       scope,
+		Key:         key,
+		Failures:    count.failures,
+		LockedUntil: &lockedUntil,
+	})
+}
+
+// unlockLocked records a lifted lockout; callers must hold t.mu
+func (t *FailureTracker) unlockLocked(scope, key, reason string, now time.Time) {
+	authUnlocksTotal.WithLabelValues(scope, reason).Inc()
+	authLockoutsActive.WithLabelValues(scope).Dec()
+	log.Info().
+		Str("scope", scope).
+		Str("key", key).
+		Str("reason", reason).
+		Msg("Authentication lockout lifted")
+
+	t.appendEventLocked(LockoutEvent{Time: now, Type: EventUnlock, Scope: scope, Key: key, Reason: reason})
+}
+
+// appendEventLocked keeps an event in memory; callers must hold t.mu
+// The slice is trimmed back to lockoutEventsRetained events once it holds twice as many
+func (t *FailureTracker) appendEventLocked(event LockoutEvent) {
+	t.events = append(t.events, event)
+	if len(t.events) > 2*lockoutEventsRetained {
+		t.events = append([]LockoutEvent(nil), t.events[len(t.events)-lockoutEventsRetained:]...)
+	}
+}
+
+// sweepLocked records expired lockouts as unlocked and drops stale counts at most once per
+// lockoutSweepInterval; callers must hold t.mu
+func (t *FailureTracker) sweepLocked(now time.Time) {
+	if now.Sub(t.lastSweep) < lockoutSweepInterval {
+		return
+	}
+	t.lastSweep = now
+
+	for id, count := range t.counts {
+		scope, key, _ := strings.Cut(id, "|")
+		t.expireLocked(scope, key, count, now)
+		if count.lockedUntil.IsZero() && now.Sub(count.first) > t.cfg.Window {
+			delete(t.counts, id)
+		}
+	}
+}
+
+// expireLocked records the unlock of a count whose lockout has passed and gives the key a fresh set of attempts;
+// callers must hold t.mu
+func (t *FailureTracker) expireLocked(scope, key string, count *failureCount, now time.Time) {
+	if count.lockedUntil.IsZero() || now.Before(count.lockedUntil) {
+		return
+	}
+	t.unlockLocked(scope, key, UnlockExpired, count.lockedUntil)
+	count.failures, count.first = 0, now
+	count.lockedAt, count.lockedUntil = time.Time{}, time.Time{}
+}
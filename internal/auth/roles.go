@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-agent-guide/internal/config"
+)
+
+// Admin roles, from least to most privileged
+const (
+	RoleViewer   = "viewer"   // Read-only access
+	RoleOperator = "operator" // Viewer plus day-to-day operations such as approvals and retries
+	RoleAdmin    = "admin"    // Everything, including pricing, credentials and the audit log
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+var (
+	// ErrInvalidCredential is returned when an admin credential is unknown
+	ErrInvalidCredential = errors.New("invalid credential")
+	// ErrCredentialExpired is returned when an admin credential is past its expiry
+	ErrCredentialExpired = errors.New("credential expired")
+)
+
+// ValidRole reports whether role is a known admin role
+func ValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// RoleAllows reports whether role includes the permissions of required
+func RoleAllows(role, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
+// AdminPrincipal is an identity allowed to use the admin API
+type AdminPrincipal struct {
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// AdminPrincipals maps admin credentials (tokens, API keys or "username:password") to principals
+type AdminPrincipals struct {
+	credentials []adminCredential
+}
+
+// adminCredential binds the SHA-256 digest of a credential to its principal
+type adminCredential struct {
+	hash      [sha256.Size]byte
+	principal *AdminPrincipal
+}
+
+// NewAdminPrincipals builds the admin principals from configuration
+// Tokens in auth_tokens keep their previous all-powerful behavior and get the admin role.
+func NewAdminPrincipals(cfg config.AdminServerConfig) (*AdminPrincipals, error) {
+	p := &AdminPrincipals{}
+
+	for i, token := range cfg.AuthTokens {
+		name := fmt.Sprintf("auth_tokens[%d]", i)
+		if cfg.AuthType == "basic" {
+			name, _, _ = strings.Cut(token, ":")
+		}
+		p.add(token, &AdminPrincipal{Name: name, Role: RoleAdmin})
+	}
+
+	for _, user := range cfg.AuthUsers {
+		if !ValidRole(user.Role) {
+			return nil, fmt.Errorf("admin user %s: invalid role %q (valid roles: viewer, operator, admin)", user.Name, user.Role)
+		}
+		principal := &AdminPrincipal{Name: user.Name, Role: user.Role}
+		if user.ExpiresAt != "" {
+			expiresAt, err := time.Parse(time.RFC3339, user.ExpiresAt)
+			if err != nil {
+				return nil, fmt.Errorf("admin user %s: invalid expires_at: %w", user.Name, err)
+			}
+			principal.ExpiresAt = &expiresAt
+		}
+		p.add(user.Token, principal)
+	}
+
+	return p, nil
+}
+
+// add binds a credential to a principal; a later binding of the same credential wins
+func (p *AdminPrincipals) add(credential string, principal *AdminPrincipal) {
+	p.credentials = append(p.credentials, adminCredential{hash: sha256.Sum256([]byte(credential)), principal: principal})
+}
+
+// Authenticate returns the principal of a credential
+// It returns ErrInvalidCredential for unknown credentials and ErrCredentialExpired, with the principal, for expired ones.
+// Every credential is compared in constant time, so the response time does not reveal how close a guess was.
+func (p *AdminPrincipals) Authenticate(credential string) (*AdminPrincipal, error) {
+	hash := sha256.Sum256([]byte(credential))
+	var principal *AdminPrincipal
+	for _, candidate := range p.credentials {
+		if subtle.ConstantTimeCompare(hash[:], candidate.hash[:]) == 1 {
+			principal = candidate.principal
+		}
+	}
+	if principal == nil {
+		return nil, ErrInvalidCredential
+	}
+	if principal.ExpiresAt != nil && !time.Now().Before(*principal.ExpiresAt) {
+		return principal, ErrCredentialExpired
+	}
+	return principal, nil
+}
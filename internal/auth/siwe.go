@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// siweHeaderSuffix ends the first line of an EIP-4361 message
+const siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+
+// SIWEMessage is a parsed EIP-4361 (Sign-In with Ethereum) message
+type SIWEMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        uint64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSIWEMessage parses an EIP-4361 message
+func ParseSIWEMessage(message string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, fmt.Errorf("not a Sign-In with Ethereum message")
+	}
+
+	msg := &SIWEMessage{Domain: strings.TrimSuffix(lines[0], siweHeaderSuffix)}
+	if msg.Domain == "" {
+		return nil, fmt.Errorf("missing domain")
+	}
+	if !common.IsHexAddress(lines[1]) {
+		return nil, fmt.Errorf("invalid address %q", lines[1])
+	}
+	msg.Address = common.HexToAddress(lines[1])
+
+	// An optional statement is surrounded by blank lines before the fields
+	i := 2
+	if i < len(lines) && lines[i] == "" {
+		i++
+		if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+			msg.Statement = lines[i]
+			i++
+			if i < len(lines) && lines[i] == "" {
+				i++
+			}
+		}
+	}
+
+	inResources := false
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if inResources {
+			if resource, ok := strings.CutPrefix(line, "- "); ok {
+				msg.Resources = append(msg.Resources, resource)
+				continue
+			}
+			inResources = false
+		}
+		if line == "Resources:" {
+			inResources = true
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		var err error
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			msg.ChainID, err = strconv.ParseUint(value, 10, 64)
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			msg.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			msg.ExpirationTime, err = parseOptionalTime(value)
+		case "Not Before":
+			msg.NotBefore, err = parseOptionalTime(value)
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	switch {
+	case msg.URI == "":
+		return nil, fmt.Errorf("missing URI")
+	case msg.Version != "1":
+		return nil, fmt.Errorf("unsupported version %q", msg.Version)
+	case msg.ChainID == 0:
+		return nil, fmt.Errorf("missing Chain ID")
+	case len(msg.Nonce) < 8:
+		return nil, fmt.Errorf("nonce must be at least 8 characters")
+	case msg.IssuedAt.IsZero():
+		return nil, fmt.Errorf("missing Issued At")
+	}
+	return msg, nil
+}
+
+// String formats the message in EIP-4361 form, ready to be signed
+func (m *SIWEMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeaderSuffix + "\n")
+	b.WriteString(m.Address.Hex() + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n\n")
+	}
+	fmt.Fprintf(&b, "URI: %s\nVersion: %s\nChain ID: %d\nNonce: %s\nIssued At: %s",
+		m.URI, m.Version, m.ChainID, m.Nonce, m.IssuedAt.UTC().Format(time.RFC3339))
+	if m.ExpirationTime != nil {
+		b.WriteString("\nExpiration Time: " + m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	if m.NotBefore != nil {
+		b.WriteString("\nNot Before: " + m.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if m.RequestID != "" {
+		b.WriteString("\nRequest ID: " + m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		b.WriteString("\nResources:")
+		for _, resource := range m.Resources {
+			b.WriteString("\n- " + resource)
+		}
+	}
+	return b.String()
+}
+
+// RecoverPersonalSigner returns the address that signed data with EIP-191 personal_sign
+// signature is 65 bytes, 0x-prefixed hex, with v as 0/1 or 27/28
+func RecoverPersonalSigner(data []byte, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	return recoverPersonalSigner(data, sig)
+}
+
+// recoverPersonalSigner recovers the EIP-191 signer of data from a raw 65-byte signature
+func recoverPersonalSigner(data, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature must be %d bytes", crypto.SignatureLength)
+	}
+	sig = append([]byte(nil), sig...)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	publicKey, err := crypto.SigToPub(accounts.TextHash(data), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// parseOptionalTime parses an RFC 3339 time field
+func parseOptionalTime(value string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
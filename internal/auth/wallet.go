@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// walletSessionIssuer is the iss claim of wallet session tokens
+const walletSessionIssuer = "agent-guide/wallet"
+
+// walletClockSkew tolerates clients whose clock is slightly ahead of the gateway
+const walletClockSkew = 30 * time.Second
+
+// Layout of a challenge nonce before hex encoding: random bytes, the expiry as Unix seconds, and a truncated HMAC
+const (
+	walletNonceRandomSize  = 16
+	walletNoncePayloadSize = walletNonceRandomSize + 8
+	walletNonceMACSize     = 16
+)
+
+var (
+	// ErrInvalidSignIn is returned when a sign-in message is malformed or does not match the challenge
+	ErrInvalidSignIn = errors.New("invalid sign-in message")
+	// ErrWalletSignature is returned when a signature does not recover to the claimed address
+	ErrWalletSignature = errors.New("signature does not match address")
+	// ErrInvalidSession is returned for unknown, expired or tampered session tokens
+	ErrInvalidSession = errors.New("invalid or expired session")
+)
+
+// WalletChallenge is a single-use nonce that a wallet signs into a sign-in message
+type WalletChallenge struct {
+	Nonce     string    `json:"nonce"`
+	Address   string    `json:"address,omitempty"` // Set when the challenge was requested for an address
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WalletSession is a session token bound to a wallet address
+type WalletSession struct {
+	Token     string    `json:"token"`
+	Address   string    `json:"address"`
+	ChainID   uint64    `json:"chainId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WalletAuth authenticates wallets with Sign-In with Ethereum sessions and signed requests
+// Challenge nonces are stateless, so unauthenticated challenge requests use no memory. Only nonces consumed by a
+// successful sign-in and the replay cache of signed requests are kept in memory, until they expire.
+type WalletAuth struct {
+	cfg config.WalletAuthConfig
+	key []byte
+
+	mu         sync.Mutex
+	usedNonces map[string]time.Time // Nonces consumed by a sign-in, until they expire
+	seen       map[string]time.Time // Signatures of accepted requests, until they are too old to replay
+	lastSweep  time.Time
+}
+
+// NewWalletAuth creates the wallet authenticator
+// If no session key is configured, a random key is generated and sessions do not survive a restart
+func NewWalletAuth(cfg config.WalletAuthConfig) (*WalletAuth, error) {
+	key := []byte(cfg.SessionKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate wallet session key: %w", err)
+		}
+		log.Warn().Msg("No wallet session key configured, using a random key; wallet sessions are invalidated on restart")
+	} else if len(key) < 32 {
+		return nil, fmt.Errorf("wallet session key must be at least 32 bytes")
+	}
+
+	return &WalletAuth{
+		cfg:        cfg,
+		key:        key,
+		usedNonces: make(map[string]time.Time),
+		seen:       make(map[string]time.Time),
+	}, nil
+}
+
+// Domain returns the domain sign-in messages must name, empty if wallet sign-in is not configured
+func (w *WalletAuth) Domain() string {
+	return w.cfg.Domain
+}
+
+// ChainIDs returns the accepted chain IDs, empty if any chain is accepted
+func (w *WalletAuth) ChainIDs() []uint64 {
+	return w.cfg.ChainIDs
+}
+
+// Challenge issues a single-use nonce, optionally bound to an address
+// The nonce carries its expiry and an HMAC over it and the address, so nothing is stored until it is used.
+func (w *WalletAuth) Challenge(address string) (*WalletChallenge, error) {
+	if address != "" {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid address %q", address)
+		}
+		address = strings.ToLower(common.HexToAddress(address).Hex())
+	}
+
+	payload := make([]byte, walletNoncePayloadSize)
+	if _, err := rand.Read(payload[:walletNonceRandomSize]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(w.cfg.ChallengeTTL).Truncate(time.Second)
+	binary.BigEndian.PutUint64(payload[walletNonceRandomSize:], uint64(expiresAt.Unix()))
+
+	return &WalletChallenge{
+		Nonce:     hex.EncodeToString(append(payload, w.nonceMAC(payload, address)...)),
+		Address:   address,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// nonceMAC returns the HMAC binding a nonce payload to an address, empty for nonces not bound to one
+func (w *WalletAuth) nonceMAC(payload []byte, address string) []byte {
+	mac := hmac.New(sha256.New, w.key)
+	mac.Write([]byte("wallet-challenge:"))
+	mac.Write(payload)
+	mac.Write([]byte(address))
+	return mac.Sum(nil)[:walletNonceMACSize]
+}
+
+// verifyNonce checks that a nonce was issued by Challenge, unbound or for address, and returns its expiry
+func (w *WalletAuth) verifyNonce(nonce, address string) (time.Time, bool) {
+	raw, err := hex.DecodeString(nonce)
+	if err != nil || len(raw) != walletNoncePayloadSize+walletNonceMACSize {
+		return time.Time{}, false
+	}
+	payload, sum := raw[:walletNoncePayloadSize], raw[walletNoncePayloadSize:]
+	if !hmac.Equal(sum, w.nonceMAC(payload, "")) && !hmac.Equal(sum, w.nonceMAC(payload, address)) {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(payload[walletNonceRandomSize:])), 0), true
+}
+
+// Login verifies a signed sign-in message and issues a session token for its address
+// The message must name the configured domain. The challenge nonce is consumed on success.
+func (w *WalletAuth) Login(message, signature string) (*WalletSession, error) {
+	if w.cfg.Domain == "" {
+		return nil, fmt.Errorf("%w: no wallet_auth domain is configured", ErrInvalidSignIn)
+	}
+	msg, err := ParseSIWEMessage(message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignIn, err)
+	}
+
+	if !strings.EqualFold(msg.Domain, w.cfg.Domain) {
+		return nil, fmt.Errorf("%w: domain %q is not accepted", ErrInvalidSignIn, msg.Domain)
+	}
+	if len(w.cfg.ChainIDs) > 0 && !slices.Contains(w.cfg.ChainIDs, msg.ChainID) {
+		return nil, fmt.Errorf("%w: chain %d is not accepted", ErrInvalidSignIn, msg.ChainID)
+	}
+
+	now := time.Now()
+	if msg.IssuedAt.After(now.Add(walletClockSkew)) {
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidSignIn)
+	}
+	if msg.ExpirationTime != nil && !now.Before(*msg.ExpirationTime) {
+		return nil, fmt.Errorf("%w: message expired", ErrInvalidSignIn)
+	}
+	if msg.NotBefore != nil && now.Add(walletClockSkew).Before(*msg.NotBefore) {
+		return nil, fmt.Errorf("%w: message not yet valid", ErrInvalidSignIn)
+	}
+
+	address := strings.ToLower(msg.Address.Hex())
+
+	// A nonce bound to another address fails verification like an unknown one
+	nonceExpiresAt, ok := w.verifyNonce(msg.Nonce, address)
+	if !ok || !now.Before(nonceExpiresAt) {
+		return nil, fmt.Errorf("%w: unknown or expired nonce", ErrInvalidSignIn)
+	}
+
+	signer, err := RecoverPersonalSigner([]byte(message), signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWalletSignature, err)
+	}
+	if signer != msg.Address {
+		return nil, ErrWalletSignature
+	}
+
+	// Consume the nonce; a concurrent login with the same nonce loses
+	w.mu.Lock()
+	_, used := w.usedNonces[msg.Nonce]
+	if !used {
+		w.sweepLocked(now)
+		w.usedNonces[msg.Nonce] = nonceExpiresAt
+	}
+	w.mu.Unlock()
+	if used {
+		return nil, fmt.Errorf("%w: nonce already used", ErrInvalidSignIn)
+	}
+
+	// The session never outlives the signed message
+	expiresAt := now.Add(w.cfg.SessionTTL)
+	if msg.ExpirationTime != nil && msg.ExpirationTime.Before(expiresAt) {
+		expiresAt = *msg.ExpirationTime
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":      walletSessionIssuer,
+		"sub":      address,
+		"chain_id": msg.ChainID,
+		"iat":      now.Unix(),
+		"exp":      expiresAt.Unix(),
+	}).SignedString(w.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign session token: %w", err)
+	}
+
+	return &WalletSession{
+		Token:     token,
+		Address:   address,
+		ChainID:   msg.ChainID,
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0).UTC(),
+	}, nil
+}
+
+// ValidateSession returns the lowercase address a session token is bound to
+func (w *WalletAuth) ValidateSession(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return w.key, nil
+	},
+		jwt.WithValidMethods([]string{AlgHS256}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(walletSessionIssuer),
+	)
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+
+	address, err := claims.GetSubject()
+	if err != nil || !common.IsHexAddress(address) {
+		return "", ErrInvalidSession
+	}
+	return address, nil
+}
+
+// markSignatureSeen records an accepted request signature until expiresAt
+// It returns false if the signature was already used
+func (w *WalletAuth) markSignatureSeen(signature string, expiresAt time.Time) bool {
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if until, exists := w.seen[signature]; exists && now.Before(until) {
+		return false
+	}
+	w.sweepLocked(now)
+	w.seen[signature] = expiresAt
+	return true
+}
+
+// sweepLocked drops expired used nonces and replay entries at most once per challenge TTL; callers must hold w.mu
+func (w *WalletAuth) sweepLocked(now time.Time) {
+	if now.Sub(w.lastSweep) < w.cfg.ChallengeTTL {
+		return
+	}
+	w.lastSweep = now
+
+	for nonce, until := range w.usedNonces {
+		if !now.Before(until) {
+			delete(w.usedNonces, nonce)
+		}
+	}
+	for signature, until := range w.seen {
+		if !now.Before(until) {
+			delete(w.seen, signature)
+		}
+	}
+}
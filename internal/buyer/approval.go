@@ -0,0 +1,251 @@
+package buyer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/config"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Approval statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+	ApprovalExpired  = "expired"  // No decision before the timeout
+	ApprovalCanceled = "canceled" // The client went away while waiting
+)
+
+// approvalRetention is how long decided approvals stay listed
+const approvalRetention = 24 * time.Hour
+
+var (
+	// ErrApprovalNotFound is returned when an approval does not exist
+	ErrApprovalNotFound = errors.New("approval not found")
+	// ErrApprovalDecided is returned when deciding an approval that is no longer pending
+	ErrApprovalDecided = errors.New("approval already decided")
+	// ErrApprovalDenied is returned to the parked request when an operator denies the payment
+	ErrApprovalDenied = errors.New("payment denied by operator")
+	// ErrApprovalTimeout is returned to the parked request when no decision is made in time
+	ErrApprovalTimeout = errors.New("payment approval timed out")
+)
+
+// Approval is a payment waiting for an operator decision
+type Approval struct {
+	ID           string                    `json:"id"`
+	Client       string                    `json:"client,omitempty"`
+	Resource     string                    `json:"resource"`
+	URL          string                    `json:"url"`
+	Requirements types.PaymentRequirements `json:"paymentRequirements"`
+	USD          string                    `json:"usd,omitempty"`
+	Status       string                    `json:"status"`
+	CreatedAt    time.Time                 `json:"createdAt"`
+	ExpiresAt    time.Time                 `json:"expiresAt"`
+	DecidedAt    *time.Time                `json:"decidedAt,omitempty"`
+	DecidedBy    string                    `json:"decidedBy,omitempty"` // "admin", "admin:<name>" or "webhook"
+	Reason       string                    `json:"reason,omitempty"`
+
+	decided chan struct{}
+}
+
+// approvalWebhookDecision is the optional decision in a webhook response body
+type approvalWebhookDecision struct {
+	Decision string `json:"decision"` // "approve" or "deny"
+	Reason   string `json:"reason"`
+}
+
+// ApprovalQueue parks large payments until an operator approves or denies them
+// Approvals are kept in memory: a parked request does not survive a restart either.
+type ApprovalQueue struct {
+	mu        sync.Mutex
+	cfg       config.ApprovalConfig
+	approvals map[string]*Approval
+}
+
+// NewApprovalQueue creates an approval queue
+func NewApprovalQueue(cfg config.ApprovalConfig) *ApprovalQueue {
+	return &ApprovalQueue{
+		cfg:       cfg,
+		approvals: make(map[string]*Approval),
+	}
+}
+
+// Wait creates a pending approval and blocks until it is decided, it times out or ctx is done
+// It returns nil on approval, ErrApprovalDenied, ErrApprovalTimeout or the context error
+func (q *ApprovalQueue) Wait(ctx context.Context, approval Approval) (*Approval, error) {
+	now := time.Now().UTC()
+	approval.ID = uuid.New().String()
+	approval.Status = ApprovalPending
+	approval.CreatedAt = now
+	approval.ExpiresAt = now.Add(q.cfg.Timeout)
+	approval.decided = make(chan struct{})
+
+	q.mu.Lock()
+	q.pruneLocked(now)
+	q.approvals[approval.ID] = &approval
+	q.mu.Unlock()
+
+	log.Warn().
+		Str("approval_id", approval.ID).
+		Str("resource", approval.Resource).
+		Str("client", approval.Client).
+		Str("usd", approval.USD).
+		Msg("Buyer payment waiting for approval")
+
+	if q.cfg.WebhookURL != "" {
+		go q.notify(approval.snapshot())
+	}
+
+	timer := time.NewTimer(q.cfg.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-approval.decided:
+	case <-timer.C:
+		q.decide(approval.ID, ApprovalExpired, "", "no decision before the timeout")
+	case <-ctx.Done():
+		q.decide(approval.ID, ApprovalCanceled, "", ctx.Err().Error())
+	}
+
+	decided, err := q.Get(approval.ID)
+	if err != nil {
+		return nil, err
+	}
+	switch decided.Status {
+	case ApprovalApproved:
+		return decided, nil
+	case ApprovalDenied:
+		if decided.Reason != "" {
+			return decided, fmt.Errorf("%w: %s", ErrApprovalDenied, decided.Reason)
+		}
+		return decided, ErrApprovalDenied
+	case ApprovalExpired:
+		return decided, ErrApprovalTimeout
+	default:
+		return decided, ctx.Err()
+	}
+}
+
+// Approve approves a pending payment
+func (q *ApprovalQueue) Approve(id, by, reason string) (*Approval, error) {
+	return q.decide(id, ApprovalApproved, by, reason)
+}
+
+// Deny denies a pending payment
+func (q *ApprovalQueue) Deny(id, by, reason string) (*Approval, error) {
+	return q.decide(id, ApprovalDenied, by, reason)
+}
+
+// Get returns an approval by ID
+func (q *ApprovalQueue) Get(id string) (*Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	approval, exists := q.approvals[id]
+	if !exists {
+		return nil, ErrApprovalNotFound
+	}
+	return approval.snapshot(), nil
+}
+
+// List returns the approvals with a status (all if empty), oldest first
+func (q *ApprovalQueue) List(status string) []*Approval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneLocked(time.Now())
+
+	approvals := make([]*Approval, 0, len(q.approvals))
+	for _, approval := range q.approvals {
+		if status != "" && approval.Status != status {
+			continue
+		}
+		approvals = append(approvals, approval.snapshot())
+	}
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].CreatedAt.Before(approvals[j].CreatedAt)
+	})
+	return approvals
+}
+
+// decide moves a pending approval to a final status and wakes the parked request
+func (q *ApprovalQueue) decide(id, status, by, reason string) (*Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	approval, exists := q.approvals[id]
+	if !exists {
+		return nil, ErrApprovalNotFound
+	}
+	if approval.Status != ApprovalPending {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalDecided, approval.Status)
+	}
+
+	now := time.Now().UTC()
+	approval.Status = status
+	approval.DecidedAt = &now
+	approval.DecidedBy = by
+	approval.Reason = reason
+	close(approval.decided)
+
+	log.Info().
+		Str("approval_id", id).
+		Str("status", status).
+		Str("decided_by", by).
+		Str("reason", reason).
+		Msg("Buyer payment approval decided")
+
+	return approval.snapshot(), nil
+}
+
+// notify posts a pending approval to the webhook
+// The webhook may decide immediately by answering {"decision": "approve"|"deny", "reason": "..."}
+func (q *ApprovalQueue) notify(approval *Approval) {
+	data, err := postWebhook(q.cfg.WebhookURL, q.cfg.WebhookSecret, approval)
+	if err != nil {
+		log.Error().Err(err).Str("approval_id", approval.ID).Msg("Approval webhook failed")
+		return
+	}
+
+	var decision approvalWebhookDecision
+	if json.Unmarshal(data, &decision) != nil {
+		return
+	}
+
+	switch decision.Decision {
+	case "approve":
+		_, err = q.Approve(approval.ID, "webhook", decision.Reason)
+	case "deny":
+		_, err = q.Deny(approval.ID, "webhook", decision.Reason)
+	default:
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("approval_id", approval.ID).Msg("Failed to apply approval webhook decision")
+	}
+}
+
+// pruneLocked drops decided approvals past the retention; callers must hold q.mu
+func (q *ApprovalQueue) pruneLocked(now time.Time) {
+	for id, approval := range q.approvals {
+		if approval.DecidedAt != nil && now.Sub(*approval.DecidedAt) > approvalRetention {
+			delete(q.approvals, id)
+		}
+	}
+}
+
+// snapshot returns a copy of the approval without its wake-up channel
+func (a *Approval) snapshot() *Approval {
+	copied := *a
+	copied.decided = nil
+	return &copied
+}
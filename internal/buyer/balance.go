@@ -0,0 +1,403 @@
+package buyer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/pricing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Wallet roles of tracked balances
+const (
+	RoleBuyer       = "buyer"
+	RoleFacilitator = "facilitator"
+)
+
+// balancePollTimeout bounds the RPC calls of one poll
+const balancePollTimeout = 10 * time.Second
+
+// ErrInsufficientBalance is returned when a payment exceeds the known buyer wallet balance
+var ErrInsufficientBalance = errors.New("insufficient buyer wallet balance")
+
+// erc20BalanceABI holds the ERC-20 balanceOf function
+var erc20BalanceABI = mustParseABI(`[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]}
+]`)
+
+// BalanceDialer connects to the chain network of a tracked wallet
+// *ethclient.Client implements bind.ContractCaller, and so do simulated backends
+type BalanceDialer func(ctx context.Context, network *config.ChainNetwork) (bind.ContractCaller, error)
+
+// dialChainNetwork connects to the RPC endpoint of a chain network
+func dialChainNetwork(ctx context.Context, network *config.ChainNetwork) (bind.ContractCaller, error) {
+	return ethclient.DialContext(ctx, network.RPC)
+}
+
+var (
+	walletBalance = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wallet_token_balance",
+			Help: "Token balance of buyer and facilitator wallets, in whole tokens",
+		},
+		[]string{"role", "network", "address", "token"},
+	)
+
+	walletBalanceLow = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "wallet_token_balance_low",
+			Help: "1 if the wallet balance is below the configured floor",
+		},
+		[]string{"role", "network", "address", "token"},
+	)
+)
+
+// WalletBalance is the last known token balance of a wallet
+type WalletBalance struct {
+	Role      string    `json:"role"`
+	Network   string    `json:"network"`
+	Address   string    `json:"address"`
+	Token     string    `json:"token"`
+	Balance   string    `json:"balance,omitempty"`  // Token base units, minus payments signed since the last poll
+	Amount    string    `json:"amount,omitempty"`   // Human amount, e.g. "12.5"
+	Reserved  string    `json:"reserved,omitempty"` // Base units signed since the last poll
+	Floor     string    `json:"floor,omitempty"`    // Floor in base units, empty if alerts are disabled
+	Low       bool      `json:"low"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	Error     string    `json:"error,omitempty"` // Error of the last poll
+
+	network  *config.ChainNetwork
+	address  common.Address
+	balance  *big.Int // Nil until the first successful poll
+	reserved *big.Int
+}
+
+// lowBalanceEvent is the webhook body sent when a wallet drops below the floor
+type lowBalanceEvent struct {
+	Event string `json:"event"` // "low_balance"
+	*WalletBalance
+}
+
+// BalanceTracker polls the token balances of the buyer and facilitator wallets
+// Payments are refused before signing if they exceed the known buyer balance.
+type BalanceTracker struct {
+	mu      sync.Mutex
+	cfg     config.BalanceConfig
+	wallets []*WalletBalance
+	byBuyer map[string]*WalletBalance // network name -> buyer wallet balance
+	rates   *pricing.RateTable
+	dial    BalanceDialer
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewBalanceTracker creates a tracker for the buyer wallets and the facilitator wallet of every network
+func NewBalanceTracker(cfg config.BalanceConfig, facilitatorCfg config.FacilitatorConfig, wallets *Wallets) *BalanceTracker {
+	t := &BalanceTracker{
+		cfg:     cfg,
+		byBuyer: make(map[string]*WalletBalance),
+		dial:    dialChainNetwork,
+	}
+
+	var facilitatorAddress *common.Address
+	if key, err := parsePrivateKey(facilitatorCfg.PrivateKey); err == nil {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		facilitatorAddress = &address
+	}
+
+	for i := range facilitatorCfg.ChainNetworks {
+		network := &facilitatorCfg.ChainNetworks[i]
+		if wallet, err := wallets.ForNetwork(network.Name); err == nil {
+			balance := newWalletBalance(RoleBuyer, network, wallet.Address)
+			t.wallets = append(t.wallets, balance)
+			t.byBuyer[network.Name] = balance
+		}
+		if facilitatorAddress != nil {
+			t.wallets = append(t.wallets, newWalletBalance(RoleFacilitator, network, *facilitatorAddress))
+		}
+	}
+
+	return t
+}
+
+// newWalletBalance creates an unpolled wallet balance
+func newWalletBalance(role string, network *config.ChainNetwork, address common.Address) *WalletBalance {
+	return &WalletBalance{
+		Role:     role,
+		Network:  network.Name,
+		Address:  address.Hex(),
+		Token:    network.Symbol(),
+		network:  network,
+		address:  address,
+		reserved: new(big.Int),
+	}
+}
+
+// Start polls balances every poll_interval until Stop; rates convert the floor into token amounts
+func (t *BalanceTracker) Start(rates *pricing.RateTable) {
+	t.rates = rates
+	if t.cfg.PollInterval <= 0 || len(t.wallets) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			t.Poll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops polling
+func (t *BalanceTracker) Stop() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.wg.Wait()
+}
+
+// Poll reads all tracked balances once
+func (t *BalanceTracker) Poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, balancePollTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, wallet := range t.wallets {
+		wg.Add(1)
+		go func(wallet *WalletBalance) {
+			defer wg.Done()
+			balance, err := readTokenBalance(ctx, t.dial, wallet.network, wallet.address)
+			t.update(wallet, balance, err)
+		}(wallet)
+	}
+	wg.Wait()
+}
+
+// update stores a polled balance and fires the low-balance webhook when the wallet drops below the floor
+func (t *BalanceTracker) update(wallet *WalletBalance, balance *big.Int, err error) {
+	t.mu.Lock()
+
+	if err != nil {
+		if wallet.Error == "" {
+			log.Warn().Err(err).Str("role", wallet.Role).Str("network", wallet.Network).Msg("Failed to read wallet balance")
+		}
+		wallet.Error = err.Error()
+		t.mu.Unlock()
+		return
+	}
+
+	wallet.Error = ""
+	wallet.balance = balance
+	wallet.reserved = new(big.Int)
+	wallet.UpdatedAt = time.Now().UTC()
+
+	wasLow := wallet.Low
+	wallet.Low = false
+	wallet.Floor = ""
+	if floor := t.floorLocked(wallet.network); floor != nil {
+		wallet.Floor = floor.String()
+		wallet.Low = balance.Cmp(floor) < 0
+	}
+	wallet.refreshLocked()
+
+	var event *lowBalanceEvent
+	if wallet.Low && !wasLow {
+		snapshot := *wallet
+		event = &lowBalanceEvent{Event: "low_balance", WalletBalance: &snapshot}
+	}
+	t.mu.Unlock()
+
+	if event == nil {
+		return
+	}
+	log.Warn().
+		Str("role", wallet.Role).
+		Str("network", wallet.Network).
+		Str("address", wallet.Address).
+		Str("amount", event.Amount).
+		Msg("Wallet balance below floor")
+	if t.cfg.WebhookURL != "" {
+		go func() {
+			if _, err := postWebhook(t.cfg.WebhookURL, t.cfg.WebhookSecret, event); err != nil {
+				log.Error().Err(err).Str("network", event.Network).Msg("Low-balance webhook failed")
+			}
+		}()
+	}
+}
+
+// Reserve deducts a payment from the known buyer balance of a network
+// It returns ErrInsufficientBalance if the payment exceeds it; unknown balances do not block payments
+func (t *BalanceTracker) Reserve(network, amount string) error {
+	units, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return fmt.Errorf("invalid payment amount %q", amount)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wallet, exists := t.byBuyer[network]
+	if !exists || wallet.balance == nil {
+		return nil
+	}
+
+	available := new(big.Int).Sub(wallet.balance, wallet.reserved)
+	if units.Cmp(available) > 0 {
+		return fmt.Errorf(
+			"%w on %s: payment of %s exceeds the available %s base units",
+			ErrInsufficientBalance, network, amount, available.String(),
+		)
+	}
+	wallet.reserved.Add(wallet.reserved, units)
+	wallet.refreshLocked()
+	return nil
+}
+
+// Release returns a reserved payment that was never taken
+func (t *BalanceTracker) Release(network, amount string) {
+	units, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wallet, exists := t.byBuyer[network]
+	if !exists {
+		return
+	}
+	wallet.reserved.Sub(wallet.reserved, units)
+	if wallet.reserved.Sign() < 0 {
+		wallet.reserved.SetInt64(0)
+	}
+	wallet.refreshLocked()
+}
+
+// List returns the tracked balances
+func (t *BalanceTracker) List() []WalletBalance {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	balances := make([]WalletBalance, 0, len(t.wallets))
+	for _, wallet := range t.wallets {
+		balances = append(balances, *wallet)
+	}
+	return balances
+}
+
+// floorLocked returns the floor in base units of a network token, or nil if alerts are disabled
+func (t *BalanceTracker) floorLocked(network *config.ChainNetwork) *big.Int {
+	if t.cfg.Floor == "" || t.rates == nil {
+		return nil
+	}
+	price, err := pricing.ParsePrice(t.cfg.Floor)
+	if err != nil {
+		return nil
+	}
+	amount, err := t.rates.AmountForNetwork(price, network)
+	if err != nil {
+		return nil
+	}
+	floor, _ := new(big.Int).SetString(amount, 10)
+	return floor
+}
+
+// refreshLocked updates the exported fields and gauges from the raw balance; callers must hold t.mu
+func (w *WalletBalance) refreshLocked() {
+	if w.balance == nil {
+		return
+	}
+	available := new(big.Int).Sub(w.balance, w.reserved)
+	amount := pricing.FromBaseUnits(available, w.network.TokenDecimals)
+
+	w.Balance = available.String()
+	w.Amount = pricing.FormatDecimal(amount)
+	w.Reserved = ""
+	if w.reserved.Sign() > 0 {
+		w.Reserved = w.reserved.String()
+	}
+
+	value, _ := amount.Float64()
+	walletBalance.WithLabelValues(w.Role, w.Network, w.Address, w.Token).Set(value)
+	low := 0.0
+	if w.Low {
+		low = 1
+	}
+	walletBalanceLow.WithLabelValues(w.Role, w.Network, w.Address, w.Token).Set(low)
+}
+
+// TokenBalance reads the balance of the network token held by an address, in base units
+func TokenBalance(ctx context.Context, network *config.ChainNetwork, address common.Address) (*big.Int, error) {
+	return readTokenBalance(ctx, dialChainNetwork, network, address)
+}
+
+// readTokenBalance connects to a network with dial and reads the token balance of an address
+func readTokenBalance(ctx context.Context, dial BalanceDialer, network *config.ChainNetwork, address common.Address) (*big.Int, error) {
+	caller, err := dial(ctx, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", network.Name, err)
+	}
+	if closer, ok := caller.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+
+	data, err := erc20BalanceABI.Pack("balanceOf", address)
+	if err != nil {
+		return nil, err
+	}
+	token := common.HexToAddress(network.TokenAddress)
+	output, err := caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call balanceOf: %w", err)
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("balanceOf returned no data; is %s a token contract?", token.Hex())
+	}
+	results, err := erc20BalanceABI.Unpack("balanceOf", output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode balanceOf: %w", err)
+	}
+	balance, ok := results[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected balanceOf result")
+	}
+	return balance, nil
+}
+
+// mustParseABI parses a contract ABI definition known at compile time
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("invalid contract ABI: %v", err))
+	}
+	return parsed
+}
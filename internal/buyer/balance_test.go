@@ -0,0 +1,316 @@
+package buyer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/pricing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testTokenCode is the runtime code of a minimal token: a call with one argument returns the storage
+// slot named by it (balanceOf), a call with two arguments stores the second in the slot of the first
+var testTokenCode = common.FromHex("604436146013576004355460005260206000f35b6024356004355500")
+
+var testTokenAddress = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+// testNetwork returns a 6-decimal USD-pegged network whose token is testTokenAddress
+func testNetwork() config.ChainNetwork {
+	return config.ChainNetwork{
+		Name:          "simulated",
+		ID:            1337,
+		TokenAddress:  testTokenAddress.Hex(),
+		TokenName:     "USDC",
+		TokenDecimals: 6,
+	}
+}
+
+// testChain is a simulated chain with testTokenCode deployed at testTokenAddress
+type testChain struct {
+	backend *backends.SimulatedBackend
+	funder  *ecdsa.PrivateKey
+}
+
+// newTestChain starts a simulated chain where each address holds the given token balance
+func newTestChain(t *testing.T, balances map[common.Address]int64) *testChain {
+	t.Helper()
+	funder, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := make(map[common.Hash]common.Hash)
+	for address, balance := range balances {
+		storage[common.BytesToHash(address.Bytes())] = common.BigToHash(big.NewInt(balance))
+	}
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		crypto.PubkeyToAddress(funder.PublicKey): {Balance: big.NewInt(1e18)},
+		testTokenAddress:                         {Code: testTokenCode, Storage: storage, Balance: new(big.Int)},
+	}, 8_000_000)
+	t.Cleanup(func() { backend.Close() })
+
+	return &testChain{backend: backend, funder: funder}
+}
+
+// setBalance changes the token balance of an address in a new block
+func (c *testChain) setBalance(t *testing.T, address common.Address, balance int64) {
+	t.Helper()
+	ctx := context.Background()
+	from := crypto.PubkeyToAddress(c.funder.PublicKey)
+	nonce, err := c.backend.PendingNonceAt(ctx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice, err := c.backend.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := append(common.LeftPadBytes(address.Bytes(), 32), common.BigToHash(big.NewInt(balance)).Bytes()...)
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       &testTokenAddress,
+		Gas:      100_000,
+		GasPrice: gasPrice,
+		Data:     append(make([]byte, 4), data...),
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(big.NewInt(1337)), c.funder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.backend.SendTransaction(ctx, signed); err != nil {
+		t.Fatal(err)
+	}
+	c.backend.Commit()
+}
+
+// dial connects to the simulated chain; the backend is wrapped so polls do not close it
+func (c *testChain) dial(context.Context, *config.ChainNetwork) (bind.ContractCaller, error) {
+	return struct{ bind.ContractCaller }{c.backend}, nil
+}
+
+// newTestTracker creates a tracker for a buyer wallet and a facilitator wallet on testNetwork
+func newTestTracker(t *testing.T, cfg config.BalanceConfig) (*BalanceTracker, common.Address, common.Address) {
+	t.Helper()
+	buyerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	facilitatorKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facilitatorCfg := config.FacilitatorConfig{
+		PrivateKey:    hex.EncodeToString(crypto.FromECDSA(facilitatorKey)),
+		ChainNetworks: []config.ChainNetwork{testNetwork()},
+	}
+	wallets, err := NewWallets(config.BuyerConfig{PrivateKey: hex.EncodeToString(crypto.FromECDSA(buyerKey))}, facilitatorCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rates, err := pricing.NewRateTable(config.PricingConfig{USDPegged: []string{"USDC"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewBalanceTracker(cfg, facilitatorCfg, wallets)
+	tracker.Start(rates) // Without a poll interval, Start only sets the rates
+	t.Cleanup(tracker.Stop)
+
+	return tracker, crypto.PubkeyToAddress(buyerKey.PublicKey), crypto.PubkeyToAddress(facilitatorKey.PublicKey)
+}
+
+// balanceOf returns the tracked balance of a wallet role
+func balanceOf(t *testing.T, tracker *BalanceTracker, role string) WalletBalance {
+	t.Helper()
+	for _, balance := range tracker.List() {
+		if balance.Role == role {
+			return balance
+		}
+	}
+	t.Fatalf("no %s wallet tracked", role)
+	return WalletBalance{}
+}
+
+func TestBalanceTrackerReserveAndRelease(t *testing.T) {
+	tracker, _, _ := newTestTracker(t, config.BalanceConfig{})
+	network := testNetwork().Name
+
+	// An unknown balance never blocks payments
+	if err := tracker.Reserve(network, "1000000000"); err != nil {
+		t.Fatalf("Reserve before the first poll: %v", err)
+	}
+	if err := tracker.Reserve(network, "not-a-number"); err == nil {
+		t.Fatal("Reserve accepted an invalid amount")
+	}
+
+	tracker.update(tracker.byBuyer[network], big.NewInt(1000), nil)
+
+	if err := tracker.Reserve(network, "400"); err != nil {
+		t.Fatalf("Reserve(400): %v", err)
+	}
+	if err := tracker.Reserve(network, "700"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("Reserve(700) with 600 available: got %v, want ErrInsufficientBalance", err)
+	}
+	if err := tracker.Reserve(network, "600"); err != nil {
+		t.Fatalf("Reserve(600) with 600 available: %v", err)
+	}
+	if got := balanceOf(t, tracker, RoleBuyer); got.Balance != "0" || got.Reserved != "1000" {
+		t.Fatalf("after reserving everything: balance %q reserved %q, want 0 and 1000", got.Balance, got.Reserved)
+	}
+	if err := tracker.Reserve(network, "1"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("Reserve(1) with nothing available: got %v, want ErrInsufficientBalance", err)
+	}
+
+	tracker.Release(network, "600")
+	if got := balanceOf(t, tracker, RoleBuyer); got.Balance != "600" || got.Reserved != "400" {
+		t.Fatalf("after release: balance %q reserved %q, want 600 and 400", got.Balance, got.Reserved)
+	}
+
+	// Releasing more than was reserved does not raise the balance above the polled one
+	tracker.Release(network, "5000")
+	if got := balanceOf(t, tracker, RoleBuyer); got.Balance != "1000" || got.Reserved != "" {
+		t.Fatalf("after over-release: balance %q reserved %q, want 1000 and none", got.Balance, got.Reserved)
+	}
+
+	// Payments on networks without a buyer wallet are not tracked
+	if err := tracker.Reserve("other", "5000"); err != nil {
+		t.Fatalf("Reserve on an untracked network: %v", err)
+	}
+}
+
+func TestBalanceTrackerLowBalanceWebhook(t *testing.T) {
+	const secret = "webhook-secret"
+	events := make(chan lowBalanceEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if r.Header.Get(WebhookSignatureHeader) != hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("webhook signature does not match the body")
+		}
+		var event lowBalanceEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	tracker, buyerAddress, _ := newTestTracker(t, config.BalanceConfig{
+		Floor:         "$5.00",
+		WebhookURL:    server.URL,
+		WebhookSecret: secret,
+	})
+	wallet := tracker.byBuyer[testNetwork().Name]
+
+	expectEvents := func(want int) {
+		t.Helper()
+		for i := 0; i < want; i++ {
+			select {
+			case event := <-events:
+				if event.Event != "low_balance" || event.Address != buyerAddress.Hex() || !event.Low {
+					t.Fatalf("unexpected webhook event: %+v", event)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected a low-balance webhook")
+			}
+		}
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected extra webhook: %+v", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// The floor is 5 USDC, or 5000000 base units
+	tracker.update(wallet, big.NewInt(10_000_000), nil)
+	expectEvents(0)
+	if got := balanceOf(t, tracker, RoleBuyer); got.Low || got.Floor != "5000000" {
+		t.Fatalf("above the floor: low %v floor %q", got.Low, got.Floor)
+	}
+
+	tracker.update(wallet, big.NewInt(4_000_000), nil)
+	expectEvents(1)
+
+	// Staying below the floor does not fire again, and neither does a failed poll
+	tracker.update(wallet, big.NewInt(3_000_000), nil)
+	tracker.update(wallet, nil, errors.New("rpc unavailable"))
+	expectEvents(0)
+	if got := balanceOf(t, tracker, RoleBuyer); !got.Low || got.Error == "" || got.Balance != "3000000" {
+		t.Fatalf("after a failed poll: low %v error %q balance %q", got.Low, got.Error, got.Balance)
+	}
+
+	// Recovering and dropping again is a new transition
+	tracker.update(wallet, big.NewInt(6_000_000), nil)
+	expectEvents(0)
+	tracker.update(wallet, big.NewInt(1), nil)
+	expectEvents(1)
+}
+
+func TestBalanceTrackerPollsSimulatedChain(t *testing.T) {
+	tracker, buyerAddress, facilitatorAddress := newTestTracker(t, config.BalanceConfig{Floor: "$5.00"})
+	chain := newTestChain(t, map[common.Address]int64{
+		buyerAddress:       12_500_000,
+		facilitatorAddress: 2_000_000,
+	})
+	tracker.dial = chain.dial
+	network := testNetwork().Name
+
+	tracker.Poll(context.Background())
+	buyerBalance := balanceOf(t, tracker, RoleBuyer)
+	if buyerBalance.Balance != "12500000" || buyerBalance.Amount != "12.5" || buyerBalance.Low || buyerBalance.Error != "" {
+		t.Fatalf("buyer after first poll: %+v", buyerBalance)
+	}
+	if got := balanceOf(t, tracker, RoleFacilitator); got.Balance != "2000000" || !got.Low {
+		t.Fatalf("facilitator after first poll: %+v", got)
+	}
+
+	// A payment signed since the poll counts against the balance until the next poll
+	if err := tracker.Reserve(network, "10000000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Reserve(network, "5000000"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("got %v, want ErrInsufficientBalance", err)
+	}
+
+	// The payment settles on-chain; the next poll reads the new balance and drops the reservation
+	chain.setBalance(t, buyerAddress, 2_500_000)
+	tracker.Poll(context.Background())
+	buyerBalance = balanceOf(t, tracker, RoleBuyer)
+	if buyerBalance.Balance != "2500000" || buyerBalance.Reserved != "" || !buyerBalance.Low {
+		t.Fatalf("buyer after second poll: %+v", buyerBalance)
+	}
+
+	// A failed poll keeps the last known balance and records the error
+	tracker.dial = func(context.Context, *config.ChainNetwork) (bind.ContractCaller, error) {
+		return nil, errors.New("connection refused")
+	}
+	tracker.Poll(context.Background())
+	buyerBalance = balanceOf(t, tracker, RoleBuyer)
+	if buyerBalance.Balance != "2500000" || buyerBalance.Error == "" {
+		t.Fatalf("buyer after failed poll: %+v", buyerBalance)
+	}
+	if err := tracker.Reserve(network, "3000000"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("got %v, want ErrInsufficientBalance after a failed poll", err)
+	}
+}
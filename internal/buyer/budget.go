@@ -0,0 +1,298 @@
+package buyer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/pricing"
+	"go-agent-guide/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// GlobalScope is the budget scope covering payments for all resources
+const GlobalScope = "global"
+
+// clientScopePrefix prefixes the budget scopes of internal clients
+const clientScopePrefix = "client:"
+
+// ClientScope returns the budget scope covering the payments of an internal client
+func ClientScope(client string) string {
+	return clientScopePrefix + client
+}
+
+// ErrBudgetExceeded is returned when a payment would exceed a rolling budget
+var ErrBudgetExceeded = errors.New("buyer budget exceeded")
+
+// BudgetExceededError describes the budget a payment would exceed
+type BudgetExceededError struct {
+	Scope      string        // GlobalScope, a resource path or a ClientScope
+	Window     string        // WindowHourly or WindowDaily
+	Limit      *big.Rat      // Budget in USD
+	Spent      *big.Rat      // Spend inside the window in USD
+	Amount     *big.Rat      // USD value of the rejected payment
+	RetryAfter time.Duration // Time until enough spend leaves the window, 0 if the payment never fits
+}
+
+// Error implements the error interface
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf(
+		"%s: %s %s budget of $%s would be exceeded (spent $%s, payment $%s)",
+		ErrBudgetExceeded, e.Scope, e.Window,
+		pricing.FormatDecimal(e.Limit), pricing.FormatDecimal(e.Spent), pricing.FormatDecimal(e.Amount),
+	)
+}
+
+// Is makes errors.Is(err, ErrBudgetExceeded) match
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// BudgetLimit is a rolling budget enforced by Reserve
+type BudgetLimit struct {
+	Scope  string   // GlobalScope, a resource path or a ClientScope
+	Window string   // WindowHourly or WindowDaily
+	Limit  *big.Rat // Budget in USD
+}
+
+// Spend is an outgoing payment counted against budgets
+type Spend struct {
+	ID       string    `json:"id"`
+	Client   string    `json:"client,omitempty"` // Internal client the payment is charged to
+	Resource string    `json:"resource"`
+	Network  string    `json:"network"`
+	Asset    string    `json:"asset"`
+	PayTo    string    `json:"payTo"`
+	Amount   string    `json:"amount"` // Token base units
+	USD      string    `json:"usd"`    // USD value, empty if unknown
+	Time     time.Time `json:"time"`
+
+	usd *big.Rat
+}
+
+// spendRecord is a journal record of a reserved or released spend
+type spendRecord struct {
+	Op    string `json:"op"` // "reserve" or "release"
+	Spend Spend  `json:"spend"`
+}
+
+// BudgetTracker keeps rolling spend counters for outgoing payments
+// Spends are journaled so counters survive a restart; entries older than a day are dropped.
+type BudgetTracker struct {
+	mu      sync.Mutex
+	journal *store.Journal
+	spends  []*Spend // Ordered by time
+}
+
+// NewBudgetTracker opens the spend journal at path and rebuilds the counters
+func NewBudgetTracker(path string) (*BudgetTracker, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &BudgetTracker{journal: journal}
+
+	byID := make(map[string]*Spend)
+	err = journal.Replay(func(data json.RawMessage) error {
+		var record spendRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil
+		}
+		switch record.Op {
+		case "reserve":
+			spend := record.Spend
+			spend.usd = parseUSD(spend.USD)
+			byID[spend.ID] = &spend
+			t.spends = append(t.spends, &spend)
+		case "release":
+			delete(byID, record.Spend.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load buyer spend journal: %w", err)
+	}
+
+	// Drop released and expired spends and compact the journal
+	cutoff := time.Now().Add(-windowDurations[WindowDaily])
+	spends := t.spends[:0]
+	records := make([]interface{}, 0, len(byID))
+	for _, spend := range t.spends {
+		if _, active := byID[spend.ID]; !active || spend.Time.Before(cutoff) {
+			continue
+		}
+		spends = append(spends, spend)
+		records = append(records, spendRecord{Op: "reserve", Spend: *spend})
+	}
+	t.spends = spends
+	if err := journal.Rewrite(records); err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to compact buyer spend journal: %w", err)
+	}
+
+	log.Info().Int("spends", len(t.spends)).Str("path", path).Msg("Buyer spend counters loaded")
+
+	return t, nil
+}
+
+// Reserve records a spend if it fits all budget limits
+// usd is the USD value of the payment, or nil if unknown (counted as zero)
+// It returns a *BudgetExceededError if any limit would be exceeded; nothing is recorded in that case
+func (t *BudgetTracker) Reserve(spend Spend, usd *big.Rat, limits []BudgetLimit) (*Spend, error) {
+	spend.USD = ""
+	if usd != nil {
+		spend.USD = pricing.FormatDecimal(usd)
+	} else {
+		usd = new(big.Rat)
+	}
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pruneLocked(now)
+
+	for _, limit := range limits {
+		spent := t.spentLocked(limit.Scope, limit.Window, now)
+		total := new(big.Rat).Add(spent, usd)
+		if total.Cmp(limit.Limit) > 0 {
+			return nil, &BudgetExceededError{
+				Scope:      limit.Scope,
+				Window:     limit.Window,
+				Limit:      limit.Limit,
+				Spent:      spent,
+				Amount:     usd,
+				RetryAfter: t.retryAfterLocked(limit, usd, now),
+			}
+		}
+	}
+
+	spend.ID = uuid.New().String()
+	spend.Time = now
+	spend.usd = new(big.Rat).Set(usd)
+
+	if err := t.journal.Append(spendRecord{Op: "reserve", Spend: spend}); err != nil {
+		return nil, fmt.Errorf("failed to persist buyer spend: %w", err)
+	}
+	t.spends = append(t.spends, &spend)
+
+	copied := spend
+	return &copied, nil
+}
+
+// Release removes a reserved spend, e.g. when the payment could not be created
+func (t *BudgetTracker) Release(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, spend := range t.spends {
+		if spend.ID != id {
+			continue
+		}
+		if err := t.journal.Append(spendRecord{Op: "release", Spend: Spend{ID: id}}); err != nil {
+			return fmt.Errorf("failed to persist buyer spend release: %w", err)
+		}
+		t.spends = append(t.spends[:i], t.spends[i+1:]...)
+		return nil
+	}
+	return nil
+}
+
+// Spent returns the USD spend of a scope inside a rolling window
+func (t *BudgetTracker) Spent(scope, window string) *big.Rat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spentLocked(scope, window, time.Now())
+}
+
+// Resources returns the resources with spend inside the daily window
+func (t *BudgetTracker) Resources() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var resources []string
+	for _, spend := range t.spends {
+		if !seen[spend.Resource] {
+			seen[spend.Resource] = true
+			resources = append(resources, spend.Resource)
+		}
+	}
+	return resources
+}
+
+// Close closes the spend journal
+func (t *BudgetTracker) Close() error {
+	return t.journal.Close()
+}
+
+// spentLocked sums the spend of a scope inside a window; callers must hold t.mu
+func (t *BudgetTracker) spentLocked(scope, window string, now time.Time) *big.Rat {
+	cutoff := now.Add(-windowDurations[window])
+	total := new(big.Rat)
+	for _, spend := range t.spends {
+		if spend.Time.After(cutoff) && spend.inScope(scope) {
+			total.Add(total, spend.usd)
+		}
+	}
+	return total
+}
+
+// retryAfterLocked returns how long until a payment fits a limit; callers must hold t.mu
+func (t *BudgetTracker) retryAfterLocked(limit BudgetLimit, usd *big.Rat, now time.Time) time.Duration {
+	if usd.Cmp(limit.Limit) > 0 {
+		return 0
+	}
+
+	duration := windowDurations[limit.Window]
+	cutoff := now.Add(-duration)
+	remaining := new(big.Rat).Add(t.spentLocked(limit.Scope, limit.Window, now), usd)
+	for _, spend := range t.spends {
+		if !spend.Time.After(cutoff) || !spend.inScope(limit.Scope) {
+			continue
+		}
+		remaining.Sub(remaining, spend.usd)
+		if remaining.Cmp(limit.Limit) <= 0 {
+			return spend.Time.Add(duration).Sub(now)
+		}
+	}
+	return 0
+}
+
+// pruneLocked drops spends older than the longest window; callers must hold t.mu
+func (t *BudgetTracker) pruneLocked(now time.Time) {
+	cutoff := now.Add(-windowDurations[WindowDaily])
+	i := 0
+	for i < len(t.spends) && t.spends[i].Time.Before(cutoff) {
+		i++
+	}
+	t.spends = t.spends[i:]
+}
+
+// inScope reports whether a spend counts against a budget scope
+func (s *Spend) inScope(scope string) bool {
+	if scope == GlobalScope {
+		return true
+	}
+	if strings.HasPrefix(scope, clientScopePrefix) {
+		return s.Client != "" && ClientScope(s.Client) == scope
+	}
+	return s.Resource == scope
+}
+
+// parseUSD parses a stored USD value, returning zero for empty or invalid values
+func parseUSD(value string) *big.Rat {
+	usd, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return new(big.Rat)
+	}
+	return usd
+}
@@ -0,0 +1,313 @@
+package buyer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/pricing"
+	"go-agent-guide/internal/store"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// Payment statuses
+const (
+	PaymentPending = "pending" // Sent upstream, no response yet
+	PaymentSettled = "settled" // Upstream accepted the payment
+	PaymentFailed  = "failed"  // Upstream rejected the payment
+	PaymentUnknown = "unknown" // Upstream failed without saying whether the payment was taken
+)
+
+// ErrPaymentNotFound is returned when a payment is not in the ledger
+var ErrPaymentNotFound = errors.New("buyer payment not found")
+
+var (
+	paymentsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "buyer_payments_total",
+			Help: "Total number of outgoing x402 payments",
+		},
+		[]string{"resource", "network", "status"},
+	)
+
+	paymentsUSDTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "buyer_payments_usd_total",
+			Help: "Total USD value of outgoing x402 payments",
+		},
+		[]string{"resource", "network", "status"},
+	)
+)
+
+// Payment is an outgoing x402 payment made by the gateway
+type Payment struct {
+	ID             string                `json:"id"`
+	Time           time.Time             `json:"time"`
+	Client         string                `json:"client,omitempty"` // Internal client that triggered the payment
+	Resource       string                `json:"resource"`
+	Method         string                `json:"method"`
+	URL            string                `json:"url"` // Upstream URL
+	Scheme         string                `json:"scheme"`
+	Network        string                `json:"network"`
+	Asset          string                `json:"asset"`
+	PayTo          string                `json:"payTo"`
+	Payer          string                `json:"payer"`
+	Amount         string                `json:"amount"`        // Token base units
+	USD            string                `json:"usd,omitempty"` // USD value, empty if unknown
+	Nonce          string                `json:"nonce"`
+	Status         string                `json:"status"`
+	UpstreamStatus int                   `json:"upstreamStatus,omitempty"`
+	Settlement     *types.SettleResponse `json:"settlement,omitempty"` // Decoded X-Payment-Response of the upstream
+	CompletedAt    *time.Time            `json:"completedAt,omitempty"`
+}
+
+// PaymentFilter selects payments from the ledger; zero fields match everything
+type PaymentFilter struct {
+	Client   string
+	Resource string
+	Network  string
+	PayTo    string
+	Status   string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// matches reports whether a payment passes the filter
+func (f PaymentFilter) matches(p *Payment) bool {
+	switch {
+	case f.Client != "" && p.Client != f.Client:
+		return false
+	case f.Resource != "" && p.Resource != f.Resource:
+		return false
+	case f.Network != "" && p.Network != f.Network:
+		return false
+	case f.PayTo != "" && !strings.EqualFold(p.PayTo, f.PayTo):
+		return false
+	case f.Status != "" && p.Status != f.Status:
+		return false
+	case !f.From.IsZero() && p.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !p.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// PaymentLedger is the persistent record of outgoing payments
+// Every change is journaled as a full snapshot of the payment; the last snapshot wins on replay.
+type PaymentLedger struct {
+	mu       sync.Mutex
+	journal  *store.Journal
+	payments map[string]*Payment
+}
+
+// NewPaymentLedger opens the payment journal at path
+func NewPaymentLedger(path string) (*PaymentLedger, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &PaymentLedger{
+		journal:  journal,
+		payments: make(map[string]*Payment),
+	}
+
+	err = journal.Replay(func(data json.RawMessage) error {
+		var payment Payment
+		if err := json.Unmarshal(data, &payment); err != nil || payment.ID == "" {
+			return nil
+		}
+		l.payments[payment.ID] = &payment
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load buyer payment journal: %w", err)
+	}
+
+	// Keep one snapshot per payment; payments still pending were interrupted by a restart
+	records := make([]interface{}, 0, len(l.payments))
+	for _, payment := range l.sortedLocked() {
+		if payment.Status == PaymentPending {
+			payment.Status = PaymentUnknown
+		}
+		records = append(records, payment)
+	}
+	if err := journal.Rewrite(records); err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to compact buyer payment journal: %w", err)
+	}
+
+	log.Info().Int("payments", len(l.payments)).Str("path", path).Msg("Buyer payment ledger loaded")
+
+	return l, nil
+}
+
+// Record adds a payment that is about to be sent upstream
+func (l *PaymentLedger) Record(payment Payment) (*Payment, error) {
+	payment.ID = uuid.New().String()
+	payment.Time = time.Now().UTC()
+	payment.Status = PaymentPending
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.journal.Append(&payment); err != nil {
+		return nil, fmt.Errorf("failed to persist buyer payment: %w", err)
+	}
+	l.payments[payment.ID] = &payment
+
+	copied := payment
+	return &copied, nil
+}
+
+// Complete records the upstream outcome of a payment
+func (l *PaymentLedger) Complete(id, status string, upstreamStatus int, settlement *types.SettleResponse) (*Payment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	payment, exists := l.payments[id]
+	if !exists {
+		return nil, ErrPaymentNotFound
+	}
+
+	now := time.Now().UTC()
+	updated := *payment
+	updated.Status = status
+	updated.UpstreamStatus = upstreamStatus
+	updated.Settlement = settlement
+	updated.CompletedAt = &now
+
+	if err := l.journal.Append(&updated); err != nil {
+		return nil, fmt.Errorf("failed to persist buyer payment: %w", err)
+	}
+	*payment = updated
+
+	paymentsTotal.WithLabelValues(payment.Resource, payment.Network, status).Inc()
+	if usd, ok := new(big.Rat).SetString(payment.USD); ok {
+		value, _ := usd.Float64()
+		paymentsUSDTotal.WithLabelValues(payment.Resource, payment.Network, status).Add(value)
+	}
+
+	copied := updated
+	return &copied, nil
+}
+
+// Get returns a payment by ID
+func (l *PaymentLedger) Get(id string) (*Payment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	payment, exists := l.payments[id]
+	if !exists {
+		return nil, ErrPaymentNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+// List returns the payments matching a filter, newest first
+func (l *PaymentLedger) List(filter PaymentFilter) []*Payment {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sorted := l.sortedLocked()
+	payments := make([]*Payment, 0)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if !filter.matches(sorted[i]) {
+			continue
+		}
+		copied := *sorted[i]
+		payments = append(payments, &copied)
+		if filter.Limit > 0 && len(payments) >= filter.Limit {
+			break
+		}
+	}
+	return payments
+}
+
+// UsageRow is the spend of one client on one resource in one UTC day
+type UsageRow struct {
+	Day      string `json:"day"` // YYYY-MM-DD
+	Client   string `json:"client"`
+	Resource string `json:"resource"`
+	Payments int    `json:"payments"`
+	USD      string `json:"usd"`
+	Unpriced int    `json:"unpriced,omitempty"` // Payments without a known USD value
+
+	usd *big.Rat
+}
+
+// Usage aggregates the payments matching a filter by day, client and resource
+// Failed payments are not charged and are left out; the filter's Status and Limit are ignored
+func (l *PaymentLedger) Usage(filter PaymentFilter) []UsageRow {
+	filter.Status = ""
+	filter.Limit = 0
+
+	l.mu.Lock()
+	rows := make(map[[3]string]*UsageRow)
+	for _, payment := range l.payments {
+		if payment.Status == PaymentFailed || !filter.matches(payment) {
+			continue
+		}
+		key := [3]string{payment.Time.UTC().Format("2006-01-02"), payment.Client, payment.Resource}
+		row, exists := rows[key]
+		if !exists {
+			row = &UsageRow{Day: key[0], Client: key[1], Resource: key[2], usd: new(big.Rat)}
+			rows[key] = row
+		}
+		row.Payments++
+		if usd, ok := new(big.Rat).SetString(payment.USD); ok {
+			row.usd.Add(row.usd, usd)
+		} else {
+			row.Unpriced++
+		}
+	}
+	l.mu.Unlock()
+
+	usage := make([]UsageRow, 0, len(rows))
+	for _, row := range rows {
+		row.USD = pricing.FormatDecimal(row.usd)
+		usage = append(usage, *row)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Client != b.Client {
+			return a.Client < b.Client
+		}
+		return a.Resource < b.Resource
+	})
+	return usage
+}
+
+// Close closes the payment journal
+func (l *PaymentLedger) Close() error {
+	return l.journal.Close()
+}
+
+// sortedLocked returns the payments in time order; callers must hold l.mu
+func (l *PaymentLedger) sortedLocked() []*Payment {
+	payments := make([]*Payment, 0, len(l.payments))
+	for _, payment := range l.payments {
+		payments = append(payments, payment)
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].Time.Before(payments[j].Time)
+	})
+	return payments
+}
@@ -0,0 +1,73 @@
+package buyer
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/agent-guide/go-x402-facilitator/pkg/client"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Default validity window of a signed payment authorization
+const (
+	DefaultValidFor  = 5 * time.Minute
+	DefaultClockSkew = 30 * time.Second
+)
+
+// PaymentOffer is a payment option of a 402 response
+// It adds maxTimeoutSeconds, which types.PaymentRequirements does not carry
+type PaymentOffer struct {
+	types.PaymentRequirements
+	MaxTimeoutSeconds int64 `json:"maxTimeoutSeconds,omitempty"` // Longest validity the seller accepts, 0 if unspecified
+}
+
+// ValidityWindow bounds the time in which a signed authorization can be settled
+type ValidityWindow struct {
+	ValidFor  time.Duration // Lifetime of the authorization from the time it is signed
+	ClockSkew time.Duration // validAfter is backdated by this much to tolerate clock differences with the chain
+}
+
+// bounds returns validAfter and validBefore for an authorization signed at now
+// The lifetime is capped at the seller's maxTimeoutSeconds when it is present
+func (w ValidityWindow) bounds(now time.Time, maxTimeoutSeconds int64) (int64, int64) {
+	validFor := w.ValidFor
+	if validFor <= 0 {
+		validFor = DefaultValidFor
+	}
+	if maxTimeout := time.Duration(maxTimeoutSeconds) * time.Second; maxTimeout > 0 && maxTimeout < validFor {
+		validFor = maxTimeout
+	}
+	return now.Add(-w.ClockSkew).Unix(), now.Add(validFor).Unix()
+}
+
+// NewNonce returns a random 32-byte EIP-3009 nonce as 0x-prefixed hex
+func NewNonce() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hexutil.Encode(nonce), nil
+}
+
+// CreatePayment signs an EIP-3009 authorization for a payment offer
+func CreatePayment(offer *PaymentOffer, key *ecdsa.PrivateKey, chainID uint64, window ValidityWindow) (*types.PaymentPayload, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	validAfter, validBefore := window.bounds(time.Now(), offer.MaxTimeoutSeconds)
+
+	return client.CreatePaymentPayload(
+		&offer.PaymentRequirements,
+		key,
+		validAfter,
+		validBefore,
+		chainID,
+		nonce,
+	)
+}
@@ -0,0 +1,147 @@
+package buyer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/pricing"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+)
+
+// ErrPolicyViolation is returned when a payment request is not allowed by a buyer policy
+var ErrPolicyViolation = errors.New("payment rejected by buyer policy")
+
+// Budget windows
+const (
+	WindowHourly = "hourly"
+	WindowDaily  = "daily"
+)
+
+// windowDurations maps budget windows to their rolling duration
+var windowDurations = map[string]time.Duration{
+	WindowHourly: time.Hour,
+	WindowDaily:  24 * time.Hour,
+}
+
+// Policy is a parsed spending policy for outgoing x402 payments
+// Nil prices and empty lists mean no limit
+type Policy struct {
+	MaxPrice        *pricing.Price `json:"-"`
+	AllowedNetworks []string       `json:"allowedNetworks,omitempty"`
+	AllowedAssets   []string       `json:"allowedAssets,omitempty"`
+	AllowedPayTo    []string       `json:"allowedPayTo,omitempty"`
+	HourlyBudget    *pricing.Price `json:"-"`
+	DailyBudget     *pricing.Price `json:"-"`
+}
+
+// NewPolicy parses a policy from configuration
+func NewPolicy(cfg config.BuyerPolicyConfig) (*Policy, error) {
+	policy := &Policy{
+		AllowedNetworks: normalizeList(cfg.AllowedNetworks),
+		AllowedAssets:   normalizeList(cfg.AllowedAssets),
+		AllowedPayTo:    normalizeList(cfg.AllowedPayTo),
+	}
+
+	var err error
+	if policy.MaxPrice, err = parseOptionalPrice("max_price", cfg.MaxPrice); err != nil {
+		return nil, err
+	}
+	if policy.HourlyBudget, err = parseOptionalPrice("hourly_budget", cfg.HourlyBudget); err != nil {
+		return nil, err
+	}
+	if policy.DailyBudget, err = parseOptionalPrice("daily_budget", cfg.DailyBudget); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// NeedsUSDValue reports whether the policy needs the USD value of a payment to be evaluated
+func (p *Policy) NeedsUSDValue() bool {
+	return p.MaxPrice != nil || p.HourlyBudget != nil || p.DailyBudget != nil
+}
+
+// Budget returns the budget of a window, or nil if the window is unlimited
+func (p *Policy) Budget(window string) *pricing.Price {
+	switch window {
+	case WindowHourly:
+		return p.HourlyBudget
+	case WindowDaily:
+		return p.DailyBudget
+	}
+	return nil
+}
+
+// Check checks the recipient, network, asset and price of a payment request
+// symbol is the token symbol of the network; usd is the USD value of the payment (nil if unknown)
+func (p *Policy) Check(requirements *types.PaymentRequirements, symbol string, usd *big.Rat, rates *pricing.RateTable) error {
+	if !allowed(p.AllowedNetworks, requirements.Network) {
+		return fmt.Errorf("%w: network %s is not allowed", ErrPolicyViolation, requirements.Network)
+	}
+	if !allowed(p.AllowedAssets, requirements.Asset) && !allowed(p.AllowedAssets, symbol) {
+		return fmt.Errorf("%w: asset %s (%s) is not allowed", ErrPolicyViolation, requirements.Asset, symbol)
+	}
+	if !allowed(p.AllowedPayTo, requirements.PayTo) {
+		return fmt.Errorf("%w: recipient %s is not allowed", ErrPolicyViolation, requirements.PayTo)
+	}
+
+	if p.MaxPrice != nil {
+		if usd == nil {
+			return fmt.Errorf("%w: the USD value of the payment is unknown", ErrPolicyViolation)
+		}
+		limit, err := rates.PriceToUSD(p.MaxPrice)
+		if err != nil {
+			return fmt.Errorf("%w: max price: %s", ErrPolicyViolation, err.Error())
+		}
+		if usd.Cmp(limit) > 0 {
+			return fmt.Errorf(
+				"%w: price $%s exceeds the maximum of %s",
+				ErrPolicyViolation, pricing.FormatDecimal(usd), p.MaxPrice.String(),
+			)
+		}
+	}
+
+	return nil
+}
+
+// parseOptionalPrice parses a price setting, returning nil for an empty value
+func parseOptionalPrice(name, value string) (*pricing.Price, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	price, err := pricing.ParsePrice(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return price, nil
+}
+
+// normalizeList lower-cases and trims list entries, dropping empty ones
+func normalizeList(values []string) []string {
+	var normalized []string
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" {
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized
+}
+
+// allowed reports whether value is in the allowlist; an empty allowlist allows everything
+func allowed(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	value = strings.ToLower(value)
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package buyer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNoWallet is returned when no buyer wallet is configured for a network
+var ErrNoWallet = errors.New("no buyer wallet configured")
+
+// Wallet is the hot wallet that signs outgoing payments on a network
+type Wallet struct {
+	Network string         `json:"network"`
+	Address common.Address `json:"address"`
+
+	key *ecdsa.PrivateKey
+}
+
+// PrivateKey returns the signing key of the wallet
+func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
+	return w.key
+}
+
+// Wallets holds the buyer wallets of all configured chain networks
+type Wallets struct {
+	networks []config.ChainNetwork
+	wallets  map[string]*Wallet // network name -> wallet
+}
+
+// NewWallets loads the buyer wallet keys
+// Networks without a dedicated wallet use the default buyer key, if any.
+// Keys equal to the facilitator key are rejected so spending and gas wallets stay separate.
+func NewWallets(cfg config.BuyerConfig, facilitatorCfg config.FacilitatorConfig) (*Wallets, error) {
+	var facilitatorAddress common.Address
+	if key, err := parsePrivateKey(facilitatorCfg.PrivateKey); err == nil {
+		facilitatorAddress = crypto.PubkeyToAddress(key.PublicKey)
+	}
+
+	defaultKey, err := loadPrivateKey(cfg.PrivateKey, cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("buyer wallet: %w", err)
+	}
+
+	overrides := make(map[string]*ecdsa.PrivateKey)
+	for _, walletCfg := range cfg.Wallets {
+		key, err := loadPrivateKey(walletCfg.PrivateKey, walletCfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("buyer wallet %s: %w", walletCfg.Network, err)
+		}
+		overrides[walletCfg.Network] = key
+	}
+
+	w := &Wallets{
+		networks: facilitatorCfg.ChainNetworks,
+		wallets:  make(map[string]*Wallet),
+	}
+	for _, network := range facilitatorCfg.ChainNetworks {
+		key := defaultKey
+		if override, exists := overrides[network.Name]; exists {
+			key = override
+		}
+		if key == nil {
+			continue
+		}
+
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if address == facilitatorAddress {
+			return nil, fmt.Errorf("buyer wallet %s: must not use the facilitator key", network.Name)
+		}
+		w.wallets[network.Name] = &Wallet{Network: network.Name, Address: address, key: key}
+	}
+
+	if len(w.wallets) == 0 {
+		log.Warn().Msg("No buyer wallet configured, x402-buyer resources cannot pay")
+	}
+
+	return w, nil
+}
+
+// ForNetwork returns the wallet used to pay on a network
+func (w *Wallets) ForNetwork(network string) (*Wallet, error) {
+	wallet, exists := w.wallets[network]
+	if !exists {
+		return nil, fmt.Errorf("%w for network %s", ErrNoWallet, network)
+	}
+	return wallet, nil
+}
+
+// List returns the configured wallets in chain network order
+func (w *Wallets) List() []*Wallet {
+	var wallets []*Wallet
+	for _, network := range w.networks {
+		if wallet, exists := w.wallets[network.Name]; exists {
+			wallets = append(wallets, wallet)
+		}
+	}
+	return wallets
+}
+
+// TokenBalance returns the balance of the network token held by a wallet, in base units
+func (w *Wallets) TokenBalance(ctx context.Context, wallet *Wallet) (*big.Int, error) {
+	var network *config.ChainNetwork
+	for i := range w.networks {
+		if w.networks[i].Name == wallet.Network {
+			network = &w.networks[i]
+			break
+		}
+	}
+	if network == nil {
+		return nil, fmt.Errorf("chain network %s not found in configuration", wallet.Network)
+	}
+
+	return TokenBalance(ctx, network, wallet.Address)
+}
+
+// loadPrivateKey loads a key given inline or in a file; it returns nil if neither is set
+func loadPrivateKey(inline, file string) (*ecdsa.PrivateKey, error) {
+	if inline != "" && file != "" {
+		return nil, fmt.Errorf("private_key and private_key_file are mutually exclusive")
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		inline = string(data)
+	}
+	if inline == "" {
+		return nil, nil
+	}
+	return parsePrivateKey(inline)
+}
+
+// parsePrivateKey parses a hex private key, with or without 0x prefix
+func parsePrivateKey(hexKey string) (*ecdsa.PrivateKey, error) {
+	hexKey = strings.TrimPrefix(strings.TrimSpace(hexKey), "0x")
+	key, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return key, nil
+}
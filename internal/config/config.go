@@ -1,7 +1,11 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,30 +18,69 @@ type Config struct {
 	AdminServer   AdminServerConfig   `mapstructure:"admin_server"`
 	Resources     []EndpointConfig    `mapstructure:"resources"`
 	Facilitator   FacilitatorConfig   `mapstructure:"facilitator"`
+	Pricing       PricingConfig       `mapstructure:"pricing"`
+	Storage       StorageConfig       `mapstructure:"storage"`
+	Seller        SellerConfig        `mapstructure:"seller"`
+	Credits       CreditsConfig       `mapstructure:"credits"`
+	Passes        PassesConfig        `mapstructure:"passes"`
+	WalletAuth    WalletAuthConfig    `mapstructure:"wallet_auth"`
+	RateLimit     RateLimitConfig     `mapstructure:"rate_limit"`
+	IPFilter      IPFilterConfig      `mapstructure:"ip_filter"`
+	BruteForce    BruteForceConfig    `mapstructure:"brute_force"`
+	Buyer         BuyerConfig         `mapstructure:"buyer"`
+	ForwardProxy  ForwardProxyConfig  `mapstructure:"forward_proxy"`
 }
 
 // GatewayServerConfig represents gateway HTTP server configuration
 type GatewayServerConfig struct {
-	Host         string        `mapstructure:"host"`
-	Port         int           `mapstructure:"port"`
-	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout time.Duration `mapstructure:"write_timeout"`
-	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	Host            string        `mapstructure:"host"`
+	Port            int           `mapstructure:"port"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+	TrustedProxies  []string      `mapstructure:"trusted_proxies"`   // CIDRs of proxies whose client IP headers are trusted; empty trusts none
+	ClientIPHeaders []string      `mapstructure:"client_ip_headers"` // Headers carrying the client IP, read when the peer is a trusted proxy
+	TLS             TLSConfig     `mapstructure:"tls"`
 }
 
 // AdminServerConfig represents admin HTTP server configuration
 type AdminServerConfig struct {
-	Host           string        `mapstructure:"host"`
-	Port           int           `mapstructure:"port"`
-	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
-	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
-	MetricsEnabled bool          `mapstructure:"metrics_enabled"`
-	LogLevel       string        `mapstructure:"log_level"`
-	LogFormat      string        `mapstructure:"log_format"`
-	AuthEnabled    bool          `mapstructure:"auth_enabled"`
-	AuthType       string        `mapstructure:"auth_type"`
-	AuthTokens     []string      `mapstructure:"auth_tokens"`
+	Host            string            `mapstructure:"host"`
+	Port            int               `mapstructure:"port"`
+	ReadTimeout     time.Duration     `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration     `mapstructure:"write_timeout"`
+	IdleTimeout     time.Duration     `mapstructure:"idle_timeout"`
+	MetricsEnabled  bool              `mapstructure:"metrics_enabled"`
+	LogLevel        string            `mapstructure:"log_level"`
+	LogFormat       string            `mapstructure:"log_format"`
+	AuthEnabled     bool              `mapstructure:"auth_enabled"`
+	AuthType        string            `mapstructure:"auth_type"`
+	AuthTokens      []string          `mapstructure:"auth_tokens"`       // Tokens with the admin role
+	AuthUsers       []AdminUserConfig `mapstructure:"auth_users"`        // Tokens or users with a role and expiry
+	TrustedProxies  []string          `mapstructure:"trusted_proxies"`   // CIDRs of proxies whose client IP headers are trusted; empty trusts none
+	ClientIPHeaders []string          `mapstructure:"client_ip_headers"` // Headers carrying the client IP, read when the peer is a trusted proxy
+	TLS             TLSConfig         `mapstructure:"tls"`
+}
+
+// TLSConfig represents TLS termination of a server listener
+// The certificate, key and client CA bundle are reloaded when they change on disk.
+type TLSConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	CertFile       string        `mapstructure:"cert_file"`       // PEM certificate chain, leaf first
+	KeyFile        string        `mapstructure:"key_file"`        // PEM private key
+	MinVersion     string        `mapstructure:"min_version"`     // "1.2" or "1.3"
+	CipherSuites   []string      `mapstructure:"cipher_suites"`   // TLS 1.2 cipher suite names; empty uses Go's secure defaults
+	ClientCAFile   string        `mapstructure:"client_ca_file"`  // PEM CA bundle; enables client certificate verification (mTLS)
+	ClientAuth     string        `mapstructure:"client_auth"`     // With client_ca_file: "require" or "optional"
+	ReloadInterval time.Duration `mapstructure:"reload_interval"` // How often the files are checked for changes
+}
+
+// AdminUserConfig represents an admin API identity bound to a role
+type AdminUserConfig struct {
+	Name      string `mapstructure:"name"`
+	Role      string `mapstructure:"role"`       // viewer, operator or admin
+	Token     string `mapstructure:"token"`      // Credential for auth_type: the token, API key or "username:password"
+	ExpiresAt string `mapstructure:"expires_at"` // RFC 3339, empty for no expiry
 }
 
 // ChainNetwork represents a blockchain network configuration
@@ -50,6 +93,15 @@ type ChainNetwork struct {
 	TokenVersion  string `mapstructure:"token_version"`
 	TokenDecimals int64  `mapstructure:"token_decimals"`
 	TokenType     string `mapstructure:"token_type"`
+	TokenSymbol   string `mapstructure:"token_symbol"`
+}
+
+// Symbol returns the token symbol used for pricing, falling back to the token name
+func (n *ChainNetwork) Symbol() string {
+	if n.TokenSymbol != "" {
+		return strings.ToUpper(n.TokenSymbol)
+	}
+	return strings.ToUpper(n.TokenName)
 }
 
 // FacilitatorConfig represents X402 facilitator configuration
@@ -63,11 +115,206 @@ type FacilitatorConfig struct {
 	ChainNetworks     []ChainNetwork `mapstructure:"chain_networks"`
 }
 
+// PricingConfig represents the static exchange rate table used to convert human prices
+type PricingConfig struct {
+	Rates     map[string]string `mapstructure:"rates"`      // Token symbol -> USD price of one whole token
+	USDPegged []string          `mapstructure:"usd_pegged"` // Token symbols priced at 1 USD
+}
+
+// StorageConfig represents local persistent storage configuration
+type StorageConfig struct {
+	DataDir string `mapstructure:"data_dir"` // Directory for embedded state files (nonces, journals, ledgers)
+}
+
+// Path returns the path of a state file inside the data directory
+func (c *StorageConfig) Path(name string) string {
+	return filepath.Join(c.DataDir, name)
+}
+
+// SellerConfig represents seller-side payment processing configuration
+type SellerConfig struct {
+	Settlement SettlementConfig `mapstructure:"settlement"`
+}
+
+// SettlementConfig represents how verified payments are settled on-chain
+type SettlementConfig struct {
+	Mode               string        `mapstructure:"mode"`                // "sync" settles in the request path, "async" queues settlement
+	Workers            int           `mapstructure:"workers"`             // Number of settlement workers
+	NetworkConcurrency int           `mapstructure:"network_concurrency"` // Max in-flight settlements per network
+	MaxAttempts        int           `mapstructure:"max_attempts"`        // Attempts before an item is marked failed
+	InitialBackoff     time.Duration `mapstructure:"initial_backoff"`     // Delay before the first retry
+	MaxBackoff         time.Duration `mapstructure:"max_backoff"`         // Upper bound for the retry delay
+	Timeout            time.Duration `mapstructure:"timeout"`             // Timeout of a single settlement attempt
+	Retention          time.Duration `mapstructure:"retention"`           // How long settled and abandoned items stay listed
+}
+
+// CreditsConfig represents the prepaid credits configuration
+type CreditsConfig struct {
+	TopupResource string `mapstructure:"topup_resource"` // Resource with billing "topup" that low-balance 402s point at
+}
+
+// PassesConfig represents the configuration of time-based access passes
+type PassesConfig struct {
+	SigningKey      string        `mapstructure:"signing_key"`      // HMAC key for pass tokens (at least 32 bytes)
+	DefaultDuration time.Duration `mapstructure:"default_duration"` // Lifetime of a pass when the resource sets none
+}
+
+// WalletAuthConfig represents wallet-signature authentication for resources with auth type "wallet"
+type WalletAuthConfig struct {
+	Domain          string        `mapstructure:"domain"`            // Domain expected in sign-in messages; required by wallet and token-gate resources
+	ChainIDs        []uint64      `mapstructure:"chain_ids"`         // Chain IDs accepted in sign-in messages; empty accepts any
+	ChallengeTTL    time.Duration `mapstructure:"challenge_ttl"`     // How long a sign-in nonce can be used
+	SessionTTL      time.Duration `mapstructure:"session_ttl"`       // Lifetime of a session token
+	SessionKey      string        `mapstructure:"session_key"`       // HMAC key for session tokens (at least 32 bytes)
+	SignatureMaxAge time.Duration `mapstructure:"signature_max_age"` // How old a signed request may be
+}
+
+// RateLimitConfig represents the storage of resource rate limits and quotas, and the concurrency limits of upstreams
+type RateLimitConfig struct {
+	QuotaStore string                `mapstructure:"quota_store"` // "memory" (default) or "journal" to keep quota usage across restarts
+	Upstreams  []UpstreamLimitConfig `mapstructure:"upstreams"`   // Concurrency limits shared by all requests to an upstream host
+}
+
+// UpstreamLimitConfig represents the concurrency limit of an upstream target
+type UpstreamLimitConfig struct {
+	Target       string        `mapstructure:"target"`        // Host (and port) of resource target URLs, e.g. "api.example.com"
+	MaxInFlight  int           `mapstructure:"max_in_flight"` // Requests proxied to the target at once
+	MaxQueue     int           `mapstructure:"max_queue"`     // Requests that may wait for a slot; more are shed
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"` // How long a request may wait before it is shed (default: 5s)
+}
+
+// IPFilterConfig represents the CIDR allow and deny lists of the gateway and admin servers
+// Deny entries win; an empty allow list allows every address that is not denied.
+type IPFilterConfig struct {
+	Allow          []string      `mapstructure:"allow"`           // Gateway-wide allow list
+	Deny           []string      `mapstructure:"deny"`            // Gateway-wide deny list
+	AdminAllow     []string      `mapstructure:"admin_allow"`     // Admin server allow list
+	AdminDeny      []string      `mapstructure:"admin_deny"`      // Admin server deny list
+	File           string        `mapstructure:"file"`            // Optional YAML or JSON file with more lists, reloaded when it changes
+	ReloadInterval time.Duration `mapstructure:"reload_interval"` // How often the file is checked for changes
+}
+
+// BruteForceConfig represents the delays and lockouts applied after failed authentication
+// Failures are counted by client IP and by the prefix of the presented credential.
+type BruteForceConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Window           time.Duration `mapstructure:"window"`            // Failures older than this are forgotten
+	DelayAfter       int           `mapstructure:"delay_after"`       // Failures before responses are delayed; 0 disables delays
+	Delay            time.Duration `mapstructure:"delay"`             // First delay, doubled with each further failure
+	MaxDelay         time.Duration `mapstructure:"max_delay"`         // Upper bound for the delay
+	LockoutAfter     int           `mapstructure:"lockout_after"`     // Failures that lock the IP or credential; 0 disables lockouts
+	LockoutDuration  time.Duration `mapstructure:"lockout_duration"`  // How long a lockout lasts
+	CredentialPrefix int           `mapstructure:"credential_prefix"` // Leading characters of a credential failures are counted by
+}
+
+// BuyerConfig represents buyer-side payment configuration
+// Buyer payments are signed with dedicated wallets, never with the facilitator key
+type BuyerConfig struct {
+	PrivateKey     string              `mapstructure:"private_key"`      // Default buyer wallet key (hex)
+	PrivateKeyFile string              `mapstructure:"private_key_file"` // File holding the default buyer wallet key
+	Wallets        []BuyerWalletConfig `mapstructure:"wallets"`          // Per-network wallets overriding the default
+	Policy         BuyerPolicyConfig   `mapstructure:"policy"`           // Global policy applied to every resource with x402-buyer
+	Replay         ReplayConfig        `mapstructure:"replay"`           // Request buffering for the paid retry after a 402
+	Selection      SelectionConfig     `mapstructure:"selection"`        // How to choose among the payment options of a 402
+	Authorization  AuthorizationConfig `mapstructure:"authorization"`    // Validity window of signed payment authorizations
+	Approval       ApprovalConfig      `mapstructure:"approval"`         // Human approval of large payments
+	Balance        BalanceConfig       `mapstructure:"balance"`          // Polling of buyer and facilitator wallet balances
+	ClientHeader   string              `mapstructure:"client_header"`    // Trusted header naming the calling client, e.g. "X-Client-ID"
+	ClientSources  []string            `mapstructure:"client_sources"`   // CIDRs or IPs whose client header is trusted; required with client_header
+	Clients        []BuyerClientConfig `mapstructure:"clients"`          // Internal clients that buyer payments are charged to
+	DefaultClient  BuyerPolicyConfig   `mapstructure:"default_client"`   // Policy of clients not listed in clients, including anonymous
+}
+
+// BuyerClientConfig represents an internal client whose buyer payments are allocated to it
+// A request belongs to the client whose API key (X-API-Key) or bearer token it carries,
+// or whose name is in the client header
+type BuyerClientConfig struct {
+	Name         string            `mapstructure:"name"`
+	APIKeys      []string          `mapstructure:"api_keys"`
+	BearerTokens []string          `mapstructure:"bearer_tokens"`
+	Policy       BuyerPolicyConfig `mapstructure:"policy"` // Client budgets and limits, applied on top of the global and resource policies
+}
+
+// BalanceConfig represents the polling of buyer and facilitator token balances
+type BalanceConfig struct {
+	PollInterval  time.Duration `mapstructure:"poll_interval"`  // How often balances are read; 0 disables tracking
+	Floor         string        `mapstructure:"floor"`          // Human price below which a wallet is low, e.g. "$5.00"; empty disables alerts
+	WebhookURL    string        `mapstructure:"webhook_url"`    // Optional URL notified when a wallet drops below the floor
+	WebhookSecret string        `mapstructure:"webhook_secret"` // HMAC-SHA256 key signing webhook bodies
+}
+
+// ApprovalConfig represents human-in-the-loop approval of large buyer payments
+type ApprovalConfig struct {
+	Threshold     string        `mapstructure:"threshold"`      // Payments above this human price wait for approval; empty disables approval
+	Timeout       time.Duration `mapstructure:"timeout"`        // How long a parked request waits for a decision
+	WebhookURL    string        `mapstructure:"webhook_url"`    // Optional URL notified of each pending approval
+	WebhookSecret string        `mapstructure:"webhook_secret"` // HMAC-SHA256 key signing webhook bodies
+}
+
+// AuthorizationConfig represents the validity window of the EIP-3009 authorizations signed by the buyer
+type AuthorizationConfig struct {
+	ValidFor  time.Duration `mapstructure:"valid_for"`  // Lifetime of an authorization, capped at the seller's maxTimeoutSeconds
+	ClockSkew time.Duration `mapstructure:"clock_skew"` // How far validAfter is backdated to tolerate clock differences
+}
+
+// SelectionConfig represents how the buyer chooses among the accepted payment options of a 402 response
+type SelectionConfig struct {
+	Strategy          string   `mapstructure:"strategy"`           // "cheapest", "preferred" or "balance"
+	PreferredNetworks []string `mapstructure:"preferred_networks"` // Network order for the "preferred" strategy
+}
+
+// ReplayConfig represents how request bodies are buffered so they can be replayed after a 402
+type ReplayConfig struct {
+	MemoryLimit int64  `mapstructure:"memory_limit"` // Bytes kept in memory before spilling to a temp file
+	MaxBody     int64  `mapstructure:"max_body"`     // Largest replayable body in bytes; larger requests are never paid
+	TempDir     string `mapstructure:"temp_dir"`     // Directory for spilled bodies (default: system temp dir)
+}
+
+// BuyerWalletConfig represents the buyer wallet of a single network
+type BuyerWalletConfig struct {
+	Network        string `mapstructure:"network"`
+	PrivateKey     string `mapstructure:"private_key"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+}
+
+// BuyerPolicyConfig represents a spending policy for outgoing x402 payments
+// Prices and budgets are human prices such as "$0.50" or "0.50 USDC"; empty values mean no limit
+type BuyerPolicyConfig struct {
+	MaxPrice        string   `mapstructure:"max_price"`        // Maximum price of a single payment
+	AllowedNetworks []string `mapstructure:"allowed_networks"` // Networks payments may be made on
+	AllowedAssets   []string `mapstructure:"allowed_assets"`   // Token addresses or symbols payments may be made in
+	AllowedPayTo    []string `mapstructure:"allowed_payto"`    // Recipient addresses payments may be made to
+	HourlyBudget    string   `mapstructure:"hourly_budget"`    // Spend limit over a rolling hour
+	DailyBudget     string   `mapstructure:"daily_budget"`     // Spend limit over a rolling 24 hours
+}
+
+// ForwardProxyConfig represents the optional forward-proxy listener
+// Agents send requests for arbitrary x402 URLs; upstream 402 responses are paid under the buyer policies
+type ForwardProxyConfig struct {
+	Enabled      bool               `mapstructure:"enabled"`
+	Host         string             `mapstructure:"host"`
+	Port         int                `mapstructure:"port"`
+	ReadTimeout  time.Duration      `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration      `mapstructure:"write_timeout"`
+	IdleTimeout  time.Duration      `mapstructure:"idle_timeout"`
+	Agents       []ProxyAgentConfig `mapstructure:"agents"`
+}
+
+// ProxyAgentConfig represents an agent allowed to use the forward proxy
+type ProxyAgentConfig struct {
+	Name                string            `mapstructure:"name"`
+	APIKey              string            `mapstructure:"api_key"`
+	AllowedDestinations []string          `mapstructure:"allowed_destinations"` // Hosts, "*.domain" wildcards or URL prefixes
+	Policy              BuyerPolicyConfig `mapstructure:"policy"`               // Spending policy of the agent, on top of buyer.policy
+}
+
 // EndpointConfig represents an endpoint configuration
 type EndpointConfig struct {
 	Endpoint    string                   `mapstructure:"endpoint"`
 	Description string                   `mapstructure:"description"`
 	Type        string                   `mapstructure:"type"`
+	Billing     string                   `mapstructure:"billing"`     // "" (per-request x402), "credits" or "topup"
+	Group       string                   `mapstructure:"group"`       // Resource group, used by consumer key scopes
 	Middlewares []map[string]interface{} `mapstructure:"middlewares"` // Array of middleware config objects
 	TargetURL   string                   `mapstructure:"targetUrl"`
 }
@@ -125,6 +372,18 @@ func setDefaults() {
 	viper.SetDefault("gateway_server.read_timeout", "30s")
 	viper.SetDefault("gateway_server.write_timeout", "30s")
 	viper.SetDefault("gateway_server.idle_timeout", "120s")
+	viper.SetDefault("gateway_server.trusted_proxies", []string{})
+	viper.SetDefault("gateway_server.client_ip_headers", []string{"X-Forwarded-For", "X-Real-IP"})
+	setTLSDefaults("gateway_server")
+
+	// Forward proxy defaults
+	viper.SetDefault("forward_proxy.enabled", false)
+	viper.SetDefault("forward_proxy.host", "127.0.0.1")
+	viper.SetDefault("forward_proxy.port", 8082)
+	viper.SetDefault("forward_proxy.read_timeout", "30s")
+	viper.SetDefault("forward_proxy.write_timeout", "60s")
+	viper.SetDefault("forward_proxy.idle_timeout", "120s")
+	viper.SetDefault("forward_proxy.agents", []ProxyAgentConfig{})
 
 	// Admin server defaults
 	viper.SetDefault("admin_server.host", "0.0.0.0")
@@ -138,6 +397,9 @@ func setDefaults() {
 	viper.SetDefault("admin_server.auth_enabled", true)
 	viper.SetDefault("admin_server.auth_type", "bearer")
 	viper.SetDefault("admin_server.auth_tokens", []string{})
+	viper.SetDefault("admin_server.trusted_proxies", []string{})
+	viper.SetDefault("admin_server.client_ip_headers", []string{"X-Forwarded-For", "X-Real-IP"})
+	setTLSDefaults("admin_server")
 
 	// Facilitator defaults
 	viper.SetDefault("facilitator.private_key", "")
@@ -147,6 +409,91 @@ func setDefaults() {
 	viper.SetDefault("facilitator.supported_schemes", []string{"exact"})
 	viper.SetDefault("facilitator.supported_networks", []string{})
 	viper.SetDefault("facilitator.chain_networks", []ChainNetwork{})
+
+	// Pricing defaults
+	viper.SetDefault("pricing.rates", map[string]string{})
+	viper.SetDefault("pricing.usd_pegged", []string{"USDC", "USDT", "DAI"})
+
+	// Storage defaults
+	viper.SetDefault("storage.data_dir", "./data")
+
+	// Seller defaults
+	viper.SetDefault("seller.settlement.mode", "sync")
+	viper.SetDefault("seller.settlement.workers", 4)
+	viper.SetDefault("seller.settlement.network_concurrency", 2)
+	viper.SetDefault("seller.settlement.max_attempts", 8)
+	viper.SetDefault("seller.settlement.initial_backoff", "5s")
+	viper.SetDefault("seller.settlement.max_backoff", "10m")
+	viper.SetDefault("seller.settlement.timeout", "2m")
+	viper.SetDefault("seller.settlement.retention", "24h")
+
+	// Credits defaults
+	viper.SetDefault("credits.topup_resource", "/credits/topup")
+
+	// Access pass defaults
+	viper.SetDefault("passes.signing_key", "")
+	viper.SetDefault("passes.default_duration", "24h")
+
+	// Wallet authentication defaults
+	viper.SetDefault("wallet_auth.domain", "")
+	viper.SetDefault("wallet_auth.chain_ids", []uint64{})
+	viper.SetDefault("wallet_auth.challenge_ttl", "5m")
+	viper.SetDefault("wallet_auth.session_ttl", "1h")
+	viper.SetDefault("wallet_auth.session_key", "")
+	viper.SetDefault("wallet_auth.signature_max_age", "5m")
+
+	// Rate limit defaults
+	viper.SetDefault("rate_limit.quota_store", "memory")
+
+	// IP filter defaults
+	viper.SetDefault("ip_filter.reload_interval", "10s")
+
+	// Brute-force protection defaults
+	viper.SetDefault("brute_force.enabled", true)
+	viper.SetDefault("brute_force.window", "15m")
+	viper.SetDefault("brute_force.delay_after", 3)
+	viper.SetDefault("brute_force.delay", "250ms")
+	viper.SetDefault("brute_force.max_delay", "5s")
+	viper.SetDefault("brute_force.lockout_after", 10)
+	viper.SetDefault("brute_force.lockout_duration", "15m")
+	viper.SetDefault("brute_force.credential_prefix", 8)
+
+	// Buyer defaults
+	viper.SetDefault("buyer.private_key", "")
+	viper.SetDefault("buyer.private_key_file", "")
+	viper.SetDefault("buyer.wallets", []BuyerWalletConfig{})
+	viper.SetDefault("buyer.replay.memory_limit", 1<<20)
+	viper.SetDefault("buyer.replay.max_body", 32<<20)
+	viper.SetDefault("buyer.replay.temp_dir", "")
+	viper.SetDefault("buyer.selection.strategy", "cheapest")
+	viper.SetDefault("buyer.selection.preferred_networks", []string{})
+	viper.SetDefault("buyer.authorization.valid_for", "5m")
+	viper.SetDefault("buyer.authorization.clock_skew", "30s")
+	viper.SetDefault("buyer.approval.threshold", "")
+	viper.SetDefault("buyer.approval.timeout", "25s")
+	viper.SetDefault("buyer.approval.webhook_url", "")
+	viper.SetDefault("buyer.approval.webhook_secret", "")
+	viper.SetDefault("buyer.balance.poll_interval", "1m")
+	viper.SetDefault("buyer.balance.floor", "")
+	viper.SetDefault("buyer.balance.webhook_url", "")
+	viper.SetDefault("buyer.balance.webhook_secret", "")
+	viper.SetDefault("buyer.client_header", "")
+	viper.SetDefault("buyer.client_sources", []string{})
+	viper.SetDefault("buyer.policy.max_price", "")
+	viper.SetDefault("buyer.policy.allowed_networks", []string{})
+	viper.SetDefault("buyer.policy.allowed_assets", []string{})
+	viper.SetDefault("buyer.policy.allowed_payto", []string{})
+	viper.SetDefault("buyer.policy.hourly_budget", "")
+	viper.SetDefault("buyer.policy.daily_budget", "")
+}
+
+// setTLSDefaults sets the TLS defaults of a server section
+func setTLSDefaults(server string) {
+	viper.SetDefault(server+".tls.enabled", false)
+	viper.SetDefault(server+".tls.min_version", "1.2")
+	viper.SetDefault(server+".tls.cipher_suites", []string{})
+	viper.SetDefault(server+".tls.client_auth", "require")
+	viper.SetDefault(server+".tls.reload_interval", "10s")
 }
 
 // validateConfig validates the configuration
@@ -170,6 +517,125 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid admin server log level: %s", config.AdminServer.LogLevel)
 	}
 
+	// Validate storage configuration
+	if config.Storage.DataDir == "" {
+		return fmt.Errorf("storage data_dir is required")
+	}
+
+	// Validate seller settlement configuration
+	settlement := config.Seller.Settlement
+	if settlement.Mode != "sync" && settlement.Mode != "async" {
+		return fmt.Errorf("invalid seller settlement mode: %s (valid modes: sync, async)", settlement.Mode)
+	}
+	if settlement.Workers <= 0 || settlement.NetworkConcurrency <= 0 || settlement.MaxAttempts <= 0 {
+		return fmt.Errorf("seller settlement workers, network_concurrency and max_attempts must be greater than 0")
+	}
+	if settlement.Retention < 0 {
+		return fmt.Errorf("seller settlement retention must not be negative")
+	}
+
+	// Validate access pass configuration
+	if config.Passes.DefaultDuration <= 0 {
+		return fmt.Errorf("passes default_duration must be greater than 0")
+	}
+
+	// Validate wallet authentication configuration
+	walletAuth := config.WalletAuth
+	if walletAuth.ChallengeTTL <= 0 || walletAuth.SessionTTL <= 0 || walletAuth.SignatureMaxAge <= 0 {
+		return fmt.Errorf("wallet_auth challenge_ttl, session_ttl and signature_max_age must be greater than 0")
+	}
+	if walletAuth.SessionKey != "" && len(walletAuth.SessionKey) < 32 {
+		return fmt.Errorf("wallet_auth session_key must be at least 32 bytes")
+	}
+	// Sign-in messages are bound to the configured domain, never to the Host header of the request
+	if walletAuth.Domain == "" {
+		for _, resource := range config.Resources {
+			if usesWalletAuth(resource) {
+				return fmt.Errorf("wallet_auth domain is required: resource %s authenticates wallets", resource.Endpoint)
+			}
+		}
+	}
+
+	// Validate rate limit configuration
+	if config.RateLimit.QuotaStore != "memory" && config.RateLimit.QuotaStore != "journal" {
+		return fmt.Errorf("invalid rate_limit quota_store: %s (valid stores: memory, journal)", config.RateLimit.QuotaStore)
+	}
+	upstreams := make(map[string]bool)
+	for _, upstream := range config.RateLimit.Upstreams {
+		if upstream.Target == "" {
+			return fmt.Errorf("rate_limit upstream target is required")
+		}
+		if upstreams[strings.ToLower(upstream.Target)] {
+			return fmt.Errorf("rate_limit upstream %s: duplicate target", upstream.Target)
+		}
+		upstreams[strings.ToLower(upstream.Target)] = true
+		if upstream.MaxInFlight <= 0 {
+			return fmt.Errorf("rate_limit upstream %s: max_in_flight must be greater than 0", upstream.Target)
+		}
+		if upstream.MaxQueue < 0 || upstream.QueueTimeout < 0 {
+			return fmt.Errorf("rate_limit upstream %s: max_queue and queue_timeout must not be negative", upstream.Target)
+		}
+	}
+
+	// Validate trusted proxies and IP filter lists
+	for name, proxies := range map[string][]string{
+		"gateway_server": config.GatewayServer.TrustedProxies,
+		"admin_server":   config.AdminServer.TrustedProxies,
+	} {
+		if err := validateCIDRs(proxies); err != nil {
+			return fmt.Errorf("invalid %s trusted_proxies: %w", name, err)
+		}
+	}
+	ipFilter := config.IPFilter
+	for name, entries := range map[string][]string{
+		"allow":       ipFilter.Allow,
+		"deny":        ipFilter.Deny,
+		"admin_allow": ipFilter.AdminAllow,
+		"admin_deny":  ipFilter.AdminDeny,
+	} {
+		if err := validateCIDRs(entries); err != nil {
+			return fmt.Errorf("invalid ip_filter %s: %w", name, err)
+		}
+	}
+	if ipFilter.ReloadInterval <= 0 {
+		return fmt.Errorf("ip_filter reload_interval must be greater than 0")
+	}
+
+	// Validate TLS configuration
+	for name, tlsConfig := range map[string]TLSConfig{
+		"gateway_server": config.GatewayServer.TLS,
+		"admin_server":   config.AdminServer.TLS,
+	} {
+		if err := validateTLS(tlsConfig); err != nil {
+			return fmt.Errorf("invalid %s tls: %w", name, err)
+		}
+	}
+
+	// Validate brute-force protection configuration
+	bruteForce := config.BruteForce
+	if bruteForce.Enabled {
+		if bruteForce.Window <= 0 || bruteForce.CredentialPrefix <= 0 {
+			return fmt.Errorf("brute_force window and credential_prefix must be greater than 0")
+		}
+		if bruteForce.DelayAfter < 0 || bruteForce.LockoutAfter < 0 {
+			return fmt.Errorf("brute_force delay_after and lockout_after must not be negative")
+		}
+		if bruteForce.DelayAfter > 0 && (bruteForce.Delay <= 0 || bruteForce.MaxDelay < bruteForce.Delay) {
+			return fmt.Errorf("brute_force delay must be greater than 0 and max_delay at least delay")
+		}
+		if bruteForce.LockoutAfter > 0 && bruteForce.LockoutDuration <= 0 {
+			return fmt.Errorf("brute_force lockout_duration must be greater than 0")
+		}
+	}
+
+	// Validate resource billing modes
+	validBillingModes := map[string]bool{"": true, "credits": true, "topup": true}
+	for _, resource := range config.Resources {
+		if !validBillingModes[resource.Billing] {
+			return fmt.Errorf("resource %s: invalid billing mode: %s (valid modes: credits, topup)", resource.Endpoint, resource.Billing)
+		}
+	}
+
 	// Validate facilitator configuration
 	if len(config.Facilitator.ChainNetworks) == 0 {
 		return fmt.Errorf("at least one chain network must be configured")
@@ -203,6 +669,109 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	// Validate buyer wallets
+	if config.Buyer.PrivateKey != "" && config.Buyer.PrivateKeyFile != "" {
+		return fmt.Errorf("buyer: private_key and private_key_file are mutually exclusive")
+	}
+	if config.Buyer.Replay.MemoryLimit < 0 || config.Buyer.Replay.MaxBody < config.Buyer.Replay.MemoryLimit {
+		return fmt.Errorf("buyer replay: memory_limit must be non-negative and not greater than max_body")
+	}
+	validStrategies := map[string]bool{"cheapest": true, "preferred": true, "balance": true}
+	if !validStrategies[config.Buyer.Selection.Strategy] {
+		return fmt.Errorf("invalid buyer selection strategy: %s (valid strategies: cheapest, preferred, balance)", config.Buyer.Selection.Strategy)
+	}
+	if config.Buyer.Selection.Strategy == "preferred" && len(config.Buyer.Selection.PreferredNetworks) == 0 {
+		return fmt.Errorf("buyer selection strategy preferred requires preferred_networks")
+	}
+	if config.Buyer.Authorization.ValidFor <= 0 || config.Buyer.Authorization.ClockSkew < 0 {
+		return fmt.Errorf("buyer authorization: valid_for must be positive and clock_skew must not be negative")
+	}
+	if config.Buyer.Approval.Threshold != "" {
+		if config.Buyer.Approval.Timeout <= 0 {
+			return fmt.Errorf("buyer approval timeout must be greater than 0")
+		}
+		// A parked request must be answered before the server gives up on writing the response
+		if wt := config.GatewayServer.WriteTimeout; wt > 0 && config.Buyer.Approval.Timeout >= wt {
+			return fmt.Errorf("buyer approval timeout must be shorter than gateway_server.write_timeout (%s)", wt)
+		}
+	}
+	if config.Buyer.Balance.PollInterval < 0 {
+		return fmt.Errorf("buyer balance poll_interval must not be negative")
+	}
+	if config.Buyer.ClientHeader != "" && len(config.Buyer.ClientSources) == 0 {
+		return fmt.Errorf("buyer client_sources is required with client_header")
+	}
+	if err := validateCIDRs(config.Buyer.ClientSources); err != nil {
+		return fmt.Errorf("invalid buyer client_sources: %w", err)
+	}
+	clientNames := make(map[string]bool)
+	clientCredentials := make(map[string]bool)
+	for i, client := range config.Buyer.Clients {
+		if client.Name == "" {
+			return fmt.Errorf("buyer client %d: name is required", i)
+		}
+		if clientNames[client.Name] {
+			return fmt.Errorf("buyer client %s: duplicate name", client.Name)
+		}
+		clientNames[client.Name] = true
+		for _, credential := range append(append([]string{}, client.APIKeys...), client.BearerTokens...) {
+			if credential == "" {
+				return fmt.Errorf("buyer client %s: empty API key or bearer token", client.Name)
+			}
+			if clientCredentials[credential] {
+				return fmt.Errorf("buyer client %s: API key or bearer token used by another client", client.Name)
+			}
+			clientCredentials[credential] = true
+		}
+	}
+	walletNetworks := make(map[string]bool)
+	for i, wallet := range config.Buyer.Wallets {
+		if !networkNames[wallet.Network] {
+			return fmt.Errorf("buyer wallet at index %d: unknown chain network %q", i, wallet.Network)
+		}
+		if walletNetworks[wallet.Network] {
+			return fmt.Errorf("duplicate buyer wallet for network: %s", wallet.Network)
+		}
+		walletNetworks[wallet.Network] = true
+
+		if (wallet.PrivateKey == "") == (wallet.PrivateKeyFile == "") {
+			return fmt.Errorf("buyer wallet %s: exactly one of private_key and private_key_file is required", wallet.Network)
+		}
+	}
+
+	// Validate forward proxy configuration
+	if config.ForwardProxy.Enabled {
+		if config.ForwardProxy.Port <= 0 || config.ForwardProxy.Port > 65535 {
+			return fmt.Errorf("invalid forward proxy port: %d", config.ForwardProxy.Port)
+		}
+		if len(config.ForwardProxy.Agents) == 0 {
+			return fmt.Errorf("forward proxy enabled but no agents configured")
+		}
+		agentNames := make(map[string]bool)
+		agentKeys := make(map[string]bool)
+		for i, agent := range config.ForwardProxy.Agents {
+			if agent.Name == "" {
+				return fmt.Errorf("forward proxy agent at index %d: name is required", i)
+			}
+			if agentNames[agent.Name] {
+				return fmt.Errorf("duplicate forward proxy agent name: %s", agent.Name)
+			}
+			agentNames[agent.Name] = true
+
+			if agent.APIKey == "" {
+				return fmt.Errorf("forward proxy agent %s: api_key is required", agent.Name)
+			}
+			if agentKeys[agent.APIKey] {
+				return fmt.Errorf("forward proxy agent %s: api_key is shared with another agent", agent.Name)
+			}
+			agentKeys[agent.APIKey] = true
+
+			if len(agent.AllowedDestinations) == 0 {
+				return fmt.Errorf("forward proxy agent %s: allowed_destinations is required", agent.Name)
+			}
+		}
+	}
+
 	// Validate admin server auth configuration
 	validAuthTypes := map[string]bool{
 		"bearer": true, "basic": true, "api_key": true,
@@ -211,14 +780,138 @@ func validateConfig(config *Config) error {
 		if !validAuthTypes[config.AdminServer.AuthType] {
 			return fmt.Errorf("invalid admin server auth type: %s (valid types: bearer, basic, api_key)", config.AdminServer.AuthType)
 		}
-		if len(config.AdminServer.AuthTokens) == 0 {
-			return fmt.Errorf("admin server authentication enabled but no auth tokens configured")
+		if len(config.AdminServer.AuthTokens) == 0 && len(config.AdminServer.AuthUsers) == 0 {
+			return fmt.Errorf("admin server authentication enabled but no auth tokens or users configured")
+		}
+	}
+	adminNames := make(map[string]bool)
+	adminCredentials := make(map[string]bool)
+	for _, token := range config.AdminServer.AuthTokens {
+		adminCredentials[token] = true
+	}
+	for i, user := range config.AdminServer.AuthUsers {
+		if user.Name == "" {
+			return fmt.Errorf("admin user %d: name is required", i)
+		}
+		if adminNames[user.Name] {
+			return fmt.Errorf("admin user %s: duplicate name", user.Name)
+		}
+		adminNames[user.Name] = true
+		switch user.Role {
+		case "viewer", "operator", "admin":
+		default:
+			return fmt.Errorf("admin user %s: invalid role %q (valid roles: viewer, operator, admin)", user.Name, user.Role)
+		}
+		if user.Token == "" {
+			return fmt.Errorf("admin user %s: token is required", user.Name)
+		}
+		if adminCredentials[user.Token] {
+			return fmt.Errorf("admin user %s: token is already used", user.Name)
+		}
+		adminCredentials[user.Token] = true
+		if user.ExpiresAt != "" {
+			if _, err := time.Parse(time.RFC3339, user.ExpiresAt); err != nil {
+				return fmt.Errorf("admin user %s: invalid expires_at: %w", user.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// usesWalletAuth reports whether a resource authenticates wallets, with auth type wallet or a token gate
+func usesWalletAuth(resource EndpointConfig) bool {
+	for _, mwMap := range resource.Middlewares {
+		if _, hasGate := mwMap["token-gate"]; hasGate {
+			return true
+		}
+		if authMap, ok := mwMap["auth"].(map[string]interface{}); ok && authMap["type"] == "wallet" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCIDRs checks that each entry is a CIDR or a single IP address
+func validateCIDRs(entries []string) error {
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("invalid CIDR %q", entry)
+			}
+		} else if net.ParseIP(entry) == nil {
+			return fmt.Errorf("invalid IP address %q", entry)
 		}
 	}
+	return nil
+}
 
+// validateTLS checks the settings of an enabled TLS listener
+// The files themselves are read when the server starts.
+func validateTLS(cfg TLSConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return fmt.Errorf("cert_file and key_file are required")
+	}
+	if _, err := ParseTLSVersion(cfg.MinVersion); err != nil {
+		return err
+	}
+	cipherSuites, err := ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return err
+	}
+	// HTTP/2 over TLS 1.2 needs one of these suites, and the server refuses to start without them
+	if cipherSuites != nil && cfg.MinVersion == "1.2" &&
+		!slices.Contains(cipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) &&
+		!slices.Contains(cipherSuites, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256) {
+		return fmt.Errorf("cipher_suites must include TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 for HTTP/2")
+	}
+	if cfg.ClientCAFile != "" && cfg.ClientAuth != "require" && cfg.ClientAuth != "optional" {
+		return fmt.Errorf("invalid client_auth %q (valid values: require, optional)", cfg.ClientAuth)
+	}
+	if cfg.ReloadInterval <= 0 {
+		return fmt.Errorf("reload_interval must be greater than 0")
+	}
 	return nil
 }
 
+// ParseTLSVersion converts a min_version setting into a crypto/tls version
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid min_version %q (valid versions: 1.2, 1.3)", version)
+	}
+}
+
+// ParseCipherSuites converts cipher suite names into crypto/tls IDs
+// Only suites Go considers secure are accepted. An empty list returns nil, which selects Go's defaults.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := secure[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // ToFacilitatorConfig converts gateway config to facilitator config
 func (c *FacilitatorConfig) ToFacilitatorConfig() map[string]interface{} {
 	return map[string]interface{}{
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 
+	"go-agent-guide/internal/seller"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
 	"github.com/gin-gonic/gin"
@@ -78,7 +80,10 @@ type AgentReverseProxy struct {
 	targetURL    *url.URL
 }
 
-func NewAgentReverseProxy(c *gin.Context, targetURL *url.URL) *AgentReverseProxy {
+// NewAgentReverseProxy creates a proxy of the request to targetURL
+// The part of the request path after resourcePath is appended to the target path. Virtual resources
+// whose name is not a path, such as the "proxy:<agent>" resources of the forward proxy, send the target path as is.
+func NewAgentReverseProxy(c *gin.Context, targetURL *url.URL, resourcePath string) *AgentReverseProxy {
 	// Create reverse proxy
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 
@@ -87,8 +92,8 @@ func NewAgentReverseProxy(c *gin.Context, targetURL *url.URL) *AgentReverseProxy
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
 
-		// req.URL.Path = c.Request.URL.Path
-		req.URL.Path = targetURL.Path
+		req.URL.Path = joinTargetPath(targetURL.Path, c.Request.URL.Path, resourcePath)
+		req.URL.RawPath = ""
 
 		// Preserve original raw query
 		req.URL.RawQuery = c.Request.URL.RawQuery
@@ -101,6 +106,10 @@ func NewAgentReverseProxy(c *gin.Context, targetURL *url.URL) *AgentReverseProxy
 				req.Header[key] = values
 			}
 		}
+
+		// Credits keys and access passes are only meaningful to the gateway, never forward them upstream
+		req.Header.Del(seller.CreditsKeyHeader)
+		req.Header.Del(seller.AccessPassHeader)
 	}
 
 	// Handle errors
@@ -122,6 +131,20 @@ func NewAgentReverseProxy(c *gin.Context, targetURL *url.URL) *AgentReverseProxy
 	}
 }
 
+// joinTargetPath appends the sub-path of requestPath below resourcePath to targetPath
+// e.g. target "/v1/data", resource "/api/data" and request "/api/data/items/1" give "/v1/data/items/1".
+// targetPath is returned unchanged if resourcePath is not a path or requestPath is not below it.
+func joinTargetPath(targetPath, requestPath, resourcePath string) string {
+	if !strings.HasPrefix(resourcePath, "/") || !pathHasPrefix(requestPath, resourcePath) {
+		return targetPath
+	}
+	subPath := strings.TrimPrefix(requestPath, strings.TrimSuffix(resourcePath, "/"))
+	if subPath == "" || (subPath == "/" && strings.HasSuffix(targetPath, "/")) {
+		return targetPath
+	}
+	return strings.TrimSuffix(targetPath, "/") + "/" + strings.TrimPrefix(subPath, "/")
+}
+
 func (p *AgentReverseProxy) AddInterceptor(interceptor InterceptorFunc) {
 	p.interceptors = append(p.interceptors, interceptor)
 }
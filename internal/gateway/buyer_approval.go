@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"math/big"
+	"net/url"
+
+	"go-agent-guide/internal/buyer"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// needsApproval reports whether a payment is above the approval threshold
+// Payments whose USD value is unknown always need approval when a threshold is set
+func (g *ResourceGateway) needsApproval(spend *buyer.Spend) bool {
+	if g.buyerApproval == nil {
+		return false
+	}
+
+	threshold, err := g.rates.PriceToUSD(g.buyerApproval)
+	if err != nil || spend.USD == "" {
+		return true
+	}
+	usd, ok := new(big.Rat).SetString(spend.USD)
+	return !ok || usd.Cmp(threshold) > 0
+}
+
+// awaitBuyerApproval parks a payment above the approval threshold until an operator decides
+// It returns nil if the payment may be signed
+func (g *ResourceGateway) awaitBuyerApproval(
+	c *gin.Context,
+	resource *ResourceConfig,
+	targetURL *url.URL,
+	requirements *types.PaymentRequirements,
+	spend *buyer.Spend,
+) error {
+	if !g.needsApproval(spend) {
+		return nil
+	}
+
+	upstream := *targetURL
+	upstream.RawQuery = c.Request.URL.RawQuery
+
+	_, err := g.buyerOptions.Approvals.Wait(c.Request.Context(), buyer.Approval{
+		Client:       buyerClientOf(c).Name,
+		Resource:     resource.Resource,
+		URL:          upstream.String(),
+		Requirements: *requirements,
+		USD:          spend.USD,
+	})
+	return err
+}
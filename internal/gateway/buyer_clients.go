@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"go-agent-guide/internal/buyer"
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/ipfilter"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnonymousClient is the client of buyer payments made for requests without a client identity
+const AnonymousClient = "anonymous"
+
+// buyerClientKey is the gin context key of the *BuyerClient of a request
+const buyerClientKey = "buyer_client"
+
+// BuyerClient is an internal client that buyer payments are charged to
+type BuyerClient struct {
+	Name   string        `json:"name"`
+	Policy *buyer.Policy `json:"policy,omitempty"` // Client budgets and limits; buyer.default_client for clients not configured
+}
+
+// buyerClients resolves the client identity of proxied requests
+type buyerClients struct {
+	header        string
+	sources       ipfilter.List // Client IPs whose client header is trusted
+	defaultPolicy *buyer.Policy // Policy of ad-hoc and anonymous clients
+	byName        map[string]*BuyerClient
+	apiKeys       map[[32]byte]*BuyerClient // sha256(API key) -> client
+	bearerTokens  map[[32]byte]*BuyerClient // sha256(bearer token) -> client
+}
+
+// newBuyerClients builds the client registry from configuration
+func newBuyerClients(cfg config.BuyerConfig) (*buyerClients, error) {
+	sources, err := ipfilter.ParsePrefixes(cfg.ClientSources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid buyer client_sources: %w", err)
+	}
+	defaultPolicy, err := buyer.NewPolicy(cfg.DefaultClient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid buyer default_client policy: %w", err)
+	}
+
+	clients := &buyerClients{
+		header:        cfg.ClientHeader,
+		sources:       ipfilter.List{Allow: sources},
+		defaultPolicy: defaultPolicy,
+		byName:        make(map[string]*BuyerClient),
+		apiKeys:       make(map[[32]byte]*BuyerClient),
+		bearerTokens:  make(map[[32]byte]*BuyerClient),
+	}
+
+	for _, clientCfg := range cfg.Clients {
+		policy, err := buyer.NewPolicy(clientCfg.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("buyer client %s: invalid policy: %w", clientCfg.Name, err)
+		}
+
+		client := &BuyerClient{Name: clientCfg.Name, Policy: policy}
+		clients.byName[client.Name] = client
+		for _, key := range clientCfg.APIKeys {
+			clients.apiKeys[sha256.Sum256([]byte(key))] = client
+		}
+		for _, token := range clientCfg.BearerTokens {
+			clients.bearerTokens[sha256.Sum256([]byte(token))] = client
+		}
+	}
+
+	return clients, nil
+}
+
+// identify returns the client of a request
+// Sources in order: X-API-Key, bearer token, the authenticated consumer, the client header from a trusted
+// source, the forward-proxy agent. Matched credentials are removed so they are not forwarded upstream.
+func (r *buyerClients) identify(c *gin.Context) *BuyerClient {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		if client, exists := r.apiKeys[sha256.Sum256([]byte(key))]; exists {
+			c.Request.Header.Del("X-API-Key")
+			return client
+		}
+	}
+
+	if token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found && token != "" {
+		if client, exists := r.bearerTokens[sha256.Sum256([]byte(token))]; exists {
+			c.Request.Header.Del("Authorization")
+			return client
+		}
+	}
+
+	if consumer := c.GetString("consumer_id"); consumer != "" {
+		return r.named(consumer)
+	}
+
+	// Any caller can set the header, so it only names the client of requests from trusted sources
+	if r.header != "" && len(r.sources.Allow) > 0 && r.sources.Allows(c.ClientIP()) {
+		if name := strings.TrimSpace(c.GetHeader(r.header)); name != "" {
+			return r.named(name)
+		}
+	}
+
+	if agent := c.GetString("proxy_agent"); agent != "" {
+		return r.named(agent)
+	}
+
+	return r.named(AnonymousClient)
+}
+
+// named returns the configured client with the given name, or an ad-hoc client under the default policy
+func (r *buyerClients) named(name string) *BuyerClient {
+	if client, exists := r.byName[name]; exists {
+		return client
+	}
+	return &BuyerClient{Name: name, Policy: r.defaultPolicy}
+}
+
+// list returns the configured clients
+func (r *buyerClients) list() []*BuyerClient {
+	clients := make([]*BuyerClient, 0, len(r.byName))
+	for _, client := range r.byName {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// identifyBuyerClient tags a request with the client its buyer payments are charged to
+func (g *ResourceGateway) identifyBuyerClient(c *gin.Context) *BuyerClient {
+	client := g.buyerClients.identify(c)
+	c.Set(buyerClientKey, client)
+	return client
+}
+
+// buyerClientOf returns the client a request was tagged with
+func buyerClientOf(c *gin.Context) *BuyerClient {
+	if value, exists := c.Get(buyerClientKey); exists {
+		if client, ok := value.(*BuyerClient); ok {
+			return client
+		}
+	}
+	return &BuyerClient{Name: AnonymousClient}
+}
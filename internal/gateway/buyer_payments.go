@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-agent-guide/internal/buyer"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// PaymentResponseHeader carries the upstream's settlement response of a paid request
+const PaymentResponseHeader = "X-Payment-Response"
+
+// recordBuyerPayment adds a signed payment to the ledger before it is sent upstream
+func (g *ResourceGateway) recordBuyerPayment(
+	c *gin.Context,
+	resource *ResourceConfig,
+	targetURL *url.URL,
+	requirements *types.PaymentRequirements,
+	payload *types.PaymentPayload,
+	wallet *buyer.Wallet,
+	spend *buyer.Spend,
+) (*buyer.Payment, error) {
+	upstream := *targetURL
+	upstream.RawQuery = c.Request.URL.RawQuery
+
+	var nonce string
+	if exact, ok := payload.Payload.(types.ExactEVMPayload); ok {
+		nonce = exact.Authorization.Nonce
+	}
+
+	return g.buyerOptions.Payments.Record(buyer.Payment{
+		Client:   buyerClientOf(c).Name,
+		Resource: resource.Resource,
+		Method:   c.Request.Method,
+		URL:      upstream.String(),
+		Scheme:   requirements.Scheme,
+		Network:  requirements.Network,
+		Asset:    requirements.Asset,
+		PayTo:    requirements.PayTo,
+		Payer:    wallet.Address.Hex(),
+		Amount:   requirements.MaxAmountRequired,
+		USD:      spend.USD,
+		Nonce:    nonce,
+	})
+}
+
+// completeBuyerPayment records the upstream outcome of a paid request
+// Payments the upstream rejected are released from the budgets
+func (g *ResourceGateway) completeBuyerPayment(payment *buyer.Payment, spend *buyer.Spend, upstreamStatus int, header http.Header) {
+	settlement := decodePaymentResponse(header.Get(PaymentResponseHeader))
+
+	var status string
+	switch {
+	case settlement != nil && settlement.Success:
+		status = buyer.PaymentSettled
+	case settlement != nil, upstreamStatus == http.StatusPaymentRequired:
+		status = buyer.PaymentFailed
+	case upstreamStatus < http.StatusBadRequest:
+		status = buyer.PaymentSettled
+	default:
+		status = buyer.PaymentUnknown
+	}
+
+	if status == buyer.PaymentFailed {
+		releaseBuyerSpend(g, spend)
+	}
+
+	if _, err := g.buyerOptions.Payments.Complete(payment.ID, status, upstreamStatus, settlement); err != nil {
+		log.Error().Err(err).Str("payment_id", payment.ID).Msg("Failed to record buyer payment outcome")
+		return
+	}
+
+	log.Info().
+		Str("payment_id", payment.ID).
+		Str("resource", payment.Resource).
+		Str("status", status).
+		Int("upstream_status", upstreamStatus).
+		Msg("Buyer payment completed")
+}
+
+// decodePaymentResponse decodes an X-Payment-Response header, sent as base64 or plain JSON
+func decodePaymentResponse(value string) *types.SettleResponse {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	data := []byte(value)
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		data = decoded
+	}
+
+	var settlement types.SettleResponse
+	if err := json.Unmarshal(data, &settlement); err != nil {
+		log.Warn().Err(err).Msg("Failed to decode upstream payment response")
+		return nil
+	}
+	return &settlement
+}
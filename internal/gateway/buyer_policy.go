@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+
+	"go-agent-guide/internal/buyer"
+	"go-agent-guide/internal/pricing"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+)
+
+// BuyerOptions holds the components used by the x402-buyer interceptor
+type BuyerOptions struct {
+	Wallets   *buyer.Wallets        // Wallets that sign outgoing payments
+	Budgets   *buyer.BudgetTracker  // Rolling spend counters for global and per-resource budgets
+	Payments  *buyer.PaymentLedger  // Record of every payment sent upstream
+	Approvals *buyer.ApprovalQueue  // Payments waiting for operator approval
+	Balances  *buyer.BalanceTracker // Known wallet balances; payments above them are refused
+}
+
+// budgetScope is a budget scope and the policy configuring its budgets
+type budgetScope struct {
+	scope  string
+	policy *buyer.Policy
+}
+
+// BuyerPolicy returns the global buyer policy
+func (g *ResourceGateway) BuyerPolicy() *buyer.Policy {
+	return g.buyerPolicy
+}
+
+// authorizeBuyerPayment checks a payment request against the global and resource policies
+// and reserves its value against the rolling budgets
+// It returns the wallet to pay with, or an error matching buyer.ErrPolicyViolation, buyer.ErrBudgetExceeded
+// or buyer.ErrInsufficientBalance
+func (g *ResourceGateway) authorizeBuyerPayment(
+	resource *ResourceConfig,
+	client *BuyerClient,
+	requirements *types.PaymentRequirements,
+) (*buyer.Wallet, *buyer.Spend, error) {
+	chainNetwork := g.FindChainNetwork(requirements.Network)
+	if chainNetwork == nil {
+		return nil, nil, fmt.Errorf("%w: network %s is not configured", buyer.ErrPolicyViolation, requirements.Network)
+	}
+
+	wallet, err := g.buyerOptions.Wallets.ForNetwork(requirements.Network)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", buyer.ErrPolicyViolation, err.Error())
+	}
+
+	policies := g.buyerPolicies(resource, client)
+
+	// The USD value is only required if a price limit or budget is configured
+	usd, err := g.PaymentValueUSD(requirements)
+	if err != nil {
+		usd = nil
+		for _, policy := range policies {
+			if policy.NeedsUSDValue() {
+				return nil, nil, fmt.Errorf("%w: cannot determine the USD value of the payment: %s", buyer.ErrPolicyViolation, err.Error())
+			}
+		}
+	}
+
+	for _, policy := range policies {
+		if err := policy.Check(requirements, chainNetwork.Symbol(), usd, g.rates); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	limits, err := g.budgetLimits(resource, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spend, err := g.buyerOptions.Budgets.Reserve(buyer.Spend{
+		Client:   client.Name,
+		Resource: resource.Resource,
+		Network:  requirements.Network,
+		Asset:    requirements.Asset,
+		PayTo:    requirements.PayTo,
+		Amount:   requirements.MaxAmountRequired,
+	}, usd, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Never sign more than the wallet is known to hold
+	if err := g.buyerOptions.Balances.Reserve(requirements.Network, requirements.MaxAmountRequired); err != nil {
+		if releaseErr := g.buyerOptions.Budgets.Release(spend.ID); releaseErr != nil {
+			return nil, nil, releaseErr
+		}
+		return nil, nil, err
+	}
+	return wallet, spend, nil
+}
+
+// buyerPolicies returns the policies a payment must pass: global, resource and client
+func (g *ResourceGateway) buyerPolicies(resource *ResourceConfig, client *BuyerClient) []*buyer.Policy {
+	policies := []*buyer.Policy{g.buyerPolicy, resource.Buyer}
+	if client.Policy != nil {
+		policies = append(policies, client.Policy)
+	}
+	return policies
+}
+
+// budgetLimits returns the global, resource and client budgets in USD
+func (g *ResourceGateway) budgetLimits(resource *ResourceConfig, client *BuyerClient) ([]buyer.BudgetLimit, error) {
+	var limits []buyer.BudgetLimit
+	scopes := []budgetScope{
+		{buyer.GlobalScope, g.buyerPolicy},
+		{resource.Resource, resource.Buyer},
+	}
+	if client.Policy != nil {
+		scopes = append(scopes, budgetScope{buyer.ClientScope(client.Name), client.Policy})
+	}
+
+	for _, s := range scopes {
+		for _, window := range []string{buyer.WindowHourly, buyer.WindowDaily} {
+			budget := s.policy.Budget(window)
+			if budget == nil {
+				continue
+			}
+			limit, err := g.rates.PriceToUSD(budget)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s %s budget: %s", buyer.ErrPolicyViolation, s.scope, window, err.Error())
+			}
+			limits = append(limits, buyer.BudgetLimit{Scope: s.scope, Window: window, Limit: limit})
+		}
+	}
+	return limits, nil
+}
+
+// BudgetUsage describes the spend of a scope against its budget inside a window
+type BudgetUsage struct {
+	Scope  string `json:"scope"`
+	Window string `json:"window"`
+	Spent  string `json:"spent"`            // USD
+	Budget string `json:"budget,omitempty"` // Configured budget, empty if unlimited
+}
+
+// BudgetUsage returns the current spend of the global scope, all x402-buyer resources and configured clients
+// extra adds resources that are not configured endpoints, such as forward-proxy agents
+func (g *ResourceGateway) BudgetUsage(extra ...*ResourceConfig) []BudgetUsage {
+	resources := append(g.GetAllResources(), extra...)
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Resource < resources[j].Resource
+	})
+
+	scopes := []budgetScope{{buyer.GlobalScope, g.buyerPolicy}}
+	for _, resource := range resources {
+		if resource.Buyer != nil {
+			scopes = append(scopes, budgetScope{resource.Resource, resource.Buyer})
+		}
+	}
+	clients := g.buyerClients.list()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Name < clients[j].Name
+	})
+	for _, client := range clients {
+		scopes = append(scopes, budgetScope{buyer.ClientScope(client.Name), client.Policy})
+	}
+
+	var usage []BudgetUsage
+	for _, s := range scopes {
+		for _, window := range []string{buyer.WindowHourly, buyer.WindowDaily} {
+			item := BudgetUsage{
+				Scope:  s.scope,
+				Window: window,
+				Spent:  pricing.FormatDecimal(g.buyerOptions.Budgets.Spent(s.scope, window)),
+			}
+			if budget := s.policy.Budget(window); budget != nil {
+				item.Budget = budget.String()
+			}
+			usage = append(usage, item)
+		}
+	}
+	return usage
+}
@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"go-agent-guide/internal/buyer"
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/pricing"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Payment option selection strategies
+const (
+	SelectCheapest  = "cheapest"  // Lowest USD value
+	SelectPreferred = "preferred" // First network in buyer.selection.preferred_networks, then cheapest
+	SelectBalance   = "balance"   // Cheapest among networks where the buyer wallet holds enough tokens
+)
+
+// selectionBalanceTimeout bounds the balance lookups of the "balance" strategy
+const selectionBalanceTimeout = 5 * time.Second
+
+// paymentOption is an accepted payment option of a 402 response that the buyer can pay
+type paymentOption struct {
+	index        int // Position in the accepts array, used as a stable tie-breaker
+	offer        *buyer.PaymentOffer
+	requirements *types.PaymentRequirements
+	network      *config.ChainNetwork
+	usd          *big.Rat // Nil if no USD rate is configured for the token
+}
+
+// selectPaymentOption chooses which accepted payment option to pay
+// Options on unknown networks, with unsupported schemes, without a buyer wallet or
+// rejected by the buyer policies are skipped. It returns the option and the reason it was chosen.
+func (g *ResourceGateway) selectPaymentOption(
+	ctx context.Context,
+	resource *ResourceConfig,
+	client *BuyerClient,
+	accepts []buyer.PaymentOffer,
+) (*buyer.PaymentOffer, string, error) {
+	if len(accepts) == 0 {
+		return nil, "", fmt.Errorf("%w: the 402 response contains no payment options", buyer.ErrPolicyViolation)
+	}
+
+	var candidates []*paymentOption
+	var skipped []string
+	for i := range accepts {
+		option, err := g.paymentCandidate(resource, client, i, &accepts[i])
+		if err != nil {
+			log.Debug().
+				Err(err).
+				Str("resource", resource.Resource).
+				Str("network", accepts[i].Network).
+				Str("scheme", accepts[i].Scheme).
+				Msg("Skipping payment option")
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		candidates = append(candidates, option)
+	}
+
+	strategy := g.cfg.Buyer.Selection.Strategy
+	if strategy == SelectBalance {
+		candidates, skipped = g.withSufficientBalance(ctx, candidates, skipped)
+	}
+
+	if len(candidates) == 0 {
+		return nil, "", fmt.Errorf("%w: no acceptable payment option (%s)", buyer.ErrPolicyViolation, strings.Join(skipped, "; "))
+	}
+
+	var reason string
+	switch strategy {
+	case SelectPreferred:
+		rank := func(option *paymentOption) int {
+			for i, name := range g.cfg.Buyer.Selection.PreferredNetworks {
+				if name == option.requirements.Network {
+					return i
+				}
+			}
+			return len(g.cfg.Buyer.Selection.PreferredNetworks)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			ri, rj := rank(candidates[i]), rank(candidates[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return cheaper(candidates[i], candidates[j])
+		})
+		reason = fmt.Sprintf("preferred network among %d candidates", len(candidates))
+	case SelectBalance:
+		sort.SliceStable(candidates, func(i, j int) bool { return cheaper(candidates[i], candidates[j]) })
+		reason = fmt.Sprintf("cheapest of %d candidates with sufficient wallet balance", len(candidates))
+	default:
+		sort.SliceStable(candidates, func(i, j int) bool { return cheaper(candidates[i], candidates[j]) })
+		reason = fmt.Sprintf("cheapest of %d candidates", len(candidates))
+	}
+
+	chosen := candidates[0]
+	if chosen.usd != nil {
+		reason += fmt.Sprintf(" ($%s)", pricing.FormatDecimal(chosen.usd))
+	}
+	return chosen.offer, reason, nil
+}
+
+// paymentCandidate checks that an option can be paid and computes its USD value
+func (g *ResourceGateway) paymentCandidate(resource *ResourceConfig, client *BuyerClient, index int, offer *buyer.PaymentOffer) (*paymentOption, error) {
+	requirements := &offer.PaymentRequirements
+	if !g.supportsScheme(requirements.Scheme) {
+		return nil, fmt.Errorf("%s: unsupported scheme %q", requirements.Network, requirements.Scheme)
+	}
+
+	network := g.FindChainNetwork(requirements.Network)
+	if network == nil {
+		return nil, fmt.Errorf("%s: network not configured", requirements.Network)
+	}
+	if !strings.EqualFold(requirements.Asset, network.TokenAddress) {
+		return nil, fmt.Errorf("%s: asset %s is not the configured token", requirements.Network, requirements.Asset)
+	}
+	if _, err := g.buyerOptions.Wallets.ForNetwork(requirements.Network); err != nil {
+		return nil, fmt.Errorf("%s: %s", requirements.Network, err.Error())
+	}
+
+	// Fill in the EIP-712 domain of the token if the seller left it out
+	if requirements.TokenName == "" {
+		requirements.TokenName = network.TokenName
+	}
+	if requirements.TokenVersion == "" {
+		requirements.TokenVersion = network.TokenVersion
+	}
+
+	usd, err := g.PaymentValueUSD(requirements)
+	if err != nil {
+		usd = nil
+	}
+
+	for _, policy := range g.buyerPolicies(resource, client) {
+		if usd == nil && policy.NeedsUSDValue() {
+			return nil, fmt.Errorf("%s: cannot determine the USD value of the payment", requirements.Network)
+		}
+		if err := policy.Check(requirements, network.Symbol(), usd, g.rates); err != nil {
+			return nil, fmt.Errorf("%s: %s", requirements.Network, strings.TrimPrefix(err.Error(), buyer.ErrPolicyViolation.Error()+": "))
+		}
+	}
+
+	return &paymentOption{index: index, offer: offer, requirements: requirements, network: network, usd: usd}, nil
+}
+
+// withSufficientBalance keeps the options whose buyer wallet holds at least the required amount
+func (g *ResourceGateway) withSufficientBalance(ctx context.Context, options []*paymentOption, skipped []string) ([]*paymentOption, []string) {
+	ctx, cancel := context.WithTimeout(ctx, selectionBalanceTimeout)
+	defer cancel()
+
+	var funded []*paymentOption
+	for _, option := range options {
+		amount, ok := new(big.Int).SetString(option.requirements.MaxAmountRequired, 10)
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("%s: invalid amount %q", option.network.Name, option.requirements.MaxAmountRequired))
+			continue
+		}
+
+		wallet, _ := g.buyerOptions.Wallets.ForNetwork(option.network.Name)
+		balance, err := g.buyerOptions.Wallets.TokenBalance(ctx, wallet)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: balance unavailable: %s", option.network.Name, err.Error()))
+			continue
+		}
+		if balance.Cmp(amount) < 0 {
+			skipped = append(skipped, fmt.Sprintf("%s: insufficient wallet balance", option.network.Name))
+			continue
+		}
+		funded = append(funded, option)
+	}
+	return funded, skipped
+}
+
+// supportsScheme reports whether the buyer can sign payments of a scheme
+func (g *ResourceGateway) supportsScheme(scheme string) bool {
+	schemes := g.cfg.Facilitator.SupportedSchemes
+	if len(schemes) == 0 {
+		schemes = []string{"exact"}
+	}
+	for _, supported := range schemes {
+		if supported == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// cheaper orders options by USD value; options without a known value sort last in their original order
+func cheaper(a, b *paymentOption) bool {
+	switch {
+	case a.usd != nil && b.usd != nil:
+		if cmp := a.usd.Cmp(b.usd); cmp != 0 {
+			return cmp < 0
+		}
+	case a.usd != nil:
+		return true
+	case b.usd != nil:
+		return false
+	}
+	return a.index < b.index
+}
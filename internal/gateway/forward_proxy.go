@@ -0,0 +1,270 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"go-agent-guide/internal/buyer"
+	"go-agent-guide/internal/config"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ForwardProxyPath is the explicit forward-proxy endpoint, used as /proxy?url=<absolute URL>
+const ForwardProxyPath = "/proxy"
+
+// ProxyAgent is an agent allowed to use the forward proxy
+type ProxyAgent struct {
+	Name                string   `json:"name"`
+	AllowedDestinations []string `json:"allowedDestinations"`
+
+	keyHash  [32]byte
+	resource *ResourceConfig // Virtual x402-buyer resource carrying the agent's policy and budget scope
+}
+
+// ForwardProxy forwards agent requests for arbitrary URLs and pays upstream 402 responses
+// under the global buyer policy and the agent's own policy
+type ForwardProxy struct {
+	gateway *ResourceGateway
+	agents  []*ProxyAgent
+}
+
+// NewForwardProxy creates a forward proxy for the configured agents
+func NewForwardProxy(g *ResourceGateway, cfg config.ForwardProxyConfig) (*ForwardProxy, error) {
+	p := &ForwardProxy{gateway: g}
+
+	for _, agentCfg := range cfg.Agents {
+		policy, err := buyer.NewPolicy(agentCfg.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("forward proxy agent %s: invalid policy: %w", agentCfg.Name, err)
+		}
+
+		destinations := make([]string, 0, len(agentCfg.AllowedDestinations))
+		for _, destination := range agentCfg.AllowedDestinations {
+			destinations = append(destinations, strings.ToLower(strings.TrimSpace(destination)))
+		}
+
+		p.agents = append(p.agents, &ProxyAgent{
+			Name:                agentCfg.Name,
+			AllowedDestinations: destinations,
+			keyHash:             sha256.Sum256([]byte(agentCfg.APIKey)),
+			resource: &ResourceConfig{
+				Resource:    "proxy:" + agentCfg.Name,
+				Type:        "http",
+				Middlewares: []string{"x402-buyer"},
+				Buyer:       policy,
+			},
+		})
+	}
+
+	return p, nil
+}
+
+// Resources returns the virtual x402-buyer resources of the proxy agents, used for budget reporting
+func (p *ForwardProxy) Resources() []*ResourceConfig {
+	resources := make([]*ResourceConfig, 0, len(p.agents))
+	for _, agent := range p.agents {
+		resources = append(resources, agent.resource)
+	}
+	return resources
+}
+
+// Handle serves a forward-proxy request
+// Accepts absolute-form requests ("GET http://host/path HTTP/1.1") and GET|POST|... /proxy?url=<absolute URL>
+func (p *ForwardProxy) Handle(c *gin.Context) {
+	if c.Request.Method == http.MethodConnect {
+		c.JSON(http.StatusMethodNotAllowed, types.ErrorResponse{
+			Error:   "connect_not_supported",
+			Message: "CONNECT tunnels cannot be paid; send absolute URLs or use " + ForwardProxyPath + "?url=",
+			Code:    http.StatusMethodNotAllowed,
+		})
+		return
+	}
+
+	agent := p.authenticate(c.Request)
+	if agent == nil {
+		c.Header("Proxy-Authenticate", `Basic realm="agent-guide"`)
+		c.JSON(http.StatusProxyAuthRequired, types.ErrorResponse{
+			Error:   "proxy_auth_required",
+			Message: "A valid agent API key is required in the Proxy-Authorization header",
+			Code:    http.StatusProxyAuthRequired,
+		})
+		return
+	}
+
+	destination, err := destinationURL(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "invalid_destination",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if !agent.allows(destination) {
+		log.Warn().
+			Str("agent", agent.Name).
+			Str("destination", destination.String()).
+			Msg("Forward proxy destination not allowed for agent")
+		c.JSON(http.StatusForbidden, types.ErrorResponse{
+			Error:   "destination_not_allowed",
+			Message: fmt.Sprintf("Destination %s is not allowed for agent %s", destination.Host, agent.Name),
+			Code:    http.StatusForbidden,
+		})
+		return
+	}
+
+	log.Info().
+		Str("agent", agent.Name).
+		Str("method", c.Request.Method).
+		Str("destination", destination.String()).
+		Msg("Forwarding proxy request")
+
+	// Agent credentials are only meaningful to the proxy
+	c.Request.Header.Del("Proxy-Authorization")
+
+	// Make the inbound request look like a direct request to the destination,
+	// so the reverse proxy forwards the destination query and Host
+	c.Request.URL = destination
+	c.Request.Host = destination.Host
+
+	resource := *agent.resource
+	resource.TargetURL = destination.String()
+	c.Set("resource_config", &resource)
+	c.Set("proxy_agent", agent.Name)
+
+	// Upstream limits are taken before any buyer payment is made to the destination
+	release, err := p.gateway.AcquireConcurrency(c.Request.Context(), &resource)
+	if err != nil {
+		RejectOverloaded(c, &resource, err)
+		return
+	}
+	defer release()
+
+	p.gateway.ProxyRequest(c, &resource)
+}
+
+// authenticate returns the agent whose API key is in the Proxy-Authorization header
+// Supports "Bearer <key>" and "Basic base64(<name>:<key>)"
+func (p *ForwardProxy) authenticate(r *http.Request) *ProxyAgent {
+	header := r.Header.Get("Proxy-Authorization")
+	var key string
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		key = strings.TrimPrefix(header, "Bearer ")
+	case strings.HasPrefix(header, "Basic "):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err != nil {
+			return nil
+		}
+		_, password, found := strings.Cut(string(decoded), ":")
+		if !found {
+			return nil
+		}
+		key = password
+	default:
+		return nil
+	}
+	if key == "" {
+		return nil
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	var match *ProxyAgent
+	for _, agent := range p.agents {
+		if subtle.ConstantTimeCompare(hash[:], agent.keyHash[:]) == 1 {
+			match = agent
+		}
+	}
+	return match
+}
+
+// destinationURL extracts the absolute destination URL of a forward-proxy request
+func destinationURL(r *http.Request) (*url.URL, error) {
+	var raw string
+	if r.URL.IsAbs() {
+		raw = r.URL.String()
+	} else if r.URL.Path == ForwardProxyPath {
+		raw = r.URL.Query().Get("url")
+		if raw == "" {
+			return nil, fmt.Errorf("missing url query parameter")
+		}
+	} else {
+		return nil, fmt.Errorf("expected an absolute request URL or %s?url=<absolute URL>", ForwardProxyPath)
+	}
+
+	destination, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination URL: %s", err.Error())
+	}
+	if destination.Scheme != "http" && destination.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported destination scheme %q", destination.Scheme)
+	}
+	if destination.Host == "" {
+		return nil, fmt.Errorf("destination URL has no host")
+	}
+
+	// Resolve dot segments so URL prefix allowlists cannot be escaped with "/v1/../"
+	cleaned := path.Clean("/" + destination.Path)
+	if strings.HasSuffix(destination.Path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	destination.Path = cleaned
+	destination.RawPath = ""
+	destination.Fragment = ""
+	return destination, nil
+}
+
+// allows reports whether the agent may call a destination
+// Entries are "*" (any destination), a host ("api.example.com"), a subdomain
+// wildcard ("*.example.com"), a host with port ("api.example.com:8443") or a URL prefix ("https://api.example.com/v1/").
+// A URL prefix matches whole path segments, so "https://api.example.com/v1" does not allow "/v1beta".
+func (a *ProxyAgent) allows(destination *url.URL) bool {
+	host := strings.ToLower(destination.Hostname())
+
+	for _, entry := range a.AllowedDestinations {
+		switch {
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "://"):
+			prefix, err := url.Parse(entry)
+			if err != nil {
+				continue
+			}
+			if prefix.Scheme == destination.Scheme &&
+				strings.EqualFold(prefix.Host, destination.Host) &&
+				pathHasPrefix(destination.Path, prefix.Path) {
+				return true
+			}
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+		case strings.Contains(entry, ":"):
+			// Host with port
+			if entry == strings.ToLower(destination.Host) {
+				return true
+			}
+		default:
+			if host == entry {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pathHasPrefix reports whether requestPath is prefix or lies below it, ending the prefix on a segment boundary
+func pathHasPrefix(requestPath, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/")
+}
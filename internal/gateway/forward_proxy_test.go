@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForwardProxyForwardsDestinationPath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":  r.URL.Path,
+			"query": r.URL.RawQuery,
+			"auth":  r.Header.Get("Proxy-Authorization"),
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	resourceGateway, err := NewResourceGateway(nil, &config.Config{}, BuyerOptions{})
+	if err != nil {
+		t.Fatalf("NewResourceGateway: %v", err)
+	}
+	proxy, err := NewForwardProxy(resourceGateway, config.ForwardProxyConfig{
+		Agents: []config.ProxyAgentConfig{{
+			Name:                "research-agent",
+			APIKey:              "agent-key",
+			AllowedDestinations: []string{upstream.URL + "/v1/"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewForwardProxy: %v", err)
+	}
+
+	router := gin.New()
+	router.NoRoute(proxy.Handle)
+
+	tests := []struct {
+		name   string
+		target string
+		path   string
+		query  string
+	}{
+		{"absolute URL", upstream.URL + "/v1/data?limit=5", "/v1/data", "limit=5"},
+		{"absolute URL below the prefix", upstream.URL + "/v1/data/items/1", "/v1/data/items/1", ""},
+		{"proxy endpoint", ForwardProxyPath + "?url=" + url.QueryEscape(upstream.URL+"/v1/data?limit=5"), "/v1/data", "limit=5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Proxy-Authorization", "Bearer agent-key")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got["path"] != tt.path || got["query"] != tt.query {
+				t.Errorf("upstream got %s?%s, want %s?%s", got["path"], got["query"], tt.path, tt.query)
+			}
+			if got["auth"] != "" {
+				t.Errorf("Proxy-Authorization forwarded upstream: %q", got["auth"])
+			}
+		})
+	}
+}
+
+func TestJoinTargetPath(t *testing.T) {
+	tests := []struct {
+		target, request, resource, want string
+	}{
+		{"/v1/data", "/api/data", "/api/data", "/v1/data"},
+		{"/v1/data", "/api/data/items/1", "/api/data", "/v1/data/items/1"},
+		{"/v1/data/", "/api/data/", "/api/data", "/v1/data/"},
+		{"", "/api/data/items", "/api/data", "/items"},
+		{"/v1", "/items", "/", "/v1/items"},
+		// Not below the resource on a segment boundary
+		{"/v1/data", "/api/database", "/api/data", "/v1/data"},
+		// Forward proxy requests carry the destination path and a virtual resource
+		{"/v1/data", "/v1/data", "proxy:research-agent", "/v1/data"},
+	}
+	for _, tt := range tests {
+		if got := joinTargetPath(tt.target, tt.request, tt.resource); got != tt.want {
+			t.Errorf("joinTargetPath(%q, %q, %q) = %q, want %q", tt.target, tt.request, tt.resource, got, tt.want)
+		}
+	}
+}
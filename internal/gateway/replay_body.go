@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go-agent-guide/internal/config"
+)
+
+// ReplayBody is a buffered request body that can be read again for the paid retry after a 402
+// Bodies up to the memory limit are kept in memory, larger ones are spilled to a temp file.
+// Bodies above the maximum size are streamed once and marked as not replayable.
+type ReplayBody struct {
+	memory     []byte
+	file       *os.File
+	size       int64
+	replayable bool
+}
+
+// BufferRequestBody reads the request body so it can be replayed
+// The request body is replaced with a reader for the first attempt.
+func BufferRequestBody(r *http.Request, cfg config.ReplayConfig) (*ReplayBody, error) {
+	body := &ReplayBody{replayable: true}
+	if r.Body == nil || r.Body == http.NoBody {
+		return body, nil
+	}
+
+	// Known oversized bodies are streamed without buffering
+	if r.ContentLength > cfg.MaxBody {
+		body.replayable = false
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r.Body, cfg.MemoryLimit+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if n <= cfg.MemoryLimit {
+		body.memory = buf.Bytes()
+		body.size = n
+		r.Body = body.mustReader()
+		return body, nil
+	}
+
+	// Spill to a temp file
+	file, err := os.CreateTemp(cfg.TempDir, "agent-guide-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request body file: %w", err)
+	}
+	body.file = file
+
+	written, err := io.Copy(file, &buf)
+	if err == nil {
+		var copied int64
+		copied, err = io.CopyN(file, r.Body, cfg.MaxBody-written+1)
+		written += copied
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to buffer request body: %w", err)
+	}
+	body.size = written
+
+	if written > cfg.MaxBody {
+		// Too large to replay: stream the buffered prefix followed by the rest of the body
+		body.replayable = false
+		r.Body = io.NopCloser(io.MultiReader(io.NewSectionReader(file, 0, written), r.Body))
+		return body, nil
+	}
+
+	r.Body = body.mustReader()
+	return body, nil
+}
+
+// Replayable reports whether the body was fully buffered and can be sent again
+func (b *ReplayBody) Replayable() bool {
+	return b.replayable
+}
+
+// Reader returns a new reader over the buffered body
+func (b *ReplayBody) Reader() (io.ReadCloser, error) {
+	if !b.replayable {
+		return nil, fmt.Errorf("request body is too large to replay")
+	}
+	if b.file != nil {
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size)), nil
+	}
+	if b.size == 0 {
+		return http.NoBody, nil
+	}
+	return io.NopCloser(bytes.NewReader(b.memory)), nil
+}
+
+// Close removes the temp file of a spilled body
+func (b *ReplayBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	b.file.Close()
+	b.file = nil
+	return os.Remove(name)
+}
+
+// mustReader returns a reader over a body known to be replayable
+func (b *ReplayBody) mustReader() io.ReadCloser {
+	reader, _ := b.Reader()
+	return reader
+}
@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-agent-guide/internal/auth"
+	"go-agent-guide/internal/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog/log"
+)
+
+// Resource authentication types
+const (
+	AuthTypeBearer = "bearer"
+	AuthTypeJWT    = "jwt"
+	AuthTypeAPIKey = "api_key" // Consumer API keys issued through the admin API
+	AuthTypeWallet = "wallet"  // Sign-In with Ethereum sessions or wallet-signed requests
+)
+
+// buildAuthConfig builds the authentication settings of an auth middleware
+// A jwt configuration that fails to parse is kept with a nil verifier, so requests are refused rather than let through.
+func (g *ResourceGateway) buildAuthConfig(endpoint *config.EndpointConfig, authConfig interface{}) *AuthConfig {
+	authMap, ok := authConfig.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	authType, _ := authMap["type"].(string)
+	switch authType {
+	case AuthTypeBearer:
+		token, _ := authMap["token"].(string)
+		if token == "" {
+			return nil
+		}
+		return &AuthConfig{Type: authType, Token: token}
+	case AuthTypeJWT:
+		verifier, err := g.buildJWTVerifier(authMap)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("endpoint", endpoint.Endpoint).
+				Msg("Invalid jwt auth configuration, refusing requests")
+		}
+		return &AuthConfig{Type: authType, JWT: verifier}
+	case AuthTypeAPIKey:
+		return &AuthConfig{Type: authType}
+	case AuthTypeWallet:
+		allowlist := stringList(authMap["allowlist"])
+		for i, address := range allowlist {
+			if !common.IsHexAddress(address) {
+				log.Warn().Str("address", address).Str("endpoint", endpoint.Endpoint).Msg("Invalid wallet address in allowlist")
+			}
+			allowlist[i] = strings.ToLower(address)
+		}
+		return &AuthConfig{Type: authType, Allowlist: allowlist}
+	default:
+		log.Warn().Str("type", authType).Str("endpoint", endpoint.Endpoint).Msg("Unsupported auth type, ignoring")
+		return nil
+	}
+}
+
+// buildJWTVerifier parses the jwt settings of an auth middleware
+func (g *ResourceGateway) buildJWTVerifier(authMap map[string]interface{}) (*auth.JWTVerifier, error) {
+	var cfg auth.JWTConfig
+	cfg.Secret, _ = authMap["secret"].(string)
+	cfg.JWKSFile, _ = authMap["jwks_file"].(string)
+	cfg.JWKSURL, _ = authMap["jwks_url"].(string)
+	cfg.Issuer, _ = authMap["issuer"].(string)
+	cfg.Algorithms = stringList(authMap["algorithms"])
+
+	switch audience := authMap["audience"].(type) {
+	case string:
+		cfg.Audience = []string{audience}
+	case []interface{}:
+		cfg.Audience = stringList(audience)
+	}
+
+	var err error
+	if cfg.JWKSRefresh, err = durationSetting(authMap, "jwks_refresh"); err != nil {
+		return nil, err
+	}
+	if cfg.Leeway, err = durationSetting(authMap, "leeway"); err != nil {
+		return nil, err
+	}
+
+	if rules, ok := authMap["required_claims"].([]interface{}); ok {
+		for _, item := range rules {
+			switch rule := item.(type) {
+			case string:
+				cfg.RequiredClaims = append(cfg.RequiredClaims, auth.ClaimRule{Claim: rule})
+			case map[string]interface{}:
+				claim, _ := rule["claim"].(string)
+				values := stringList(rule["values"])
+				if value, ok := rule["value"].(string); ok {
+					values = append(values, value)
+				}
+				cfg.RequiredClaims = append(cfg.RequiredClaims, auth.ClaimRule{Claim: claim, Values: values})
+			default:
+				return nil, fmt.Errorf("invalid required_claims entry %v", item)
+			}
+		}
+	}
+
+	// forward_claims maps upstream header names to claims; config keys are case-insensitive like headers
+	if forward, ok := authMap["forward_claims"].(map[string]interface{}); ok {
+		cfg.ForwardClaims = make(map[string]string, len(forward))
+		for header, claim := range forward {
+			name, _ := claim.(string)
+			cfg.ForwardClaims[header] = name
+		}
+	}
+
+	return auth.NewJWTVerifier(cfg, g.authKeys)
+}
+
+// durationSetting reads an optional duration such as "5m" from a middleware config map
+func durationSetting(settings map[string]interface{}, key string) (time.Duration, error) {
+	value, ok := settings[key].(string)
+	if !ok || value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return duration, nil
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/ratelimit"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// buildConcurrencyLimit parses the settings of a concurrency middleware
+func buildConcurrencyLimit(limitConfig interface{}) (*ratelimit.ConcurrencyLimit, error) {
+	limitMap, ok := limitConfig.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("concurrency settings must be a map")
+	}
+
+	maxInFlight, err := numericSetting(limitMap, "max_in_flight")
+	if err != nil {
+		return nil, err
+	}
+	if maxInFlight < 1 {
+		return nil, fmt.Errorf("max_in_flight must be at least 1")
+	}
+	maxQueue, err := numericSetting(limitMap, "max_queue")
+	if err != nil {
+		return nil, err
+	}
+
+	limit := &ratelimit.ConcurrencyLimit{MaxInFlight: int(maxInFlight), MaxQueue: int(maxQueue)}
+	if timeout, ok := limitMap["queue_timeout"].(string); ok && timeout != "" {
+		if limit.QueueTimeout, err = time.ParseDuration(timeout); err != nil || limit.QueueTimeout <= 0 {
+			return nil, fmt.Errorf("invalid queue_timeout %q", timeout)
+		}
+	}
+	return limit, nil
+}
+
+// newUpstreamLimiters creates the limiters of the configured upstream targets, keyed by lowercase target
+func newUpstreamLimiters(upstreams []config.UpstreamLimitConfig) map[string]*ratelimit.ConcurrencyLimiter {
+	limiters := make(map[string]*ratelimit.ConcurrencyLimiter, len(upstreams))
+	for _, upstream := range upstreams {
+		target := strings.ToLower(upstream.Target)
+		limiters[target] = ratelimit.NewConcurrencyLimiter(ratelimit.ScopeTarget, target, ratelimit.ConcurrencyLimit{
+			MaxInFlight:  upstream.MaxInFlight,
+			MaxQueue:     upstream.MaxQueue,
+			QueueTimeout: upstream.QueueTimeout,
+		})
+	}
+	return limiters
+}
+
+// upstreamLimiter returns the limiter of the target a resource proxies to, matched by host and port,
+// then by host alone; nil if the target has no limit
+func (g *ResourceGateway) upstreamLimiter(resource *ResourceConfig) *ratelimit.ConcurrencyLimiter {
+	if len(g.upstreamLimiters) == 0 || resource.TargetURL == "" {
+		return nil
+	}
+	targetURL, err := url.Parse(resource.TargetURL)
+	if err != nil {
+		return nil
+	}
+	if limiter, exists := g.upstreamLimiters[strings.ToLower(targetURL.Host)]; exists {
+		return limiter
+	}
+	return g.upstreamLimiters[strings.ToLower(targetURL.Hostname())]
+}
+
+// AcquireConcurrency takes a slot of the resource's concurrency limit and then of its upstream target's limit
+// The returned function releases both. It returns a *ratelimit.ShedError when either limit sheds the request.
+func (g *ResourceGateway) AcquireConcurrency(ctx context.Context, resource *ResourceConfig) (func(), error) {
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	if resource.Concurrency != nil {
+		limiter := g.concurrency.Get(ratelimit.ScopeResource, resource.Resource, *resource.Concurrency)
+		releaseResource, err := limiter.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, releaseResource)
+	}
+
+	if limiter := g.upstreamLimiter(resource); limiter != nil {
+		releaseTarget, err := limiter.Acquire(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, releaseTarget)
+	}
+
+	return release, nil
+}
+
+// RejectOverloaded responds to a request that could not acquire a concurrency slot
+// Shed requests get 503 with a Retry-After header; requests cancelled while queued get no response.
+func RejectOverloaded(c *gin.Context, resource *ResourceConfig, err error) {
+	var shed *ratelimit.ShedError
+	if !errors.As(err, &shed) {
+		c.Abort()
+		return
+	}
+
+	log.Warn().
+		Str("resource", resource.Resource).
+		Str("scope", shed.Scope).
+		Str("limit", shed.Name).
+		Err(shed.Err).
+		Msg("Request shed by concurrency limit")
+
+	message := "The resource is at capacity, retry later"
+	if shed.Scope == ratelimit.ScopeTarget {
+		message = "The upstream service is at capacity, retry later"
+	}
+	c.Header("Retry-After", strconv.Itoa(max(1, int((shed.RetryAfter+time.Second-1)/time.Second))))
+	c.JSON(http.StatusServiceUnavailable, types.ErrorResponse{
+		Error:   "overloaded",
+		Message: message,
+		Code:    http.StatusServiceUnavailable,
+	})
+	c.Abort()
+}
@@ -3,13 +3,19 @@ package gateway
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"go-agent-guide/internal/auth"
+	"go-agent-guide/internal/buyer"
 	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/ipfilter"
+	"go-agent-guide/internal/pricing"
+	"go-agent-guide/internal/ratelimit"
 	"github.com/agent-guide/go-x402-facilitator/pkg/facilitator"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
@@ -19,18 +25,64 @@ import (
 
 // AuthConfig represents authentication configuration for a resource
 type AuthConfig struct {
-	Type  string `json:"type"`  // e.g., "bearer"
-	Token string `json:"token"` // token value
+	Type      string            `json:"type"`                // "bearer", "jwt", "api_key" or "wallet"
+	Token     string            `json:"token"`               // token value
+	JWT       *auth.JWTVerifier `json:"-"`                   // Verifier of a jwt auth, nil if its configuration is invalid
+	Allowlist []string          `json:"allowlist,omitempty"` // Lowercase wallet addresses allowed by a wallet auth; empty allows any
+}
+
+// PassConfig represents the access pass settings of a resource sold as time-based access
+type PassConfig struct {
+	Duration time.Duration `json:"duration"`        // Lifetime of the issued pass
+	Group    string        `json:"group,omitempty"` // Resource group the pass grants access to (default: the resource only)
 }
 
 // ResourceConfig represents a resource configuration loaded from JSON
 type ResourceConfig struct {
-	Resource    string                     `json:"resource"`    // API endpoint prefix
-	Type        string                     `json:"type"`        // e.g., "http"
-	Middlewares []string                   `json:"middlewares"` // List of middleware names to apply (e.g., ["auth", "x402"])
-	Auth        *AuthConfig                `json:"auth,omitempty"`
-	X402        *types.PaymentRequirements `json:"x402,omitempty"`
-	TargetURL   string                     `json:"targetUrl"` // The actual backend URL to proxy to
+	Resource    string                      `json:"resource"`          // API endpoint prefix
+	Type        string                      `json:"type"`              // e.g., "http"
+	Billing     string                      `json:"billing,omitempty"` // "" (per-request x402), "credits" or "topup"
+	Group       string                      `json:"group,omitempty"`   // Resource group, used by consumer key scopes
+	Middlewares []string                    `json:"middlewares"`       // List of middleware names to apply (e.g., ["auth", "x402"])
+	Auth        *AuthConfig                 `json:"auth,omitempty"`
+	X402        *types.PaymentRequirements  `json:"x402,omitempty"`
+	Pass        *PassConfig                 `json:"pass,omitempty"`        // If set, a payment issues an access pass instead of paying per call
+	Buyer       *buyer.Policy               `json:"buyer,omitempty"`       // If set, upstream 402 responses are paid within this policy
+	TokenGate   *TokenGateConfig            `json:"tokenGate,omitempty"`   // Holders get free access; nil with "token-gate" in Middlewares if misconfigured
+	RateLimit   *ratelimit.Limit            `json:"rateLimit,omitempty"`   // Request rate and quotas; nil with "rate-limit" in Middlewares if misconfigured
+	Concurrency *ratelimit.ConcurrencyLimit `json:"concurrency,omitempty"` // In-flight requests and wait queue; nil with "concurrency" in Middlewares if misconfigured
+	IPFilter    *ipfilter.List              `json:"ipFilter,omitempty"`    // Client IP allow and deny lists; nil with "ip-filter" in Middlewares if misconfigured
+	TargetURL   string                      `json:"targetUrl"`             // The actual backend URL to proxy to
+}
+
+// PassScope returns the scope of access passes issued for this resource
+func (r *ResourceConfig) PassScope() string {
+	if r.Pass != nil && r.Pass.Group != "" {
+		return "group:" + r.Pass.Group
+	}
+	return "resource:" + r.Resource
+}
+
+// HasMiddleware reports whether the named middleware is applied to the resource
+func (r *ResourceConfig) HasMiddleware(name string) bool {
+	for _, mw := range r.Middlewares {
+		if mw == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Groups returns the resource groups the resource belongs to: its own and that of its access passes
+func (r *ResourceConfig) Groups() []string {
+	var groups []string
+	if r.Group != "" {
+		groups = append(groups, r.Group)
+	}
+	if r.Pass != nil && r.Pass.Group != "" && r.Pass.Group != r.Group {
+		groups = append(groups, r.Pass.Group)
+	}
+	return groups
 }
 
 // ResourcesList represents the structure of the resources JSON file
@@ -40,19 +92,59 @@ type ResourcesList struct {
 
 // ResourceGateway handles resource gateway operations
 type ResourceGateway struct {
-	facilitator    facilitator.PaymentFacilitator
-	cfg            *config.Config
-	resources      map[string]*ResourceConfig // Map of resource path to config
-	resourcesMutex sync.RWMutex
-	lastLoadTime   time.Time
+	facilitator      facilitator.PaymentFacilitator
+	cfg              *config.Config
+	rates            *pricing.RateTable
+	buyerPolicy      *buyer.Policy  // Global policy applied on top of each resource's x402-buyer policy
+	buyerApproval    *pricing.Price // Payments above this price wait for operator approval, nil if disabled
+	buyerClients     *buyerClients  // Internal clients that buyer payments are charged to
+	buyerOptions     BuyerOptions
+	authKeys         *auth.KeySets                            // JWKS cache shared by jwt auth across resource reloads
+	tokenGates       *TokenGateChecker                        // Holdings cache shared by token gates across resource reloads
+	concurrency      *ratelimit.ConcurrencyLimiters           // Resource concurrency limiters shared across resource reloads
+	upstreamLimiters map[string]*ratelimit.ConcurrencyLimiter // Concurrency limiters of upstream targets
+	resources        map[string]*ResourceConfig               // Map of resource path to config
+	resourcesMutex   sync.RWMutex
+	lastLoadTime     time.Time
 }
 
 // NewResourceGateway creates a new resource gateway
-func NewResourceGateway(f facilitator.PaymentFacilitator, cfg *config.Config) *ResourceGateway {
+func NewResourceGateway(f facilitator.PaymentFacilitator, cfg *config.Config, buyerOptions BuyerOptions) (*ResourceGateway, error) {
+	rates, err := pricing.NewRateTable(cfg.Pricing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pricing rate table: %w", err)
+	}
+
+	buyerPolicy, err := buyer.NewPolicy(cfg.Buyer.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid buyer policy: %w", err)
+	}
+
+	var buyerApproval *pricing.Price
+	if cfg.Buyer.Approval.Threshold != "" {
+		if buyerApproval, err = pricing.ParsePrice(cfg.Buyer.Approval.Threshold); err != nil {
+			return nil, fmt.Errorf("invalid buyer approval threshold: %w", err)
+		}
+	}
+
+	buyerClients, err := newBuyerClients(cfg.Buyer)
+	if err != nil {
+		return nil, err
+	}
+
 	gateway := &ResourceGateway{
-		facilitator: f,
-		cfg:         cfg,
-		resources:   make(map[string]*ResourceConfig),
+		facilitator:      f,
+		cfg:              cfg,
+		rates:            rates,
+		buyerPolicy:      buyerPolicy,
+		buyerApproval:    buyerApproval,
+		buyerClients:     buyerClients,
+		buyerOptions:     buyerOptions,
+		authKeys:         auth.NewKeySets(),
+		tokenGates:       NewTokenGateChecker(DialChainNetwork),
+		concurrency:      ratelimit.NewConcurrencyLimiters(),
+		upstreamLimiters: newUpstreamLimiters(cfg.RateLimit.Upstreams),
+		resources:        make(map[string]*ResourceConfig),
 	}
 
 	// Load resources on startup
@@ -60,7 +152,12 @@ func NewResourceGateway(f facilitator.PaymentFacilitator, cfg *config.Config) *R
 		log.Warn().Err(err).Msg("Failed to load resources on startup, will retry on first request")
 	}
 
-	return gateway
+	return gateway, nil
+}
+
+// Rates returns the pricing rate table used to convert human prices into token amounts
+func (g *ResourceGateway) Rates() *pricing.RateTable {
+	return g.rates
 }
 
 // DiscoverResources returns discovered resources from loaded configuration
@@ -172,6 +269,8 @@ func (g *ResourceGateway) convertEndpointToResource(endpoint *config.EndpointCon
 	resource := &ResourceConfig{
 		Resource:    endpoint.Endpoint,
 		Type:        endpoint.Type,
+		Billing:     endpoint.Billing,
+		Group:       endpoint.Group,
 		Middlewares: []string{},
 		TargetURL:   endpoint.TargetURL,
 	}
@@ -181,16 +280,7 @@ func (g *ResourceGateway) convertEndpointToResource(endpoint *config.EndpointCon
 		// Check for auth middleware
 		if authConfig, hasAuth := mwMap["auth"]; hasAuth {
 			resource.Middlewares = append(resource.Middlewares, "auth")
-			if authMap, ok := authConfig.(map[string]interface{}); ok {
-				authType, _ := authMap["type"].(string)
-				authToken, _ := authMap["token"].(string)
-				if authType != "" && authToken != "" {
-					resource.Auth = &AuthConfig{
-						Type:  authType,
-						Token: authToken,
-					}
-				}
-			}
+			resource.Auth = g.buildAuthConfig(endpoint, authConfig)
 			continue
 		}
 
@@ -201,31 +291,99 @@ func (g *ResourceGateway) convertEndpointToResource(endpoint *config.EndpointCon
 				network, _ := sellerMap["network"].(string)
 				payTo, _ := sellerMap["payto"].(string)
 				maxAmount, _ := sellerMap["maxamountrequired"].(string)
-				if network != "" && payTo != "" && maxAmount != "" {
-					resource.X402 = g.buildX402PaymentRequirements(endpoint, network, payTo, maxAmount)
+				price, _ := sellerMap["price"].(string)
+				if network != "" && payTo != "" && (maxAmount != "" || price != "") {
+					resource.X402 = g.buildX402PaymentRequirements(endpoint, network, payTo, maxAmount, price)
+				}
+				if passConfig, hasPass := sellerMap["pass"]; hasPass {
+					resource.Pass = g.buildPassConfig(endpoint, passConfig)
 				}
 			}
 			continue
 		}
+
+		// Check for rate-limit middleware
+		// Limits that fail to parse are kept without settings, so requests are refused rather than let through
+		if limitConfig, hasLimit := mwMap["rate-limit"]; hasLimit {
+			resource.Middlewares = append(resource.Middlewares, "rate-limit")
+			limit, err := buildRateLimit(limitConfig)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("endpoint", endpoint.Endpoint).
+					Msg("Invalid rate-limit configuration, refusing requests")
+			}
+			resource.RateLimit = limit
+			continue
+		}
+
+		// Check for ip-filter middleware
+		// Lists that fail to parse are kept without settings, so requests are refused rather than let through
+		if filterConfig, hasFilter := mwMap["ip-filter"]; hasFilter {
+			resource.Middlewares = append(resource.Middlewares, "ip-filter")
+			list, err := buildIPFilter(filterConfig)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("endpoint", endpoint.Endpoint).
+					Msg("Invalid ip-filter configuration, refusing requests")
+			}
+			resource.IPFilter = list
+			continue
+		}
+
+		// Check for concurrency middleware
+		// Limits that fail to parse are kept without settings, so requests are refused rather than let through
+		if limitConfig, hasLimit := mwMap["concurrency"]; hasLimit {
+			resource.Middlewares = append(resource.Middlewares, "concurrency")
+			limit, err := buildConcurrencyLimit(limitConfig)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("endpoint", endpoint.Endpoint).
+					Msg("Invalid concurrency configuration, refusing requests")
+			}
+			resource.Concurrency = limit
+			continue
+		}
+
+		// Check for token-gate middleware
+		// A gate that fails to parse is kept without settings, so requests are refused rather than let through
+		if gateConfig, hasGate := mwMap["token-gate"]; hasGate {
+			resource.Middlewares = append(resource.Middlewares, "token-gate")
+			gate, err := g.buildTokenGateConfig(gateConfig)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("endpoint", endpoint.Endpoint).
+					Msg("Invalid token-gate configuration, refusing requests")
+			}
+			resource.TokenGate = gate
+			continue
+		}
+
+		// Check for x402-buyer middleware
+		if buyerConfig, hasBuyer := mwMap["x402-buyer"]; hasBuyer {
+			resource.Buyer = g.buildBuyerPolicy(endpoint, buyerConfig)
+			if resource.Buyer != nil {
+				resource.Middlewares = append(resource.Middlewares, "x402-buyer")
+			}
+			continue
+		}
 	}
 
 	return resource
 }
 
 // buildX402Config builds a complete X402Config from endpoint config and network info
+// The amount is either given in raw base units (maxAmountRequired) or as a human price
+// such as "0.10 USDC" or "$0.10", which is converted using the network token decimals
 func (g *ResourceGateway) buildX402PaymentRequirements(
 	endpoint *config.EndpointConfig,
-	networkName, payTo, maxAmountRequired string,
+	networkName, payTo, maxAmountRequired, price string,
 ) *types.PaymentRequirements {
 	// Find chain network configuration
-	var chainNetwork *config.ChainNetwork
-	for i := range g.cfg.Facilitator.ChainNetworks {
-		if g.cfg.Facilitator.ChainNetworks[i].Name == networkName {
-			chainNetwork = &g.cfg.Facilitator.ChainNetworks[i]
-			break
-		}
-	}
-
+	chainNetwork := g.FindChainNetwork(networkName)
 	if chainNetwork == nil {
 		log.Warn().
 			Str("network", networkName).
@@ -234,6 +392,27 @@ func (g *ResourceGateway) buildX402PaymentRequirements(
 		return nil
 	}
 
+	if price != "" {
+		if maxAmountRequired != "" {
+			log.Warn().
+				Str("endpoint", endpoint.Endpoint).
+				Msg("Both price and maxAmountRequired are configured, skipping X402 config")
+			return nil
+		}
+
+		amount, err := g.priceToBaseUnits(price, chainNetwork)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("price", price).
+				Str("network", networkName).
+				Str("endpoint", endpoint.Endpoint).
+				Msg("Failed to convert price, skipping X402 config")
+			return nil
+		}
+		maxAmountRequired = amount
+	}
+
 	// Get scheme from facilitator config (use first supported scheme)
 	scheme := "exact"
 	if len(g.cfg.Facilitator.SupportedSchemes) > 0 {
@@ -260,6 +439,152 @@ func (g *ResourceGateway) buildX402PaymentRequirements(
 	}
 }
 
+// buildPassConfig builds the access pass settings of an x402-seller middleware
+// Accepts either `pass: true` or a map with optional `duration` and `group`
+func (g *ResourceGateway) buildPassConfig(endpoint *config.EndpointConfig, passConfig interface{}) *PassConfig {
+	pass := &PassConfig{
+		Duration: g.cfg.Passes.DefaultDuration,
+	}
+
+	switch value := passConfig.(type) {
+	case bool:
+		if !value {
+			return nil
+		}
+	case map[string]interface{}:
+		if durationStr, ok := value["duration"].(string); ok && durationStr != "" {
+			duration, err := time.ParseDuration(durationStr)
+			if err != nil || duration <= 0 {
+				log.Warn().
+					Str("duration", durationStr).
+					Str("endpoint", endpoint.Endpoint).
+					Msg("Invalid pass duration, using default")
+			} else {
+				pass.Duration = duration
+			}
+		}
+		pass.Group, _ = value["group"].(string)
+	default:
+		log.Warn().Str("endpoint", endpoint.Endpoint).Msg("Invalid pass configuration, ignoring")
+		return nil
+	}
+
+	return pass
+}
+
+// buildBuyerPolicy builds the spending policy of an x402-buyer middleware
+// Accepts either `x402-buyer: true` (global policy only) or a map of policy settings.
+// An invalid policy disables buying for the resource, so upstream 402 responses are returned unpaid.
+func (g *ResourceGateway) buildBuyerPolicy(endpoint *config.EndpointConfig, buyerConfig interface{}) *buyer.Policy {
+	var policyConfig config.BuyerPolicyConfig
+
+	switch value := buyerConfig.(type) {
+	case bool:
+		if !value {
+			return nil
+		}
+	case map[string]interface{}:
+		policyConfig.MaxPrice, _ = value["max_price"].(string)
+		policyConfig.HourlyBudget, _ = value["hourly_budget"].(string)
+		policyConfig.DailyBudget, _ = value["daily_budget"].(string)
+		policyConfig.AllowedNetworks = stringList(value["allowed_networks"])
+		policyConfig.AllowedAssets = stringList(value["allowed_assets"])
+		policyConfig.AllowedPayTo = stringList(value["allowed_payto"])
+	default:
+		log.Error().Str("endpoint", endpoint.Endpoint).Msg("Invalid x402-buyer configuration, buying disabled")
+		return nil
+	}
+
+	policy, err := buyer.NewPolicy(policyConfig)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("endpoint", endpoint.Endpoint).
+			Msg("Invalid x402-buyer policy, buying disabled")
+		return nil
+	}
+	return policy
+}
+
+// stringList converts a list from a middleware config map into strings
+func stringList(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// FindChainNetwork finds a chain network configuration by name
+func (g *ResourceGateway) FindChainNetwork(networkName string) *config.ChainNetwork {
+	for i := range g.cfg.Facilitator.ChainNetworks {
+		if g.cfg.Facilitator.ChainNetworks[i].Name == networkName {
+			return &g.cfg.Facilitator.ChainNetworks[i]
+		}
+	}
+	return nil
+}
+
+// PaymentValueUSD returns the USD value of the amount in payment requirements
+func (g *ResourceGateway) PaymentValueUSD(requirements *types.PaymentRequirements) (*big.Rat, error) {
+	chainNetwork := g.FindChainNetwork(requirements.Network)
+	if chainNetwork == nil {
+		return nil, fmt.Errorf("chain network %s not found in configuration", requirements.Network)
+	}
+
+	amount, ok := new(big.Int).SetString(requirements.MaxAmountRequired, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid payment amount %q", requirements.MaxAmountRequired)
+	}
+	return g.rates.ToUSD(amount, chainNetwork)
+}
+
+// ResourcesUsingRate returns the endpoints whose x402-seller price can only be converted with the rate of symbol
+// Deleting that rate would leave them without payment requirements.
+func (g *ResourceGateway) ResourcesUsingRate(symbol string) []string {
+	without := g.rates.Without(symbol)
+
+	var endpoints []string
+	for _, endpoint := range g.cfg.Resources {
+		for _, mwMap := range endpoint.Middlewares {
+			sellerMap, ok := mwMap["x402-seller"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			network, _ := sellerMap["network"].(string)
+			price, _ := sellerMap["price"].(string)
+			chainNetwork := g.FindChainNetwork(network)
+			parsed, err := pricing.ParsePrice(price)
+			if chainNetwork == nil || err != nil {
+				continue
+			}
+			// Prices that cannot be converted today do not depend on this rate
+			if _, err := g.rates.AmountForNetwork(parsed, chainNetwork); err != nil {
+				continue
+			}
+			if _, err := without.AmountForNetwork(parsed, chainNetwork); err != nil {
+				endpoints = append(endpoints, endpoint.Endpoint)
+			}
+		}
+	}
+	return endpoints
+}
+
+// priceToBaseUnits converts a human price into base units of the network token
+func (g *ResourceGateway) priceToBaseUnits(price string, chainNetwork *config.ChainNetwork) (string, error) {
+	parsed, err := pricing.ParsePrice(price)
+	if err != nil {
+		return "", err
+	}
+	return g.rates.AmountForNetwork(parsed, chainNetwork)
+}
+
 // ReloadResourcesIfNeeded reloads resources from configuration
 // Since we're now reading from config, we can always reload
 func (g *ResourceGateway) ReloadResourcesIfNeeded() error {
@@ -340,7 +665,24 @@ func (g *ResourceGateway) ProxyRequest(c *gin.Context, resource *ResourceConfig)
 		return
 	}
 
-	arp := NewAgentReverseProxy(c, targetURL)
-	arp.AddInterceptor(X402BuyerInterceptor(&g.cfg.Facilitator))
+	arp := NewAgentReverseProxy(c, targetURL, resource.Resource)
+	if resource.Buyer != nil {
+		// Payments are charged to the calling client
+		g.identifyBuyerClient(c)
+
+		// Buffer the body before the first attempt so the paid retry can replay it
+		body, err := BufferRequestBody(c.Request, g.cfg.Buyer.Replay)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.ErrorResponse{
+				Error:   "invalid_request_body",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		defer body.Close()
+
+		arp.AddInterceptor(X402BuyerInterceptor(g, resource, body))
+	}
 	arp.ServeHTTP(c.Writer, c.Request)
 }
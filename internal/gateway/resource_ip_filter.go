@@ -0,0 +1,25 @@
+package gateway
+
+import (
+	"fmt"
+
+	"go-agent-guide/internal/ipfilter"
+)
+
+// buildIPFilter parses the settings of an ip-filter middleware
+func buildIPFilter(filterConfig interface{}) (*ipfilter.List, error) {
+	filterMap, ok := filterConfig.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("ip-filter settings must be a map")
+	}
+
+	allow, deny := stringList(filterMap["allow"]), stringList(filterMap["deny"])
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, fmt.Errorf("at least one of allow and deny is required")
+	}
+	list, err := ipfilter.ParseList(allow, deny)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"go-agent-guide/internal/ratelimit"
+)
+
+// buildRateLimit parses the settings of a rate-limit middleware
+func buildRateLimit(limitConfig interface{}) (*ratelimit.Limit, error) {
+	limitMap, ok := limitConfig.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rate-limit settings must be a map")
+	}
+
+	limit := &ratelimit.Limit{Key: ratelimit.KeyIP}
+	if key, ok := limitMap["key"].(string); ok && key != "" {
+		limit.Key = key
+	}
+	if !ratelimit.ValidKey(limit.Key) {
+		return nil, fmt.Errorf("invalid key %q (valid keys: ip, api_key, identity, payer)", limit.Key)
+	}
+
+	var err error
+	if limit.Rate, err = numericSetting(limitMap, "rate"); err != nil {
+		return nil, err
+	}
+	burst, err := numericSetting(limitMap, "burst")
+	if err != nil {
+		return nil, err
+	}
+	daily, err := numericSetting(limitMap, "daily_quota")
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := numericSetting(limitMap, "monthly_quota")
+	if err != nil {
+		return nil, err
+	}
+	limit.Burst, limit.Daily, limit.Monthly = int(burst), int64(daily), int64(monthly)
+
+	if limit.Rate == 0 && limit.Daily == 0 && limit.Monthly == 0 {
+		return nil, fmt.Errorf("at least one of rate, daily_quota and monthly_quota is required")
+	}
+	// The bucket holds at least one second of requests by default
+	if limit.Rate > 0 && limit.Burst == 0 {
+		limit.Burst = int(math.Max(1, math.Ceil(limit.Rate)))
+	}
+
+	return limit, nil
+}
+
+// numericSetting reads an optional non-negative number from a middleware config map
+// YAML numbers arrive as int or float64; strings such as "0.5" are accepted too
+func numericSetting(settings map[string]interface{}, key string) (float64, error) {
+	var value float64
+	switch v := settings[key].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		value = float64(v)
+	case int64:
+		value = float64(v)
+	case float64:
+		value = v
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", key, v)
+		}
+		value = parsed
+	default:
+		return 0, fmt.Errorf("invalid %s %v", key, v)
+	}
+	if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,291 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Token standards a token gate can check
+const (
+	TokenStandardERC20  = "erc20"  // Balance of at least min_balance base units
+	TokenStandardERC721 = "erc721" // At least min_balance NFTs, or ownership of token_id
+)
+
+// TokenGateFallbackSeller lets non-holders pay through x402-seller instead of being refused
+const TokenGateFallbackSeller = "x402-seller"
+
+const (
+	defaultTokenGateCacheTTL = 5 * time.Minute
+	tokenGateCallTimeout     = 10 * time.Second
+)
+
+// tokenGateABI holds the ERC-20 and ERC-721 view functions used by token gates
+var tokenGateABI = mustParseABI(`[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"address"}]}
+]`)
+
+// TokenGateConfig represents the token-gate settings of a resource
+type TokenGateConfig struct {
+	Network    string        `json:"network"`            // Chain network the contract is deployed on
+	Standard   string        `json:"standard"`           // "erc20" or "erc721"
+	Contract   string        `json:"contract"`           // Token contract, defaults to the network token for erc20
+	MinBalance *big.Int      `json:"minBalance"`         // Required balance in base units (erc20) or number of NFTs (erc721)
+	TokenID    *big.Int      `json:"tokenId,omitempty"`  // If set, the wallet must own this NFT
+	CacheTTL   time.Duration `json:"cacheTtl"`           // How long a holdings check is reused
+	Fallback   string        `json:"fallback,omitempty"` // "x402-seller" lets non-holders pay instead
+}
+
+// HoldingsDialer connects to the chain network of a token gate
+// *ethclient.Client implements bind.ContractCaller, and so do simulated backends
+type HoldingsDialer func(ctx context.Context, network *config.ChainNetwork) (bind.ContractCaller, error)
+
+// DialChainNetwork connects to the RPC endpoint of a chain network
+func DialChainNetwork(ctx context.Context, network *config.ChainNetwork) (bind.ContractCaller, error) {
+	return ethclient.DialContext(ctx, network.RPC)
+}
+
+// holdingsEntry is a cached token gate decision
+type holdingsEntry struct {
+	holds     bool
+	expiresAt time.Time
+}
+
+// TokenGateChecker checks token holdings on-chain and caches the decisions
+type TokenGateChecker struct {
+	dial HoldingsDialer
+
+	mu        sync.Mutex
+	clients   map[string]bind.ContractCaller // By network name
+	cache     map[string]holdingsEntry
+	lastSweep time.Time
+}
+
+// NewTokenGateChecker creates a holdings checker that connects to networks with dial
+func NewTokenGateChecker(dial HoldingsDialer) *TokenGateChecker {
+	return &TokenGateChecker{
+		dial:    dial,
+		clients: make(map[string]bind.ContractCaller),
+		cache:   make(map[string]holdingsEntry),
+	}
+}
+
+// Holds reports whether address meets the holdings threshold of a token gate
+// Decisions are cached for the gate's cache TTL; failed calls are not cached
+func (t *TokenGateChecker) Holds(ctx context.Context, network *config.ChainNetwork, gate *TokenGateConfig, address common.Address) (bool, error) {
+	key := strings.ToLower(fmt.Sprintf("%s|%s|%s|%s|%v|%s", network.Name, gate.Standard, gate.Contract, gate.MinBalance, gate.TokenID, address.Hex()))
+	now := time.Now()
+
+	t.mu.Lock()
+	if entry, exists := t.cache[key]; exists && now.Before(entry.expiresAt) {
+		t.mu.Unlock()
+		return entry.holds, nil
+	}
+	t.mu.Unlock()
+
+	caller, err := t.client(ctx, network)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tokenGateCallTimeout)
+	defer cancel()
+
+	holds, err := checkHoldings(ctx, caller, gate, address)
+	if err != nil {
+		return false, fmt.Errorf("failed to check holdings on %s: %w", network.Name, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweepLocked(now)
+	t.cache[key] = holdingsEntry{holds: holds, expiresAt: now.Add(gate.CacheTTL)}
+	return holds, nil
+}
+
+// client returns the connection to a network, dialing it on first use
+func (t *TokenGateChecker) client(ctx context.Context, network *config.ChainNetwork) (bind.ContractCaller, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if caller, exists := t.clients[network.Name]; exists {
+		return caller, nil
+	}
+	caller, err := t.dial(ctx, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", network.Name, err)
+	}
+	t.clients[network.Name] = caller
+	return caller, nil
+}
+
+// sweepLocked drops expired decisions at most once a minute; callers must hold t.mu
+func (t *TokenGateChecker) sweepLocked(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	for key, entry := range t.cache {
+		if !now.Before(entry.expiresAt) {
+			delete(t.cache, key)
+		}
+	}
+}
+
+// checkHoldings reads the balance or NFT owner from the token contract
+func checkHoldings(ctx context.Context, caller bind.ContractCaller, gate *TokenGateConfig, address common.Address) (bool, error) {
+	contract := common.HexToAddress(gate.Contract)
+
+	if gate.Standard == TokenStandardERC721 && gate.TokenID != nil {
+		result, err := callContract(ctx, caller, contract, "ownerOf", gate.TokenID)
+		if err != nil {
+			// ownerOf reverts for tokens that do not exist, so nobody holds them
+			if strings.Contains(err.Error(), "execution reverted") {
+				return false, nil
+			}
+			return false, err
+		}
+		owner, ok := result[0].(common.Address)
+		if !ok {
+			return false, fmt.Errorf("unexpected ownerOf result")
+		}
+		return owner == address, nil
+	}
+
+	result, err := callContract(ctx, caller, contract, "balanceOf", address)
+	if err != nil {
+		return false, err
+	}
+	balance, ok := result[0].(*big.Int)
+	if !ok {
+		return false, fmt.Errorf("unexpected balanceOf result")
+	}
+	return balance.Cmp(gate.MinBalance) >= 0, nil
+}
+
+// callContract calls a view function of tokenGateABI at the latest block
+func callContract(ctx context.Context, caller bind.ContractCaller, contract common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := tokenGateABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := caller.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("%s returned no data; is %s a token contract?", method, contract.Hex())
+	}
+	return tokenGateABI.Unpack(method, output)
+}
+
+// CheckTokenGate reports whether a wallet meets the token gate of a resource
+func (g *ResourceGateway) CheckTokenGate(ctx context.Context, resource *ResourceConfig, address string) (bool, error) {
+	gate := resource.TokenGate
+	network := g.FindChainNetwork(gate.Network)
+	if network == nil {
+		return false, fmt.Errorf("chain network %s not found", gate.Network)
+	}
+	return g.tokenGates.Holds(ctx, network, gate, common.HexToAddress(address))
+}
+
+// buildTokenGateConfig parses the settings of a token-gate middleware
+func (g *ResourceGateway) buildTokenGateConfig(gateConfig interface{}) (*TokenGateConfig, error) {
+	gateMap, ok := gateConfig.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("token-gate settings must be a map")
+	}
+
+	gate := &TokenGateConfig{CacheTTL: defaultTokenGateCacheTTL}
+	gate.Network, _ = gateMap["network"].(string)
+	gate.Standard, _ = gateMap["standard"].(string)
+	gate.Contract, _ = gateMap["contract"].(string)
+	gate.Fallback, _ = gateMap["fallback"].(string)
+
+	network := g.FindChainNetwork(gate.Network)
+	if network == nil {
+		return nil, fmt.Errorf("chain network %q not found", gate.Network)
+	}
+
+	switch gate.Standard {
+	case "", TokenStandardERC20:
+		gate.Standard = TokenStandardERC20
+		if gate.Contract == "" {
+			gate.Contract = network.TokenAddress
+		}
+	case TokenStandardERC721:
+		if tokenID := numberSetting(gateMap["token_id"]); tokenID != "" {
+			id, ok := new(big.Int).SetString(tokenID, 10)
+			if !ok || id.Sign() < 0 {
+				return nil, fmt.Errorf("invalid token_id %q", tokenID)
+			}
+			gate.TokenID = id
+		}
+	default:
+		return nil, fmt.Errorf("invalid standard %q (valid standards: erc20, erc721)", gate.Standard)
+	}
+	if !common.IsHexAddress(gate.Contract) {
+		return nil, fmt.Errorf("invalid contract %q", gate.Contract)
+	}
+
+	gate.MinBalance = big.NewInt(1)
+	if minBalance := numberSetting(gateMap["min_balance"]); minBalance != "" {
+		value, ok := new(big.Int).SetString(minBalance, 10)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid min_balance %q", minBalance)
+		}
+		gate.MinBalance = value
+	}
+
+	ttl, err := durationSetting(gateMap, "cache_ttl")
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		gate.CacheTTL = ttl
+	}
+
+	if gate.Fallback != "" && gate.Fallback != TokenGateFallbackSeller {
+		return nil, fmt.Errorf("invalid fallback %q (valid fallbacks: %s)", gate.Fallback, TokenGateFallbackSeller)
+	}
+
+	return gate, nil
+}
+
+// numberSetting reads an integer setting given either as a YAML number or a string
+func numberSetting(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return fmt.Sprint(v)
+	case int64:
+		return fmt.Sprint(v)
+	case uint64:
+		return fmt.Sprint(v)
+	case float64:
+		return new(big.Float).SetFloat64(v).Text('f', 0)
+	}
+	return ""
+}
+
+// mustParseABI parses a contract ABI definition known at compile time
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("invalid contract ABI: %v", err))
+	}
+	return parsed
+}
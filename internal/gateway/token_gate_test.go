@@ -0,0 +1,253 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// testGateCode is the runtime code of a minimal ERC-20/ERC-721 token: both balanceOf and ownerOf
+// return the storage slot named by their argument, and ownerOf reverts when the slot is empty
+var testGateCode = common.FromHex("600435548015600035" + "60e01c" + "636352211e" + "1416" + "601e57" + "600052" + "60206000f3" + "5b600080fd")
+
+var testGateContract = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+var testGateNetwork = &config.ChainNetwork{Name: "simulated", ID: 1337, TokenAddress: testGateContract.Hex()}
+
+// countingCaller counts the contract calls made through it
+type countingCaller struct {
+	bind.ContractCaller
+	calls atomic.Int64
+}
+
+func (c *countingCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls.Add(1)
+	return c.ContractCaller.CallContract(ctx, call, blockNumber)
+}
+
+// newTestGateChain starts a simulated chain with testGateCode deployed at testGateContract
+// balances are ERC-20 balances or NFT counts by holder; owners are NFT owners by token ID
+func newTestGateChain(t *testing.T, balances map[common.Address]int64, owners map[int64]common.Address) *countingCaller {
+	t.Helper()
+	storage := make(map[common.Hash]common.Hash)
+	for address, balance := range balances {
+		storage[common.BytesToHash(address.Bytes())] = common.BigToHash(big.NewInt(balance))
+	}
+	for tokenID, owner := range owners {
+		storage[common.BigToHash(big.NewInt(tokenID))] = common.BytesToHash(owner.Bytes())
+	}
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		testGateContract: {Code: testGateCode, Storage: storage, Balance: new(big.Int)},
+	}, 8_000_000)
+	t.Cleanup(func() { backend.Close() })
+	return &countingCaller{ContractCaller: backend}
+}
+
+// dialer returns a HoldingsDialer connecting to caller
+func dialer(caller bind.ContractCaller) HoldingsDialer {
+	return func(context.Context, *config.ChainNetwork) (bind.ContractCaller, error) {
+		return caller, nil
+	}
+}
+
+func TestTokenGateERC20Thresholds(t *testing.T) {
+	holder := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	rich := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	short := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	nobody := common.HexToAddress("0x1000000000000000000000000000000000000004")
+	caller := newTestGateChain(t, map[common.Address]int64{holder: 1_000_000, rich: 5_000_000, short: 999_999}, nil)
+	checker := NewTokenGateChecker(dialer(caller))
+
+	gate := &TokenGateConfig{
+		Network:    testGateNetwork.Name,
+		Standard:   TokenStandardERC20,
+		Contract:   testGateContract.Hex(),
+		MinBalance: big.NewInt(1_000_000),
+		CacheTTL:   time.Minute,
+	}
+	for address, want := range map[common.Address]bool{holder: true, rich: true, short: false, nobody: false} {
+		holds, err := checker.Holds(context.Background(), testGateNetwork, gate, address)
+		if err != nil {
+			t.Fatalf("Holds(%s): %v", address.Hex(), err)
+		}
+		if holds != want {
+			t.Errorf("Holds(%s) = %v, want %v", address.Hex(), holds, want)
+		}
+	}
+}
+
+func TestTokenGateERC721(t *testing.T) {
+	owner := common.HexToAddress("0x2000000000000000000000000000000000000001")
+	other := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	caller := newTestGateChain(t, map[common.Address]int64{owner: 2, other: 1}, map[int64]common.Address{7: owner})
+	checker := NewTokenGateChecker(dialer(caller))
+	ctx := context.Background()
+
+	gate := func(tokenID *big.Int, minBalance int64) *TokenGateConfig {
+		return &TokenGateConfig{
+			Network:    testGateNetwork.Name,
+			Standard:   TokenStandardERC721,
+			Contract:   testGateContract.Hex(),
+			MinBalance: big.NewInt(minBalance),
+			TokenID:    tokenID,
+			CacheTTL:   time.Minute,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		gate    *TokenGateConfig
+		address common.Address
+		want    bool
+	}{
+		{"owner of the token", gate(big.NewInt(7), 1), owner, true},
+		{"not the owner", gate(big.NewInt(7), 1), other, false},
+		// ownerOf reverts for a token that was never minted
+		{"nonexistent token", gate(big.NewInt(8), 1), owner, false},
+		{"enough NFTs", gate(nil, 2), owner, true},
+		{"too few NFTs", gate(nil, 2), other, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holds, err := checker.Holds(ctx, testGateNetwork, tt.gate, tt.address)
+			if err != nil {
+				t.Fatalf("Holds: %v", err)
+			}
+			if holds != tt.want {
+				t.Errorf("Holds = %v, want %v", holds, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenGateCacheTTL(t *testing.T) {
+	holder := common.HexToAddress("0x3000000000000000000000000000000000000001")
+	caller := newTestGateChain(t, map[common.Address]int64{holder: 1}, nil)
+	checker := NewTokenGateChecker(dialer(caller))
+	ctx := context.Background()
+
+	gate := &TokenGateConfig{
+		Network:    testGateNetwork.Name,
+		Standard:   TokenStandardERC20,
+		Contract:   testGateContract.Hex(),
+		MinBalance: big.NewInt(1),
+		CacheTTL:   time.Minute,
+	}
+	for i := 0; i < 3; i++ {
+		if holds, err := checker.Holds(ctx, testGateNetwork, gate, holder); err != nil || !holds {
+			t.Fatalf("Holds = %v, %v, want true", holds, err)
+		}
+	}
+	if got := caller.calls.Load(); got != 1 {
+		t.Fatalf("calls = %d, want 1 within the cache TTL", got)
+	}
+
+	// Another threshold is another decision
+	stricter := *gate
+	stricter.MinBalance = big.NewInt(2)
+	if holds, err := checker.Holds(ctx, testGateNetwork, &stricter, holder); err != nil || holds {
+		t.Fatalf("Holds with min_balance 2 = %v, %v, want false", holds, err)
+	}
+	if got := caller.calls.Load(); got != 2 {
+		t.Fatalf("calls = %d, want 2", got)
+	}
+
+	checker.mu.Lock()
+	for key, entry := range checker.cache {
+		entry.expiresAt = time.Now().Add(-time.Second)
+		checker.cache[key] = entry
+	}
+	checker.mu.Unlock()
+
+	if holds, err := checker.Holds(ctx, testGateNetwork, gate, holder); err != nil || !holds {
+		t.Fatalf("Holds after expiry = %v, %v, want true", holds, err)
+	}
+	if got := caller.calls.Load(); got != 3 {
+		t.Fatalf("calls = %d, want 3 after the cache TTL", got)
+	}
+}
+
+// failingCaller fails every call like an unreachable RPC endpoint
+type failingCaller struct {
+	bind.ContractCaller
+	calls atomic.Int64
+}
+
+func (c *failingCaller) CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error) {
+	c.calls.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func TestTokenGateErrorsAreNotCached(t *testing.T) {
+	caller := &failingCaller{}
+	checker := NewTokenGateChecker(dialer(caller))
+	gate := &TokenGateConfig{
+		Network:    testGateNetwork.Name,
+		Standard:   TokenStandardERC20,
+		Contract:   testGateContract.Hex(),
+		MinBalance: big.NewInt(1),
+		CacheTTL:   time.Minute,
+	}
+	address := common.HexToAddress("0x4000000000000000000000000000000000000001")
+
+	for i := 0; i < 2; i++ {
+		if _, err := checker.Holds(context.Background(), testGateNetwork, gate, address); err == nil {
+			t.Fatal("Holds succeeded, want the RPC error")
+		}
+	}
+	if got := caller.calls.Load(); got != 2 {
+		t.Fatalf("calls = %d, want 2", got)
+	}
+
+	dialErr := NewTokenGateChecker(func(context.Context, *config.ChainNetwork) (bind.ContractCaller, error) {
+		return nil, errors.New("dial failed")
+	})
+	if _, err := dialErr.Holds(context.Background(), testGateNetwork, gate, address); err == nil {
+		t.Fatal("Holds succeeded, want the dial error")
+	}
+}
+
+func TestBuildTokenGateConfig(t *testing.T) {
+	g := &ResourceGateway{cfg: &config.Config{}}
+	g.cfg.Facilitator.ChainNetworks = []config.ChainNetwork{*testGateNetwork}
+
+	gate, err := g.buildTokenGateConfig(map[string]interface{}{
+		"network":     "simulated",
+		"min_balance": 1000000,
+		"cache_ttl":   "30s",
+		"fallback":    "x402-seller",
+	})
+	if err != nil {
+		t.Fatalf("buildTokenGateConfig: %v", err)
+	}
+	if gate.Standard != TokenStandardERC20 || gate.Contract != testGateContract.Hex() {
+		t.Errorf("gate = %s %s, want erc20 on the network token", gate.Standard, gate.Contract)
+	}
+	if gate.MinBalance.Int64() != 1_000_000 || gate.CacheTTL != 30*time.Second || gate.Fallback != TokenGateFallbackSeller {
+		t.Errorf("gate = %+v", gate)
+	}
+
+	for name, settings := range map[string]map[string]interface{}{
+		"unknown network":  {"network": "mainnet"},
+		"unknown standard": {"network": "simulated", "standard": "erc1155"},
+		"erc721 contract":  {"network": "simulated", "standard": "erc721"},
+		"zero min_balance": {"network": "simulated", "min_balance": "0"},
+		"bad token_id":     {"network": "simulated", "standard": "erc721", "contract": testGateContract.Hex(), "token_id": "-1"},
+		"unknown fallback": {"network": "simulated", "fallback": "credits"},
+	} {
+		if _, err := g.buildTokenGateConfig(settings); err == nil {
+			t.Errorf("%s: buildTokenGateConfig succeeded, want an error", name)
+		}
+	}
+}
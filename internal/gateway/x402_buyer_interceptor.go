@@ -1,81 +1,57 @@
 package gateway
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 
+	"go-agent-guide/internal/buyer"
 	"go-agent-guide/internal/config"
-	"github.com/agent-guide/go-x402-facilitator/pkg/client"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
-	"github.com/agent-guide/go-x402-facilitator/pkg/utils"
 
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
 
 // PaymentRequiredResponse represents the 402 Payment Required response
+// Sellers list their payment options in accepts; a single paymentRequirements object is also understood
 type paymentRequiredResponse struct {
-	Error               string                    `json:"error"`
-	Message             string                    `json:"message"`
-	Code                int                       `json:"code"`
-	PaymentRequirements types.PaymentRequirements `json:"paymentRequirements"`
+	X402Version         int                  `json:"x402Version,omitempty"`
+	Error               string               `json:"error"`
+	Message             string               `json:"message"`
+	Code                int                  `json:"code"`
+	Accepts             []buyer.PaymentOffer `json:"accepts,omitempty"`
+	PaymentRequirements *buyer.PaymentOffer  `json:"paymentRequirements,omitempty"`
 }
 
-// findChainNetwork finds a chain network configuration by name
-func findChainNetwork(facilitatorConfig *config.FacilitatorConfig, networkName string) *config.ChainNetwork {
-	for i := range facilitatorConfig.ChainNetworks {
-		if facilitatorConfig.ChainNetworks[i].Name == networkName {
-			return &facilitatorConfig.ChainNetworks[i]
-		}
+// options returns the payment options offered by the seller
+func (r *paymentRequiredResponse) options() []buyer.PaymentOffer {
+	options := r.Accepts
+	if r.PaymentRequirements != nil {
+		options = append(options, *r.PaymentRequirements)
 	}
-	return nil
+	return options
 }
 
-// createPaymentPayload creates a payment payload using the configured private key
-func createPaymentPayload(
-	facilitatorConfig *config.FacilitatorConfig,
-	requirements *types.PaymentRequirements,
+// createPaymentPayload creates a payment payload signed by the buyer wallet of the network
+func (g *ResourceGateway) createPaymentPayload(
+	wallet *buyer.Wallet,
+	chainNetwork *config.ChainNetwork,
+	offer *buyer.PaymentOffer,
 ) (*types.PaymentPayload, error) {
-	// Get chain ID from chain_networks
-	chainNetwork := findChainNetwork(facilitatorConfig, requirements.Network)
-	if chainNetwork == nil {
-		return nil, fmt.Errorf("chain network %s not found in configuration", requirements.Network)
-	}
-	chainID := chainNetwork.ID
-
-	// Create account from private key
-	account, err := utils.NewAccountWithPrivateKey(chainNetwork.RPC, requirements.Asset, facilitatorConfig.PrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create web3 account: %w", err)
-	}
-
-	// Generate payment payload
-	var validDuration int64 = 300
-	now := time.Now().Unix()
-	validAfter := now - 600000
-	validBefore := now + validDuration
-
-	// Generate nonce
-	nonce := fmt.Sprintf(
-		"0x%x",
-		crypto.Keccak256Hash([]byte(fmt.Sprintf("%d-%s-%s", now, account.WalletAddress.Hex(), requirements.PayTo))).Hex(),
-	)
-
-	return client.CreatePaymentPayload(
-		requirements,
-		account,
-		validAfter,
-		validBefore,
-		chainID,
-		nonce,
-	)
+	return buyer.CreatePayment(offer, wallet.PrivateKey(), chainNetwork.ID, buyer.ValidityWindow{
+		ValidFor:  g.cfg.Buyer.Authorization.ValidFor,
+		ClockSkew: g.cfg.Buyer.Authorization.ClockSkew,
+	})
 }
 
-func X402BuyerInterceptor(facilitatorConfig *config.FacilitatorConfig) InterceptorFunc {
+// X402BuyerInterceptor pays upstream 402 responses of a resource within the buyer policies
+// and replays the original request with the payment attached.
+// Payments that violate a policy or exceed a budget, or requests whose body cannot be replayed, are rejected without paying
+func X402BuyerInterceptor(g *ResourceGateway, resource *ResourceConfig, body *ReplayBody) InterceptorFunc {
 
 	return func(capture *ResponseCapture, arp *AgentReverseProxy) bool {
 		if capture.statusCode != http.StatusPaymentRequired {
@@ -96,9 +72,56 @@ func X402BuyerInterceptor(facilitatorConfig *config.FacilitatorConfig) Intercept
 			return true
 		}
 
+		// Never pay for a request that cannot be sent again
+		if !body.Replayable() {
+			log.Warn().
+				Str("resource", resource.Resource).
+				Int64("max_body", g.cfg.Buyer.Replay.MaxBody).
+				Msg("Request body too large to replay, not paying")
+			c.JSON(http.StatusRequestEntityTooLarge, types.ErrorResponse{
+				Error:   "request_not_replayable",
+				Message: fmt.Sprintf("Payment required, but the request body exceeds the replay limit of %d bytes", g.cfg.Buyer.Replay.MaxBody),
+				Code:    http.StatusRequestEntityTooLarge,
+			})
+			return true
+		}
+
+		// Choose which of the offered payment options to pay
+		client := buyerClientOf(c)
+		offer, reason, err := g.selectPaymentOption(c.Request.Context(), resource, client, paymentResp.options())
+		if err != nil {
+			rejectBuyerPayment(c, resource, &types.PaymentRequirements{}, err)
+			return true
+		}
+		requirements := &offer.PaymentRequirements
+		log.Info().
+			Str("resource", resource.Resource).
+			Str("client", client.Name).
+			Str("network", requirements.Network).
+			Str("scheme", requirements.Scheme).
+			Str("asset", requirements.Asset).
+			Str("amount", requirements.MaxAmountRequired).
+			Str("reason", reason).
+			Msg("Selected payment option")
+
+		// Enforce the buyer policies and budgets before anything is signed
+		wallet, spend, err := g.authorizeBuyerPayment(resource, client, requirements)
+		if err != nil {
+			rejectBuyerPayment(c, resource, requirements, err)
+			return true
+		}
+
+		// Large payments wait for an operator; the spend stays reserved meanwhile
+		if err := g.awaitBuyerApproval(c, resource, targetURL, requirements, spend); err != nil {
+			releaseBuyerSpend(g, spend)
+			rejectBuyerPayment(c, resource, requirements, err)
+			return true
+		}
+
 		// Create payment payload
-		paymentPayload, err := createPaymentPayload(facilitatorConfig, &paymentResp.PaymentRequirements)
+		paymentPayload, err := g.createPaymentPayload(wallet, g.FindChainNetwork(requirements.Network), offer)
 		if err != nil {
+			releaseBuyerSpend(g, spend)
 			log.Error().Err(err).Msg("Failed to create payment payload")
 			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
 				Error:   "payment_creation_failed",
@@ -111,6 +134,7 @@ func X402BuyerInterceptor(facilitatorConfig *config.FacilitatorConfig) Intercept
 		// Serialize payment payload to JSON
 		paymentJSON, err := json.Marshal(paymentPayload)
 		if err != nil {
+			releaseBuyerSpend(g, spend)
 			log.Error().Err(err).Msg("Failed to marshal payment payload")
 			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
 				Error:   "payment_serialization_failed",
@@ -120,25 +144,33 @@ func X402BuyerInterceptor(facilitatorConfig *config.FacilitatorConfig) Intercept
 			return true
 		}
 
-		log.Info().Msg("Payment payload created, retrying request with payment")
-
-		// Create a new request with X-Payment header
-		// We need to recreate the request body if it exists
-		var bodyReader io.Reader
-		if c.Request.Body != nil {
-			bodyBytes, err := io.ReadAll(c.Request.Body)
-			if err == nil {
-				bodyReader = bytes.NewReader(bodyBytes)
-			}
+		// Nothing is sent upstream without a ledger entry
+		payment, err := g.recordBuyerPayment(c, resource, targetURL, requirements, paymentPayload, wallet, spend)
+		if err != nil {
+			releaseBuyerSpend(g, spend)
+			log.Error().Err(err).Msg("Failed to record buyer payment")
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "payment_record_failed",
+				Message: fmt.Sprintf("Failed to record payment: %s", err.Error()),
+				Code:    http.StatusInternalServerError,
+			})
+			return true
 		}
 
-		retryReq, err := http.NewRequestWithContext(
-			c.Request.Context(),
-			c.Request.Method,
-			targetURL.String(),
-			bodyReader,
-		)
+		log.Info().
+			Str("payment_id", payment.ID).
+			Str("resource", resource.Resource).
+			Str("network", requirements.Network).
+			Str("pay_to", requirements.PayTo).
+			Str("payer", wallet.Address.Hex()).
+			Str("amount", requirements.MaxAmountRequired).
+			Str("usd", spend.USD).
+			Msg("Payment payload created, retrying request with payment")
+
+		// Replay the original request (method, path, query, headers and body) with the payment attached
+		bodyReader, err := body.Reader()
 		if err != nil {
+			g.completeBuyerPayment(payment, spend, http.StatusPaymentRequired, nil)
 			log.Error().Err(err).Msg("Failed to create retry request")
 			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
 				Error:   "retry_request_failed",
@@ -147,14 +179,80 @@ func X402BuyerInterceptor(facilitatorConfig *config.FacilitatorConfig) Intercept
 			})
 			return true
 		}
+		retryReq := c.Request.Clone(c.Request.Context())
+		retryReq.Body = bodyReader
 
 		// Add X-Payment header
 		retryReq.Header.Set("X-Payment", string(paymentJSON))
 
-		retryProxy := NewAgentReverseProxy(c, targetURL)
+		retryProxy := NewAgentReverseProxy(c, targetURL, resource.Resource)
 
 		// Execute the retry request directly to the original writer
 		retryProxy.ServeHTTP(c.Writer, retryReq)
+
+		g.completeBuyerPayment(payment, spend, c.Writer.Status(), c.Writer.Header())
 		return true
 	}
 }
+
+// rejectBuyerPayment responds to a payment request that the buyer policies do not allow
+func rejectBuyerPayment(c *gin.Context, resource *ResourceConfig, requirements *types.PaymentRequirements, err error) {
+	log.Warn().
+		Err(err).
+		Str("resource", resource.Resource).
+		Str("network", requirements.Network).
+		Str("pay_to", requirements.PayTo).
+		Str("amount", requirements.MaxAmountRequired).
+		Msg("Upstream payment request rejected by buyer policy")
+
+	var budgetErr *buyer.BudgetExceededError
+	switch {
+	case errors.As(err, &budgetErr):
+		if budgetErr.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(budgetErr.RetryAfter.Seconds()))))
+		}
+		c.JSON(http.StatusTooManyRequests, types.ErrorResponse{
+			Error:   "buyer_budget_exceeded",
+			Message: err.Error(),
+			Code:    http.StatusTooManyRequests,
+		})
+	case errors.Is(err, buyer.ErrInsufficientBalance):
+		c.JSON(http.StatusServiceUnavailable, types.ErrorResponse{
+			Error:   "buyer_insufficient_balance",
+			Message: err.Error(),
+			Code:    http.StatusServiceUnavailable,
+		})
+	case errors.Is(err, buyer.ErrApprovalDenied):
+		c.JSON(http.StatusForbidden, types.ErrorResponse{
+			Error:   "buyer_payment_denied",
+			Message: err.Error(),
+			Code:    http.StatusForbidden,
+		})
+	case errors.Is(err, buyer.ErrApprovalTimeout):
+		c.JSON(http.StatusGatewayTimeout, types.ErrorResponse{
+			Error:   "buyer_approval_timeout",
+			Message: err.Error(),
+			Code:    http.StatusGatewayTimeout,
+		})
+	case errors.Is(err, buyer.ErrPolicyViolation):
+		c.JSON(http.StatusForbidden, types.ErrorResponse{
+			Error:   "buyer_policy_violation",
+			Message: err.Error(),
+			Code:    http.StatusForbidden,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: fmt.Sprintf("Failed to authorize payment: %s", err.Error()),
+			Code:    http.StatusInternalServerError,
+		})
+	}
+}
+
+// releaseBuyerSpend returns a reserved spend to the budgets and the wallet balance when no payment was taken
+func releaseBuyerSpend(g *ResourceGateway, spend *buyer.Spend) {
+	g.buyerOptions.Balances.Release(spend.Network, spend.Amount)
+	if err := g.buyerOptions.Budgets.Release(spend.ID); err != nil {
+		log.Error().Err(err).Str("spend_id", spend.ID).Msg("Failed to release buyer spend")
+	}
+}
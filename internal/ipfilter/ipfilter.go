@@ -0,0 +1,309 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// DefaultReloadInterval is how often the lists file is checked for changes when the config sets no interval
+const DefaultReloadInterval = 10 * time.Second
+
+// List represents a CIDR allow list and deny list
+// Deny entries win; an empty allow list allows every address that is not denied.
+type List struct {
+	Allow []netip.Prefix `json:"allow"`
+	Deny  []netip.Prefix `json:"deny"`
+}
+
+// ParseList parses allow and deny entries, each a CIDR or a single IP address
+func ParseList(allow, deny []string) (List, error) {
+	var list List
+	var err error
+	if list.Allow, err = ParsePrefixes(allow); err != nil {
+		return List{}, err
+	}
+	if list.Deny, err = ParsePrefixes(deny); err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// ParsePrefixes parses CIDRs and single IP addresses
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", entry)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Empty reports whether the list has no entries
+func (l List) Empty() bool {
+	return len(l.Allow) == 0 && len(l.Deny) == 0
+}
+
+// Allows reports whether the list lets ip through
+// Addresses that cannot be parsed only pass lists without allow entries.
+func (l List) Allows(ip string) bool {
+	if l.Empty() {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return len(l.Allow) == 0
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range l.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(l.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range l.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the entries of both lists
+func (l List) Merge(other List) List {
+	return List{
+		Allow: append(append([]netip.Prefix{}, l.Allow...), other.Allow...),
+		Deny:  append(append([]netip.Prefix{}, l.Deny...), other.Deny...),
+	}
+}
+
+// Lists represents the allow and deny lists of the gateway, the admin server and individual resources
+type Lists struct {
+	Gateway   List            `json:"gateway"`
+	Admin     List            `json:"admin"`
+	Resources map[string]List `json:"resources,omitempty"` // Keyed by resource endpoint
+}
+
+// Status represents the lists in effect and the state of the lists file
+type Status struct {
+	Lists
+	File      string     `json:"file,omitempty"`
+	LoadedAt  *time.Time `json:"loadedAt,omitempty"`  // When the file was last loaded
+	LastError string     `json:"lastError,omitempty"` // Why the last reload failed; the previous lists stay in effect
+}
+
+// Filter holds the lists of the config and of an optional lists file, which is reloaded when it changes
+// Lists from the file are added to the lists of the config.
+type Filter struct {
+	static   Lists
+	file     string
+	interval time.Duration
+
+	lists atomic.Pointer[Lists]
+
+	mu        sync.Mutex // Guards the file state below
+	checkedAt time.Time
+	modTime   time.Time
+	loadedAt  time.Time
+	lastError string
+}
+
+// fileLists represents the lists file
+type fileLists struct {
+	Allow      []string `mapstructure:"allow"`
+	Deny       []string `mapstructure:"deny"`
+	AdminAllow []string `mapstructure:"admin_allow"`
+	AdminDeny  []string `mapstructure:"admin_deny"`
+	Resources  []struct {
+		Endpoint string   `mapstructure:"endpoint"`
+		Allow    []string `mapstructure:"allow"`
+		Deny     []string `mapstructure:"deny"`
+	} `mapstructure:"resources"`
+}
+
+// NewFilter creates a filter from the ip_filter config and loads the lists file, if any
+func NewFilter(cfg config.IPFilterConfig) (*Filter, error) {
+	gatewayList, err := ParseList(cfg.Allow, cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip_filter gateway list: %w", err)
+	}
+	adminList, err := ParseList(cfg.AdminAllow, cfg.AdminDeny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip_filter admin list: %w", err)
+	}
+
+	f := &Filter{
+		static:   Lists{Gateway: gatewayList, Admin: adminList},
+		file:     cfg.File,
+		interval: cfg.ReloadInterval,
+	}
+	if f.interval <= 0 {
+		f.interval = DefaultReloadInterval
+	}
+	f.lists.Store(&f.static)
+
+	if f.file != "" {
+		if err := f.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Gateway returns the lists applied to every gateway request
+func (f *Filter) Gateway() List {
+	return f.current().Gateway
+}
+
+// Admin returns the lists applied to every admin request
+func (f *Filter) Admin() List {
+	return f.current().Admin
+}
+
+// Resource returns the lists of the lists file for a resource endpoint
+func (f *Filter) Resource(endpoint string) List {
+	return f.current().Resources[endpoint]
+}
+
+// Status returns the lists in effect and the state of the lists file
+func (f *Filter) Status() Status {
+	lists := f.current()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := Status{Lists: *lists, File: f.file, LastError: f.lastError}
+	if !f.loadedAt.IsZero() {
+		loadedAt := f.loadedAt
+		status.LoadedAt = &loadedAt
+	}
+	return status
+}
+
+// Reload reads the lists file and replaces the lists in effect
+// If the file cannot be read or parsed, the previous lists stay in effect.
+func (f *Filter) Reload() error {
+	if f.file == "" {
+		return fmt.Errorf("no ip_filter file is configured")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checkedAt = time.Now()
+
+	info, err := os.Stat(f.file)
+	if err != nil {
+		return f.failLocked(fmt.Errorf("failed to read ip_filter file: %w", err))
+	}
+	lists, err := f.loadFile()
+	if err != nil {
+		return f.failLocked(err)
+	}
+
+	f.lists.Store(lists)
+	f.modTime, f.loadedAt, f.lastError = info.ModTime(), time.Now(), ""
+	log.Info().
+		Str("file", f.file).
+		Int("resources", len(lists.Resources)).
+		Msg("Loaded IP filter lists")
+	return nil
+}
+
+// current returns the lists in effect, reloading the lists file if it changed
+func (f *Filter) current() *Lists {
+	if f.file != "" && f.mu.TryLock() {
+		if time.Since(f.checkedAt) >= f.interval {
+			f.checkedAt = time.Now()
+			if info, err := os.Stat(f.file); err != nil {
+				f.failLocked(fmt.Errorf("failed to read ip_filter file: %w", err))
+			} else if !info.ModTime().Equal(f.modTime) {
+				f.mu.Unlock()
+				f.Reload()
+				return f.lists.Load()
+			}
+		}
+		f.mu.Unlock()
+	}
+	return f.lists.Load()
+}
+
+// failLocked records a failed reload; callers must hold f.mu
+func (f *Filter) failLocked(err error) error {
+	if f.lastError != err.Error() {
+		log.Error().Err(err).Str("file", f.file).Msg("Failed to reload IP filter lists, keeping previous lists")
+	}
+	f.lastError = err.Error()
+	return err
+}
+
+// loadFile parses the lists file and merges it with the lists of the config
+func (f *Filter) loadFile() (*Lists, error) {
+	v := viper.New()
+	v.SetConfigFile(f.file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read ip_filter file: %w", err)
+	}
+	var file fileLists
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("invalid ip_filter file: %w", err)
+	}
+
+	gatewayList, err := ParseList(file.Allow, file.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip_filter file: %w", err)
+	}
+	adminList, err := ParseList(file.AdminAllow, file.AdminDeny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip_filter file: %w", err)
+	}
+
+	lists := &Lists{
+		Gateway:   f.static.Gateway.Merge(gatewayList),
+		Admin:     f.static.Admin.Merge(adminList),
+		Resources: make(map[string]List, len(file.Resources)),
+	}
+	for _, resource := range file.Resources {
+		list, err := ParseList(resource.Allow, resource.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip_filter file: resource %s: %w", resource.Endpoint, err)
+		}
+		endpoint := NormalizeEndpoint(resource.Endpoint)
+		lists.Resources[endpoint] = lists.Resources[endpoint].Merge(list)
+	}
+	return lists, nil
+}
+
+// NormalizeEndpoint normalizes a resource endpoint the way the gateway does: a leading slash and no trailing slash
+func NormalizeEndpoint(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "/") {
+		endpoint = "/" + endpoint
+	}
+	if endpoint != "/" {
+		endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+	return endpoint
+}
@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"go-agent-guide/internal/auth"
 	"go-agent-guide/internal/config"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
@@ -12,8 +15,10 @@ import (
 )
 
 // AdminAuthMiddleware provides authentication middleware for admin server
-// Supports bearer, basic, and api_key authentication types
-func AdminAuthMiddleware(authConfig config.AdminServerConfig) gin.HandlerFunc {
+// Supports bearer, basic, and api_key authentication types. The authenticated principal is stored
+// in the context for RequireAdminRole; denied requests are recorded in the audit log.
+// Failed attempts are delayed and locked out by client IP and credential.
+func AdminAuthMiddleware(authConfig config.AdminServerConfig, principals *auth.AdminPrincipals, audit *auth.AuditLog, failures *auth.FailureTracker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip authentication for health endpoints
 		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/ready" {
@@ -21,13 +26,18 @@ func AdminAuthMiddleware(authConfig config.AdminServerConfig) gin.HandlerFunc {
 			return
 		}
 
+		if rejectLocked(c, failures, auth.ScopeAdmin, failures.Keys(c.ClientIP(), "")) {
+			audit.Record(auditEntry(c, auth.AuditUnauthenticated, "client IP locked out after failed attempts"))
+			return
+		}
+
 		switch authConfig.AuthType {
 		case "bearer":
-			validateBearerAuth(c, authConfig.AuthTokens)
+			validateBearerAuth(c, principals, failures)
 		case "basic":
-			validateBasicAuth(c, authConfig.AuthTokens)
+			validateBasicAuth(c, principals, failures)
 		case "api_key":
-			validateAPIKeyAuth(c, authConfig.AuthTokens)
+			validateAPIKeyAuth(c, principals, failures)
 		default:
 			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
 				Error:   "invalid_auth_config",
@@ -38,14 +48,98 @@ func AdminAuthMiddleware(authConfig config.AdminServerConfig) gin.HandlerFunc {
 			return
 		}
 
-		if !c.IsAborted() {
+		if c.IsAborted() {
+			audit.Record(auditEntry(c, auth.AuditUnauthenticated, c.GetString("admin_auth_reason")))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdminRole enforces the role an admin route group needs: read for GET and HEAD, write for other methods
+// Without authentication (admin_server.auth_enabled: false) every request is allowed.
+func RequireAdminRole(read, write string, audit *auth.AuditLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, authenticated := c.Get("admin_principal")
+		if !authenticated {
+			c.Next()
+			return
+		}
+		principal := value.(*auth.AdminPrincipal)
+
+		required := write
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			required = read
+		}
+		if auth.RoleAllows(principal.Role, required) {
 			c.Next()
+			return
 		}
+
+		c.JSON(http.StatusForbidden, types.ErrorResponse{
+			Error:   "insufficient_role",
+			Message: fmt.Sprintf("Role %s is required, %s has role %s", required, principal.Name, principal.Role),
+			Code:    http.StatusForbidden,
+		})
+		c.Abort()
+		audit.Record(auditEntry(c, auth.AuditForbidden, "requires role "+required))
 	}
 }
 
+// auditEntry describes a denied admin request
+func auditEntry(c *gin.Context, result, reason string) auth.AuditEntry {
+	entry := auth.AuditEntry{
+		Identity: c.GetString("admin_identity"),
+		Method:   c.Request.Method,
+		Route:    c.FullPath(),
+		Path:     c.Request.URL.Path,
+		ClientIP: c.ClientIP(),
+		Status:   c.Writer.Status(),
+		Result:   result,
+		Reason:   reason,
+	}
+	if value, exists := c.Get("admin_principal"); exists {
+		principal := value.(*auth.AdminPrincipal)
+		entry.Identity, entry.Role = principal.Name, principal.Role
+	}
+	return entry
+}
+
+// authenticatePrincipal resolves a credential into an admin principal and stores it in the context
+// Failures are counted by client IP and by failureKey, the credential or the part of it that identifies the user.
+// It responds with 401 using errorCode, or 429 during a lockout, and returns false if the credential is not accepted.
+func authenticatePrincipal(c *gin.Context, principals *auth.AdminPrincipals, failures *auth.FailureTracker, credential, failureKey, errorCode, message string) bool {
+	keys := failures.Keys(c.ClientIP(), failureKey)
+
+	principal, err := principals.Authenticate(credential)
+	if err != nil {
+		if principal != nil {
+			c.Set("admin_identity", principal.Name)
+		}
+		if rejectFailure(c, failures, auth.ScopeAdmin, keys) {
+			c.Set("admin_auth_reason", "credential locked out after failed attempts")
+			return false
+		}
+		if errors.Is(err, auth.ErrCredentialExpired) {
+			errorCode, message = "credential_expired", "Credential has expired"
+		}
+		c.Set("admin_auth_reason", err.Error())
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   errorCode,
+			Message: message,
+			Code:    http.StatusUnauthorized,
+		})
+		c.Abort()
+		return false
+	}
+
+	failures.Succeed(auth.ScopeAdmin, keys...)
+	c.Set("admin_principal", principal)
+	return true
+}
+
 // validateBearerAuth validates Bearer token authentication
-func validateBearerAuth(c *gin.Context, validTokens []string) {
+func validateBearerAuth(c *gin.Context, principals *auth.AdminPrincipals, failures *auth.FailureTracker) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
@@ -69,13 +163,7 @@ func validateBearerAuth(c *gin.Context, validTokens []string) {
 	}
 
 	token := parts[1]
-	if !isValidToken(token, validTokens) {
-		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-			Error:   "invalid_token",
-			Message: "Invalid or expired token",
-			Code:    http.StatusUnauthorized,
-		})
-		c.Abort()
+	if !authenticatePrincipal(c, principals, failures, token, token, "invalid_token", "Invalid or expired token") {
 		return
 	}
 
@@ -84,7 +172,7 @@ func validateBearerAuth(c *gin.Context, validTokens []string) {
 
 // validateBasicAuth validates Basic authentication
 // For basic auth, tokens should be in format "username:password" (base64 encoded)
-func validateBasicAuth(c *gin.Context, validTokens []string) {
+func validateBasicAuth(c *gin.Context, principals *auth.AdminPrincipals, failures *auth.FailureTracker) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
@@ -120,13 +208,10 @@ func validateBasicAuth(c *gin.Context, validTokens []string) {
 	}
 
 	credentials := string(decoded)
-	if !isValidToken(credentials, validTokens) {
-		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-			Error:   "invalid_credentials",
-			Message: "Invalid username or password",
-			Code:    http.StatusUnauthorized,
-		})
-		c.Abort()
+	username, _, _ := strings.Cut(credentials, ":")
+	c.Set("admin_identity", username)
+	// Failures are counted by username, so no part of the password is kept
+	if !authenticatePrincipal(c, principals, failures, credentials, username, "invalid_credentials", "Invalid username or password") {
 		return
 	}
 
@@ -135,7 +220,7 @@ func validateBasicAuth(c *gin.Context, validTokens []string) {
 
 // validateAPIKeyAuth validates API key authentication
 // API key can be provided in header "X-API-Key" or query parameter "api_key"
-func validateAPIKeyAuth(c *gin.Context, validTokens []string) {
+func validateAPIKeyAuth(c *gin.Context, principals *auth.AdminPrincipals, failures *auth.FailureTracker) {
 	var apiKey string
 
 	// Try X-API-Key header first
@@ -155,25 +240,9 @@ func validateAPIKeyAuth(c *gin.Context, validTokens []string) {
 		return
 	}
 
-	if !isValidToken(apiKey, validTokens) {
-		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-			Error:   "invalid_api_key",
-			Message: "Invalid or expired API key",
-			Code:    http.StatusUnauthorized,
-		})
-		c.Abort()
+	if !authenticatePrincipal(c, principals, failures, apiKey, apiKey, "invalid_api_key", "Invalid or expired API key") {
 		return
 	}
 
 	c.Set("api_key", apiKey)
 }
-
-// isValidToken checks if the provided token is valid
-func isValidToken(token string, validTokens []string) bool {
-	for _, validToken := range validTokens {
-		if token == validToken {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-agent-guide/internal/auth"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// rejectLocked responds with 429 and returns true if any of the keys is locked after failed authentication
+func rejectLocked(c *gin.Context, failures *auth.FailureTracker, scope string, keys []string) bool {
+	retryAfter, locked := failures.Locked(scope, keys...)
+	if !locked {
+		return false
+	}
+
+	log.Debug().
+		Str("scope", scope).
+		Str("client_ip", c.ClientIP()).
+		Str("path", c.Request.URL.Path).
+		Msg("Authentication refused during lockout")
+
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	c.JSON(http.StatusTooManyRequests, types.ErrorResponse{
+		Error:   "too_many_failed_attempts",
+		Message: "Too many failed authentication attempts, retry later",
+		Code:    http.StatusTooManyRequests,
+	})
+	c.Abort()
+	return true
+}
+
+// rejectFailure records a failed authentication attempt and holds the response for the progressive delay
+// It responds with 429 and returns true if the presented credential is locked; otherwise the caller answers 401.
+// A locked credential only refuses wrong attempts, so guessing at a credential cannot lock out its owner.
+func rejectFailure(c *gin.Context, failures *auth.FailureTracker, scope string, keys []string) bool {
+	delayFailure(c, failures, scope, keys)
+	return rejectLocked(c, failures, scope, keys[1:])
+}
+
+// delayFailure records a failed authentication attempt and holds the response for the progressive delay
+// The wait ends early if the client goes away.
+func delayFailure(c *gin.Context, failures *auth.FailureTracker, scope string, keys []string) {
+	delay := failures.Fail(scope, keys...)
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+}
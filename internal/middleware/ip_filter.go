@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/ipfilter"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+var ipFilterDenials = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ip_filter_denials_total",
+		Help: "Total number of requests denied by IP allow and deny lists",
+	},
+	[]string{"scope", "resource"},
+)
+
+// GatewayIPFilterMiddleware applies the gateway-wide IP lists and the lists of the requested resource
+// It runs before any authentication or payment. The client IP is resolved by gin from the trusted proxies.
+func GatewayIPFilterMiddleware(filter *ipfilter.Filter, resourceGateway *gateway.ResourceGateway) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		if !filter.Gateway().Allows(clientIP) {
+			denyIP(c, "gateway", "")
+			return
+		}
+
+		resource := resourceGateway.FindResource(c.Request.URL.Path)
+		if resource == nil {
+			c.Next()
+			return
+		}
+		if resource.HasMiddleware("ip-filter") && resource.IPFilter == nil {
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "ip_filter_misconfigured",
+				Message: "IP filter for this resource is misconfigured",
+				Code:    http.StatusInternalServerError,
+			})
+			c.Abort()
+			return
+		}
+
+		list := filter.Resource(resource.Resource)
+		if resource.IPFilter != nil {
+			list = list.Merge(*resource.IPFilter)
+		}
+		if !list.Allows(clientIP) {
+			denyIP(c, "resource", resource.Resource)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminIPFilterMiddleware applies the admin IP lists before admin authentication
+func AdminIPFilterMiddleware(filter *ipfilter.Filter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !filter.Admin().Allows(c.ClientIP()) {
+			denyIP(c, "admin", "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// denyIP responds with 403 to a client IP that the lists do not allow
+func denyIP(c *gin.Context, scope, resource string) {
+	ipFilterDenials.WithLabelValues(scope, resource).Inc()
+	log.Warn().
+		Str("client_ip", c.ClientIP()).
+		Str("scope", scope).
+		Str("resource", resource).
+		Str("path", c.Request.URL.Path).
+		Msg("Request denied by IP filter")
+
+	c.JSON(http.StatusForbidden, types.ErrorResponse{
+		Error:   "ip_denied",
+		Message: "Requests from this IP address are not allowed",
+		Code:    http.StatusForbidden,
+	})
+	c.Abort()
+}
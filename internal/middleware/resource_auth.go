@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
+	"go-agent-guide/internal/auth"
 	"go-agent-guide/internal/gateway"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
@@ -11,9 +14,18 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// AuthOptions holds the credential stores used by ResourceAuthMiddleware
+type AuthOptions struct {
+	ConsumerKeys *auth.ConsumerKeys   // Consumer API keys accepted by api_key resources
+	WalletAuth   *auth.WalletAuth     // Wallet sessions and signed requests accepted by wallet resources
+	Failures     *auth.FailureTracker // Delays and lockouts after failed bearer and api_key authentication
+}
+
 // ResourceAuthMiddleware provides resource-specific authentication middleware
-// It checks resources file to determine if authentication is required
-func ResourceAuthMiddleware(resourceGateway *gateway.ResourceGateway) gin.HandlerFunc {
+// It checks resources file to determine if authentication is required.
+// Shared secrets (bearer tokens and API keys) are compared in constant time, and failed attempts are
+// delayed and locked out by client IP and credential prefix.
+func ResourceAuthMiddleware(resourceGateway *gateway.ResourceGateway, options AuthOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Reload resources if needed
 		if err := resourceGateway.ReloadResourcesIfNeeded(); err != nil {
@@ -50,36 +62,25 @@ func ResourceAuthMiddleware(resourceGateway *gateway.ResourceGateway) gin.Handle
 			return
 		}
 
-		// Check authentication based on auth type
-		if resource.Auth.Type == "bearer" {
-			// Check Authorization header
-			authHeader := c.GetHeader("Authorization")
-			if authHeader == "" {
-				c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-					Error:   "missing_authorization",
-					Message: "Authorization header is required",
-					Code:    http.StatusUnauthorized,
-				})
-				c.Abort()
-				return
-			}
+		// Clients locked out after failed attempts are refused before any credential is checked
+		if rejectLocked(c, options.Failures, auth.ScopeGateway, options.Failures.Keys(c.ClientIP(), "")) {
+			return
+		}
 
-			// Extract token from "Bearer <token>" format
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-					Error:   "invalid_authorization_format",
-					Message: "Authorization header must be in format 'Bearer <token>'",
-					Code:    http.StatusUnauthorized,
-				})
-				c.Abort()
+		// Check authentication based on auth type
+		switch resource.Auth.Type {
+		case gateway.AuthTypeBearer:
+			token, ok := bearerToken(c)
+			if !ok {
 				return
 			}
-
-			token := parts[1]
+			keys := options.Failures.Keys(c.ClientIP(), token)
 
 			// Validate token matches resource configuration
-			if token != resource.Auth.Token {
+			if !auth.SecretsEqual(token, resource.Auth.Token) {
+				if rejectFailure(c, options.Failures, auth.ScopeGateway, keys) {
+					return
+				}
 				c.JSON(http.StatusUnauthorized, types.ErrorResponse{
 					Error:   "invalid_token",
 					Message: "Invalid or expired token",
@@ -89,11 +90,231 @@ func ResourceAuthMiddleware(resourceGateway *gateway.ResourceGateway) gin.Handle
 				return
 			}
 
+			options.Failures.Succeed(auth.ScopeGateway, keys...)
+
 			// Store token in context for potential use
 			c.Set("auth_token", token)
+		case gateway.AuthTypeJWT:
+			if !authenticateJWT(c, resource) {
+				return
+			}
+		case gateway.AuthTypeAPIKey:
+			if !authenticateConsumer(c, resource, options.ConsumerKeys, options.Failures) {
+				return
+			}
+		case gateway.AuthTypeWallet:
+			if !authenticateWallet(c, resource, options.WalletAuth) {
+				return
+			}
 		}
 
 		// Authentication successful, continue to next handler
 		c.Next()
 	}
 }
+
+// bearerToken extracts the token of a "Bearer <token>" Authorization header
+// It responds with 401 and returns false if the header is missing or malformed
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "missing_authorization",
+			Message: "Authorization header is required",
+			Code:    http.StatusUnauthorized,
+		})
+		c.Abort()
+		return "", false
+	}
+
+	// Extract token from "Bearer <token>" format
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "invalid_authorization_format",
+			Message: "Authorization header must be in format 'Bearer <token>'",
+			Code:    http.StatusUnauthorized,
+		})
+		c.Abort()
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// authenticateJWT verifies the bearer JWT of a request and forwards the configured claims as headers
+// It responds and returns false if the request is not authenticated
+func authenticateJWT(c *gin.Context, resource *gateway.ResourceConfig) bool {
+	verifier := resource.Auth.JWT
+	if verifier == nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "auth_misconfigured",
+			Message: "Authentication for this resource is misconfigured",
+			Code:    http.StatusInternalServerError,
+		})
+		c.Abort()
+		return false
+	}
+
+	token, ok := bearerToken(c)
+	if !ok {
+		return false
+	}
+
+	claims, err := verifier.Verify(c.Request.Context(), token)
+	if err != nil {
+		log.Debug().Err(err).Str("resource", resource.Resource).Msg("JWT rejected")
+		if errors.Is(err, auth.ErrClaimsRejected) {
+			c.JSON(http.StatusForbidden, types.ErrorResponse{
+				Error:   "insufficient_claims",
+				Message: err.Error(),
+				Code:    http.StatusForbidden,
+			})
+		} else {
+			c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+				Error:   "invalid_token",
+				Message: "Invalid or expired token",
+				Code:    http.StatusUnauthorized,
+			})
+		}
+		c.Abort()
+		return false
+	}
+
+	// Replace any client-supplied values so the upstream can trust the forwarded claims
+	for header, value := range verifier.ForwardHeaders(claims) {
+		c.Request.Header.Del(header)
+		if value != "" {
+			c.Request.Header.Set(header, value)
+		}
+	}
+
+	c.Set("auth_claims", claims)
+	if subject, err := claims.GetSubject(); err == nil && subject != "" {
+		c.Set("auth_subject", subject)
+	}
+	return true
+}
+
+// authenticateConsumer checks a consumer API key from X-API-Key or "Authorization: Bearer"
+// and records the consumer in the context. It responds and returns false if the request is not authenticated.
+func authenticateConsumer(c *gin.Context, resource *gateway.ResourceConfig, consumers *auth.ConsumerKeys, failures *auth.FailureTracker) bool {
+	header := auth.APIKeyHeader
+	apiKey := c.GetHeader(header)
+	if apiKey == "" {
+		if c.GetHeader("Authorization") == "" {
+			c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+				Error:   "missing_authorization",
+				Message: "An API key is required in the X-API-Key or Authorization header",
+				Code:    http.StatusUnauthorized,
+			})
+			c.Abort()
+			return false
+		}
+		token, ok := bearerToken(c)
+		if !ok {
+			return false
+		}
+		header, apiKey = "Authorization", token
+	}
+
+	keys := failures.Keys(c.ClientIP(), apiKey)
+
+	key, err := consumers.Authenticate(apiKey)
+	if err != nil {
+		if rejectFailure(c, failures, auth.ScopeGateway, keys) {
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "invalid_api_key",
+			Message: "Invalid, expired or revoked API key",
+			Code:    http.StatusUnauthorized,
+		})
+		c.Abort()
+		return false
+	}
+
+	failures.Succeed(auth.ScopeGateway, keys...)
+
+	if !key.Allows(resource.Resource, resource.Groups()...) {
+		log.Debug().
+			Str("consumer_id", key.Consumer).
+			Str("key_id", key.ID).
+			Str("resource", resource.Resource).
+			Msg("Consumer key not scoped for resource")
+		c.JSON(http.StatusForbidden, types.ErrorResponse{
+			Error:   "insufficient_scope",
+			Message: "API key is not scoped for this resource",
+			Code:    http.StatusForbidden,
+		})
+		c.Abort()
+		return false
+	}
+
+	// The key authenticates the consumer to the gateway only; do not forward it upstream
+	c.Request.Header.Del(header)
+
+	c.Set("consumer_id", key.Consumer)
+	c.Set("consumer_key_id", key.ID)
+	log.Debug().
+		Str("consumer_id", key.Consumer).
+		Str("key_id", key.ID).
+		Str("resource", resource.Resource).
+		Msg("Consumer authenticated")
+	return true
+}
+
+// authenticateWallet authenticates a wallet by a signed request (Signature-Input and Signature headers)
+// or by a session token from /auth/session, and checks the resource allowlist.
+// It responds and returns false if the request is not authenticated.
+func authenticateWallet(c *gin.Context, resource *gateway.ResourceConfig, wallets *auth.WalletAuth) bool {
+	var address string
+	if c.GetHeader(auth.SignatureInputHeader) != "" {
+		var err error
+		address, err = wallets.VerifyRequest(c.Request)
+		if err != nil {
+			log.Debug().Err(err).Str("resource", resource.Resource).Msg("Wallet request signature rejected")
+			c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+				Error:   "invalid_signature",
+				Message: err.Error(),
+				Code:    http.StatusUnauthorized,
+			})
+			c.Abort()
+			return false
+		}
+	} else {
+		token, ok := bearerToken(c)
+		if !ok {
+			return false
+		}
+		var err error
+		address, err = wallets.ValidateSession(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+				Error:   "invalid_token",
+				Message: "Invalid or expired wallet session",
+				Code:    http.StatusUnauthorized,
+			})
+			c.Abort()
+			return false
+		}
+
+		// The session authenticates the wallet to the gateway only; do not forward it upstream
+		c.Request.Header.Del("Authorization")
+	}
+
+	if len(resource.Auth.Allowlist) > 0 && !slices.Contains(resource.Auth.Allowlist, address) {
+		log.Debug().Str("wallet_address", address).Str("resource", resource.Resource).Msg("Wallet not in resource allowlist")
+		c.JSON(http.StatusForbidden, types.ErrorResponse{
+			Error:   "address_not_allowed",
+			Message: "Wallet address is not allowed to access this resource",
+			Code:    http.StatusForbidden,
+		})
+		c.Abort()
+		return false
+	}
+
+	c.Set("wallet_address", address)
+	log.Debug().Str("wallet_address", address).Str("resource", resource.Resource).Msg("Wallet authenticated")
+	return true
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-agent-guide/internal/auth"
+	"go-agent-guide/internal/gateway"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthenticateJWTOverwritesForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "0123456789abcdef0123456789abcdef"
+
+	verifier, err := auth.NewJWTVerifier(auth.JWTConfig{
+		Secret: secret,
+		ForwardClaims: map[string]string{
+			"X-User-Id":     "sub",
+			"X-User-Tenant": "tenant",
+		},
+	}, auth.NewKeySets())
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	resource := &gateway.ResourceConfig{
+		Resource: "/api/data",
+		Auth:     &gateway.AuthConfig{Type: "jwt", JWT: verifier},
+	}
+
+	router := gin.New()
+	router.GET("/api/data", func(c *gin.Context) {
+		if !authenticateJWT(c, resource) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"user":    c.Request.Header.Values("X-User-Id"),
+			"tenant":  c.Request.Header.Values("X-User-Tenant"),
+			"subject": c.GetString("auth_subject"),
+		})
+	})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Add("X-User-Id", "admin")
+	req.Header.Add("X-User-Id", "root")
+	req.Header.Set("X-User-Tenant", "other-tenant")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var got struct {
+		User    []string `json:"user"`
+		Tenant  []string `json:"tenant"`
+		Subject string   `json:"subject"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got.User) != 1 || got.User[0] != "user-1" {
+		t.Errorf("X-User-Id = %v, want only the token subject", got.User)
+	}
+	// The token has no tenant claim, so the client-sent header must not reach the upstream
+	if len(got.Tenant) != 0 {
+		t.Errorf("X-User-Tenant = %v, want it removed", got.Tenant)
+	}
+	if got.Subject != "user-1" {
+		t.Errorf("auth_subject = %q, want user-1", got.Subject)
+	}
+
+	// A rejected token leaves the request unserved
+	req = httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered token status = %d, want 401", w.Code)
+	}
+}
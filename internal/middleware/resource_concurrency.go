@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-agent-guide/internal/gateway"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResourceConcurrencyMiddleware bounds the in-flight requests of resources and of their upstream targets
+// It runs before payment, so shed requests are never asked to pay and no payment is settled for them.
+// The slots are held until the response is written.
+func ResourceConcurrencyMiddleware(resourceGateway *gateway.ResourceGateway) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resource := resourceGateway.FindResource(c.Request.URL.Path)
+		if resource == nil {
+			c.Next()
+			return
+		}
+
+		if resource.HasMiddleware("concurrency") && resource.Concurrency == nil {
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "concurrency_misconfigured",
+				Message: "Concurrency limit for this resource is misconfigured",
+				Code:    http.StatusInternalServerError,
+			})
+			c.Abort()
+			return
+		}
+
+		release, err := resourceGateway.AcquireConcurrency(c.Request.Context(), resource)
+		if err != nil {
+			gateway.RejectOverloaded(c, resource, err)
+			return
+		}
+		defer release()
+
+		c.Next()
+	}
+}
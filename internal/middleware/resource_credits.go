@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/seller"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ResourceCreditsMiddleware debits prepaid credits for resources with billing "credits"
+// The per-request cost is the USD value of the resource's x402-seller price; no chain interaction happens
+func ResourceCreditsMiddleware(resourceGateway *gateway.ResourceGateway, ledger *seller.CreditLedger, creditsConfig config.CreditsConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get the requested path (use full URL path instead of param)
+		requestPath := c.Request.URL.Path
+
+		// Find resource configuration
+		resource := resourceGateway.FindResource(requestPath)
+		if resource == nil || resource.Billing != "credits" {
+			c.Next()
+			return
+		}
+
+		// Token holders are not charged
+		if c.GetBool("token_gated") {
+			c.Next()
+			return
+		}
+
+		c.Set("resource_config", resource)
+
+		if resource.X402 == nil {
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "internal_error",
+				Message: "Resource billed with credits has no x402-seller price configured",
+				Code:    http.StatusInternalServerError,
+			})
+			c.Abort()
+			return
+		}
+
+		usd, err := resourceGateway.PaymentValueUSD(resource.X402)
+		if err != nil {
+			log.Error().Err(err).Str("resource", resource.Resource).Msg("Failed to compute credits cost")
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "internal_error",
+				Message: "Failed to compute credits cost for resource",
+				Code:    http.StatusInternalServerError,
+			})
+			c.Abort()
+			return
+		}
+		cost := seller.CreditsCostFromUSD(usd)
+
+		apiKey := c.GetHeader(seller.CreditsKeyHeader)
+		if apiKey == "" {
+			returnCreditsRequired(c, resourceGateway, creditsConfig, "credits_required", "Prepaid credits are required to access this resource", cost, nil)
+			c.Abort()
+			return
+		}
+
+		account, err := ledger.Debit(apiKey, cost, resource.Resource)
+		if err != nil {
+			switch {
+			case errors.Is(err, seller.ErrInvalidCreditKey):
+				c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+					Error:   "invalid_credits_key",
+					Message: "Invalid or revoked credits API key",
+					Code:    http.StatusUnauthorized,
+				})
+			case errors.Is(err, seller.ErrInsufficientCredits):
+				returnCreditsRequired(c, resourceGateway, creditsConfig, "insufficient_credits", "Credit balance is too low, please top up", cost, account)
+			default:
+				log.Error().Err(err).Str("resource", resource.Resource).Msg("Failed to debit credits")
+				c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+					Error:   "internal_error",
+					Message: "Failed to debit credits",
+					Code:    http.StatusInternalServerError,
+				})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Header("X-Credits-Balance", seller.FormatCredits(account.Balance))
+		c.Set("credits_address", account.Address)
+		c.Set("payment_payer", account.Address)
+
+		c.Next()
+
+		// Requests the upstream failed to serve are not charged
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			if _, err := ledger.Refund(account.Address, cost, resource.Resource); err != nil {
+				log.Error().Err(err).Str("resource", resource.Resource).Str("address", account.Address).Msg("Failed to refund credits")
+			}
+		}
+	}
+}
+
+// returnCreditsRequired returns a 402 response pointing at the credits top-up resource
+func returnCreditsRequired(
+	c *gin.Context,
+	resourceGateway *gateway.ResourceGateway,
+	creditsConfig config.CreditsConfig,
+	errorCode, message string,
+	cost int64,
+	account *seller.CreditAccount,
+) {
+	credits := gin.H{
+		"required":      seller.FormatCredits(cost),
+		"currency":      "USD",
+		"topupResource": creditsConfig.TopupResource,
+	}
+	if account != nil {
+		credits["balance"] = seller.FormatCredits(account.Balance)
+	}
+	if topup := resourceGateway.FindResource(creditsConfig.TopupResource); topup != nil && topup.X402 != nil {
+		credits["topupRequirements"] = topup.X402
+	}
+
+	c.JSON(http.StatusPaymentRequired, gin.H{
+		"error":   errorCode,
+		"message": message,
+		"code":    http.StatusPaymentRequired,
+		"credits": credits,
+	})
+}
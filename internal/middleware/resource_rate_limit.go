@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/ratelimit"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+var rateLimitRejections = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rate_limit_rejections_total",
+		Help: "Total number of requests rejected by resource rate limits and quotas",
+	},
+	[]string{"resource", "reason"},
+)
+
+// ResourceRateLimitMiddleware applies the token-bucket rate limit and the daily and monthly quotas of resources
+// It runs after authentication, so requests can be counted by consumer, identity or payer, and before payment,
+// so rejected requests never reach the facilitator. Paid requests limited by payer are counted by client IP
+// until the seller middleware verifies the payer. Quotas count requests served with a status below 400.
+func ResourceRateLimitMiddleware(resourceGateway *gateway.ResourceGateway, store ratelimit.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resource := resourceGateway.FindResource(c.Request.URL.Path)
+		if resource == nil || !resource.HasMiddleware("rate-limit") {
+			c.Next()
+			return
+		}
+
+		limit := resource.RateLimit
+		if limit == nil {
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "rate_limit_misconfigured",
+				Message: "Rate limit for this resource is misconfigured",
+				Code:    http.StatusInternalServerError,
+			})
+			c.Abort()
+			return
+		}
+
+		now := time.Now()
+		base := resource.Resource + "|" + limit.Key + ":"
+		ipKey := base + "ip:" + c.ClientIP()
+
+		// The payer named in an X-Payment header is not verified yet. Such requests take a token from the
+		// client IP bucket now, and are counted by payer once the seller middleware has verified the payment.
+		if limit.Key == ratelimit.KeyPayer && c.GetString("wallet_address") == "" && c.GetHeader("X-Payment") != "" {
+			if !takeRateLimit(c, resource, store, ipKey, now) {
+				return
+			}
+
+			var quotas quotaReservations
+			c.Set(payerRateLimitKey, func(payer string) bool {
+				key := ipKey
+				if payer != "" {
+					key = base + strings.ToLower(payer)
+					if !takeRateLimit(c, resource, store, key, now) {
+						return false
+					}
+				}
+				reserved, ok := reserveQuotas(c, resource, store, key, now)
+				quotas = reserved
+				return ok
+			})
+
+			c.Next()
+
+			if c.Writer.Status() >= http.StatusBadRequest {
+				quotas.refund(store)
+			}
+			return
+		}
+
+		key := base + rateLimitKey(c, limit.Key)
+		if !takeRateLimit(c, resource, store, key, now) {
+			return
+		}
+
+		// Reserve a request in every quota before serving, so concurrent requests cannot overshoot them
+		quotas, ok := reserveQuotas(c, resource, store, key, now)
+		if !ok {
+			return
+		}
+
+		c.Next()
+
+		// Quotas count served requests only
+		if c.Writer.Status() >= http.StatusBadRequest {
+			quotas.refund(store)
+		}
+	}
+}
+
+// payerRateLimitKey is the context key of a payer rate limit deferred until the payment is verified
+const payerRateLimitKey = "payer_rate_limit"
+
+// applyPayerRateLimit applies the payer rate limit deferred by ResourceRateLimitMiddleware, if any
+// payer is the verified payer, or empty when the request is served without a verified payment; such requests
+// are counted by client IP. It returns false if the request was rejected with 429.
+func applyPayerRateLimit(c *gin.Context, payer string) bool {
+	value, exists := c.Get(payerRateLimitKey)
+	check, ok := value.(func(string) bool)
+	if !exists || !ok {
+		return true
+	}
+	c.Set(payerRateLimitKey, nil)
+	return check(payer)
+}
+
+// takeRateLimit takes a token from the bucket of key
+// If the bucket is empty, the request is rejected with 429 and false is returned.
+func takeRateLimit(c *gin.Context, resource *gateway.ResourceConfig, store ratelimit.Store, key string, now time.Time) bool {
+	limit := resource.RateLimit
+	if limit.Rate <= 0 {
+		return true
+	}
+	result := store.Take(key, limit.Rate, limit.Burst, now)
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		rejectRateLimited(c, resource, "rate_limited", "Too many requests, slow down", result.RetryAfter)
+		return false
+	}
+	return true
+}
+
+// quotaReservation is a request counted in a quota before it is served
+type quotaReservation struct {
+	counter   string
+	expiresAt time.Time
+}
+
+// quotaReservations are the quotas a request was counted in
+type quotaReservations []quotaReservation
+
+// refund takes the request back out of its quotas
+func (r quotaReservations) refund(store ratelimit.Store) {
+	for _, q := range r {
+		store.Add(q.counter, -1, q.expiresAt)
+	}
+}
+
+// reserveQuotas counts the request in the daily and monthly quotas of key
+// If a quota is used up, the reservations are refunded, the request is rejected with 429 and false is returned.
+func reserveQuotas(c *gin.Context, resource *gateway.ResourceConfig, store ratelimit.Store, key string, now time.Time) (quotaReservations, bool) {
+	limit := resource.RateLimit
+	var reserved quotaReservations
+	for _, q := range []struct {
+		period, header, name string
+		max                  int64
+	}{
+		{ratelimit.PeriodDay, "Day", "daily", limit.Daily},
+		{ratelimit.PeriodMonth, "Month", "monthly", limit.Monthly},
+	} {
+		if q.max <= 0 {
+			continue
+		}
+		window, end, _ := ratelimit.Window(q.period, now)
+		counter := key + "|" + window
+		used := store.Add(counter, 1, end)
+
+		c.Header("X-Quota-Limit-"+q.header, strconv.FormatInt(q.max, 10))
+		c.Header("X-Quota-Remaining-"+q.header, strconv.FormatInt(max(q.max-used, 0), 10))
+		c.Header("X-Quota-Reset-"+q.header, end.Format(time.RFC3339))
+		if used > q.max {
+			store.Add(counter, -1, end)
+			reserved.refund(store)
+			rejectRateLimited(c, resource, "quota_exceeded", "The "+q.name+" quota for this resource is used up", end.Sub(now))
+			return nil, false
+		}
+		reserved = append(reserved, quotaReservation{counter: counter, expiresAt: end})
+	}
+	return reserved, true
+}
+
+// rejectRateLimited responds with 429 and a Retry-After header
+func rejectRateLimited(c *gin.Context, resource *gateway.ResourceConfig, code, message string, retryAfter time.Duration) {
+	rateLimitRejections.WithLabelValues(resource.Resource, code).Inc()
+	log.Debug().
+		Str("resource", resource.Resource).
+		Str("client_ip", c.ClientIP()).
+		Str("reason", code).
+		Msg("Request rate limited")
+
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	c.JSON(http.StatusTooManyRequests, types.ErrorResponse{
+		Error:   code,
+		Message: message,
+		Code:    http.StatusTooManyRequests,
+	})
+	c.Abort()
+}
+
+// rateLimitKey returns the value requests are counted by, falling back to the client IP
+// when the request does not carry the key
+func rateLimitKey(c *gin.Context, key string) string {
+	switch key {
+	case ratelimit.KeyAPIKey:
+		if id := c.GetString("consumer_key_id"); id != "" {
+			return id
+		}
+	case ratelimit.KeyIdentity:
+		for _, name := range []string{"consumer_id", "auth_subject", "wallet_address"} {
+			if id := c.GetString(name); id != "" {
+				return name + ":" + id
+			}
+		}
+	case ratelimit.KeyPayer:
+		if address := c.GetString("wallet_address"); address != "" {
+			return address
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go-agent-guide/internal/auth"
+	"go-agent-guide/internal/gateway"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ResourceTokenGateMiddleware gives holders of a token or NFT free access to resources with a token-gate
+// The wallet is authenticated by a wallet auth, a signed request or a wallet session token.
+// Holders skip the credits and x402-seller middlewares; non-holders are refused, or sent on to
+// x402-seller when the gate's fallback is "x402-seller".
+func ResourceTokenGateMiddleware(resourceGateway *gateway.ResourceGateway, wallets *auth.WalletAuth) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resource := resourceGateway.FindResource(c.Request.URL.Path)
+		if resource == nil || !resource.HasMiddleware("token-gate") {
+			c.Next()
+			return
+		}
+
+		gate := resource.TokenGate
+		if gate == nil {
+			c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+				Error:   "token_gate_misconfigured",
+				Message: "Token gate for this resource is misconfigured",
+				Code:    http.StatusInternalServerError,
+			})
+			c.Abort()
+			return
+		}
+		fallback := gate.Fallback == gateway.TokenGateFallbackSeller && resource.HasMiddleware("x402-seller")
+
+		address, err := gateWallet(c, wallets)
+		if err != nil || address == "" {
+			if fallback {
+				c.Next()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+					Error:   "invalid_signature",
+					Message: err.Error(),
+					Code:    http.StatusUnauthorized,
+				})
+			} else {
+				c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+					Error:   "wallet_signature_required",
+					Message: "A wallet signature or wallet session is required to access this resource",
+					Code:    http.StatusUnauthorized,
+				})
+			}
+			c.Abort()
+			return
+		}
+
+		holds, err := resourceGateway.CheckTokenGate(c.Request.Context(), resource, address)
+		if err != nil {
+			log.Warn().Err(err).Str("resource", resource.Resource).Str("wallet_address", address).Msg("Token gate check failed")
+			if fallback {
+				c.Next()
+				return
+			}
+			c.JSON(http.StatusServiceUnavailable, types.ErrorResponse{
+				Error:   "token_gate_unavailable",
+				Message: "Token holdings could not be checked, please retry",
+				Code:    http.StatusServiceUnavailable,
+			})
+			c.Abort()
+			return
+		}
+
+		if !holds {
+			log.Debug().Str("resource", resource.Resource).Str("wallet_address", address).Msg("Wallet does not meet token gate")
+			if fallback {
+				c.Next()
+				return
+			}
+			c.JSON(http.StatusForbidden, types.ErrorResponse{
+				Error:   "insufficient_holdings",
+				Message: "Wallet does not hold the tokens required for this resource",
+				Code:    http.StatusForbidden,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("wallet_address", address)
+		c.Set("token_gated", true)
+		log.Debug().Str("resource", resource.Resource).Str("wallet_address", address).Msg("Token gate passed")
+		c.Next()
+	}
+}
+
+// gateWallet returns the wallet address of a request: the one set by wallet auth, or the signer of a
+// signed request, or the address of a wallet session token. It returns "" if the request carries none.
+func gateWallet(c *gin.Context, wallets *auth.WalletAuth) (string, error) {
+	if address := c.GetString("wallet_address"); address != "" {
+		return address, nil
+	}
+	if c.GetHeader(auth.SignatureInputHeader) != "" {
+		return wallets.VerifyRequest(c.Request)
+	}
+
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return "", nil
+	}
+	address, err := wallets.ValidateSession(token)
+	if err != nil {
+		// The bearer token may belong to another auth type of the resource
+		return "", nil
+	}
+
+	// The session authenticates the wallet to the gateway only; do not forward it upstream
+	c.Request.Header.Del("Authorization")
+	return address, nil
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/gateway"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRPC serves eth_call like a node where every address holds balance
+// If fail is set, every call returns a JSON-RPC error instead.
+func newTestRPC(t *testing.T, balance int64, fail bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_call" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if fail {
+			response["error"] = map[string]interface{}{"code": -32000, "message": "upstream unavailable"}
+		} else {
+			response["result"] = common.BigToHash(big.NewInt(balance)).Hex()
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResourceTokenGateFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const token = "0x00000000000000000000000000000000000000cc"
+	holders := newTestRPC(t, 1_000_000, false)
+	nonHolders := newTestRPC(t, 0, false)
+	failing := newTestRPC(t, 0, true)
+
+	cfg := &config.Config{}
+	for name, rpc := range map[string]string{"holders": holders.URL, "non-holders": nonHolders.URL, "failing": failing.URL} {
+		cfg.Facilitator.ChainNetworks = append(cfg.Facilitator.ChainNetworks, config.ChainNetwork{
+			Name: name, RPC: rpc, ID: 1337, TokenAddress: token, TokenName: "USDC", TokenDecimals: 6,
+		})
+	}
+	endpoint := func(path, network string, fallback bool) config.EndpointConfig {
+		gate := map[string]interface{}{"network": network, "min_balance": "1000000"}
+		middlewares := []map[string]interface{}{{"token-gate": gate}}
+		if fallback {
+			gate["fallback"] = gateway.TokenGateFallbackSeller
+			middlewares = append(middlewares, map[string]interface{}{"x402-seller": map[string]interface{}{
+				"network":           network,
+				"payto":             "0x93866dBB587db8b9f2C36570Ae083E3F9814e508",
+				"maxamountrequired": "10000",
+			}})
+		}
+		return config.EndpointConfig{Endpoint: path, Type: "http", Middlewares: middlewares, TargetURL: "http://upstream.invalid"}
+	}
+	cfg.Resources = []config.EndpointConfig{
+		endpoint("/holders", "holders", true),
+		endpoint("/non-holders/fallback", "non-holders", true),
+		endpoint("/non-holders/strict", "non-holders", false),
+		endpoint("/failing/fallback", "failing", true),
+		endpoint("/failing/strict", "failing", false),
+	}
+
+	resourceGateway, err := gateway.NewResourceGateway(nil, cfg, gateway.BuyerOptions{})
+	if err != nil {
+		t.Fatalf("NewResourceGateway: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stands in for wallet auth
+		if address := c.GetHeader("X-Test-Wallet"); address != "" {
+			c.Set("wallet_address", address)
+		}
+	})
+	router.Use(ResourceTokenGateMiddleware(resourceGateway, nil))
+	router.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"token_gated": c.GetBool("token_gated")})
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		wallet     string
+		wantStatus int
+		wantGated  bool
+	}{
+		{"holder is let through", "/holders", "0x1111111111111111111111111111111111111111", http.StatusOK, true},
+		{"non-holder falls back to payment", "/non-holders/fallback", "0x1111111111111111111111111111111111111111", http.StatusOK, false},
+		{"non-holder is refused without fallback", "/non-holders/strict", "0x1111111111111111111111111111111111111111", http.StatusForbidden, false},
+		{"RPC error falls back to payment", "/failing/fallback", "0x1111111111111111111111111111111111111111", http.StatusOK, false},
+		{"RPC error is unavailable without fallback", "/failing/strict", "0x1111111111111111111111111111111111111111", http.StatusServiceUnavailable, false},
+		{"no wallet falls back to payment", "/holders", "", http.StatusOK, false},
+		{"no wallet is refused without fallback", "/non-holders/strict", "", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.wallet != "" {
+				req.Header.Set("X-Test-Wallet", tt.wallet)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var body struct {
+				TokenGated bool `json:"token_gated"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if body.TokenGated != tt.wantGated {
+				t.Errorf("token_gated = %v, want %v", body.TokenGated, tt.wantGated)
+			}
+		})
+	}
+}
@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/seller"
 	"github.com/agent-guide/go-x402-facilitator/pkg/facilitator"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
@@ -13,10 +16,25 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// SellerOptions holds the seller-side components used by ResourceX402SellerMiddleware
+type SellerOptions struct {
+	NonceStore      *seller.NonceStore      // Claims authorizations before verification
+	SettlementQueue *seller.SettlementQueue // If set, verified payments are settled asynchronously
+	Passes          *seller.PassIssuer      // Issues and validates access passes for pass resources
+}
+
+// errPayerRateLimited is returned by processPayment when the verified payer is over its rate limit
+var errPayerRateLimited = errors.New("payer is rate limited")
+
 // ResourceX402SellerMiddleware provides resource-specific payment verification middleware
 // It checks resources file to determine if payment verification is required
 // This is a Resource-level middleware, corresponding to ResourceAuthMiddleware
-func ResourceX402SellerMiddleware(facilitator facilitator.PaymentFacilitator, resourceGateway *gateway.ResourceGateway) gin.HandlerFunc {
+// Payment authorizations are claimed in the nonce store before verification to prevent replays
+func ResourceX402SellerMiddleware(
+	facilitator facilitator.PaymentFacilitator,
+	resourceGateway *gateway.ResourceGateway,
+	opts SellerOptions,
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Reload resources if needed
 		if err := resourceGateway.ReloadResourcesIfNeeded(); err != nil {
@@ -28,30 +46,62 @@ func ResourceX402SellerMiddleware(facilitator facilitator.PaymentFacilitator, re
 
 		// Find resource configuration
 		resource := resourceGateway.FindResource(requestPath)
-		if resource == nil || resource.X402 == nil {
-			log.Warn().Str("requestPath", requestPath).Interface("resource", resource).Msg("Resource not found")
+		if resource == nil {
+			log.Warn().Str("requestPath", requestPath).Msg("Resource not found")
 			// Resource not found, skip payment verification (will be handled by handler)
 			c.Next()
 			return
 		}
 
+		// Check if payment "x402-seller" middleware is required for this resource
+		hasPayment := resource.HasMiddleware("x402-seller")
+
+		// A paid resource whose payment requirements could not be built (an unknown network, or a price
+		// that cannot be converted, e.g. after its rate was deleted) is refused rather than served for free
+		if hasPayment && resource.X402 == nil {
+			log.Error().Str("resource", resource.Resource).Msg("Paid resource has no payment requirements, refusing request")
+			c.JSON(http.StatusServiceUnavailable, types.ErrorResponse{
+				Error:   "payment_unavailable",
+				Message: "Payment requirements for this resource are unavailable",
+				Code:    http.StatusServiceUnavailable,
+			})
+			c.Abort()
+			return
+		}
+		if resource.X402 == nil {
+			if applyPayerRateLimit(c, "") {
+				c.Next()
+			}
+			return
+		}
+
 		// Store resource in context for handler and other middlewares to use
 		// (Set it even if payment verification is not required, so handler knows resource exists)
 		c.Set("resource_config", resource)
 
-		// Check if payment "x402-seller" middleware is required for this resource
-		hasPayment := false
-		for _, mw := range resource.Middlewares {
-			if mw == "x402-seller" {
-				hasPayment = true
-				break
+		if !hasPayment || resource.Billing == "credits" || c.GetBool("token_gated") {
+			// No payment requirement (or paid with prepaid credits, or free for token holders), continue
+			if applyPayerRateLimit(c, "") {
+				c.Next()
 			}
+			return
 		}
 
-		if !hasPayment {
-			// No payment requirement, continue
-			c.Next()
-			return
+		// A valid access pass skips payment verification and settlement until it expires
+		if resource.Pass != nil {
+			if token := c.GetHeader(seller.AccessPassHeader); token != "" {
+				pass, err := opts.Passes.Validate(token, resource.PassScope())
+				if err == nil {
+					if !applyPayerRateLimit(c, pass.Payer) {
+						return
+					}
+					c.Set("payment_payer", pass.Payer)
+					c.Set("access_pass_id", pass.ID)
+					c.Next()
+					return
+				}
+				log.Debug().Err(err).Str("resource", resource.Resource).Msg("Access pass rejected, payment required")
+			}
 		}
 
 		// Check for X-Payment header
@@ -64,8 +114,21 @@ func ResourceX402SellerMiddleware(facilitator facilitator.PaymentFacilitator, re
 		}
 
 		// Parse and validate payment
-		if err := processPayment(c, facilitator, resource, paymentHeader); err != nil {
+		if err := processPayment(c, facilitator, opts, resource, paymentHeader); err != nil {
+			if errors.Is(err, errPayerRateLimited) {
+				// The rate limit middleware has responded
+				return
+			}
 			log.Error().Err(err).Msg("Payment processing failed")
+			if errors.Is(err, seller.ErrNonceReplayed) {
+				c.JSON(http.StatusPaymentRequired, types.ErrorResponse{
+					Error:   "payment_replayed",
+					Message: err.Error(),
+					Code:    http.StatusPaymentRequired,
+				})
+				c.Abort()
+				return
+			}
 			c.JSON(http.StatusPaymentRequired, types.ErrorResponse{
 				Error:   "payment_failed",
 				Message: err.Error(),
@@ -75,11 +138,45 @@ func ResourceX402SellerMiddleware(facilitator facilitator.PaymentFacilitator, re
 			return
 		}
 
+		// Payment successful, issue an access pass for pass resources
+		if resource.Pass != nil {
+			if err := issueAccessPass(c, opts.Passes, resource); err != nil {
+				log.Error().Err(err).Str("resource", resource.Resource).Msg("Failed to issue access pass")
+			}
+		}
+
 		// Payment successful, continue to next handler
 		c.Next()
 	}
 }
 
+// issueAccessPass issues an access pass to the payer and returns it in the response headers
+func issueAccessPass(c *gin.Context, passes *seller.PassIssuer, resource *gateway.ResourceConfig) error {
+	payer := c.GetString("payment_payer")
+	if payer == "" {
+		return fmt.Errorf("payer is unknown")
+	}
+
+	// In async mode the pass is revoked if the payment is never settled
+	token, pass, err := passes.Issue(payer, resource.PassScope(), c.GetString("payment_settlement_id"), resource.Pass.Duration)
+	if err != nil {
+		return err
+	}
+
+	c.Header(seller.AccessPassHeader, token)
+	c.Header(seller.AccessPassExpiresHeader, time.Unix(pass.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	c.Set("access_pass_id", pass.ID)
+
+	log.Info().
+		Str("resource", resource.Resource).
+		Str("payer", pass.Payer).
+		Str("wallet_address", c.GetString("wallet_address")).
+		Str("scope", pass.Scope).
+		Str("pass_id", pass.ID).
+		Msg("Access pass issued")
+	return nil
+}
+
 // returnPaymentRequired returns a 402 Payment Required response with payment requirements
 func returnPaymentRequired(c *gin.Context, resource *gateway.ResourceConfig) {
 	if resource.X402 == nil {
@@ -116,7 +213,13 @@ func returnPaymentRequired(c *gin.Context, resource *gateway.ResourceConfig) {
 }
 
 // processPayment processes the X-Payment header and verifies/settles the payment
-func processPayment(c *gin.Context, facilitator facilitator.PaymentFacilitator, resource *gateway.ResourceConfig, paymentHeader string) error {
+func processPayment(
+	c *gin.Context,
+	facilitator facilitator.PaymentFacilitator,
+	opts SellerOptions,
+	resource *gateway.ResourceConfig,
+	paymentHeader string,
+) (err error) {
 	// Parse X-Payment header (should be JSON)
 	var paymentPayload types.PaymentPayload
 	if err := json.Unmarshal([]byte(paymentHeader), &paymentPayload); err != nil {
@@ -133,6 +236,27 @@ func processPayment(c *gin.Context, facilitator facilitator.PaymentFacilitator,
 			resource.X402.Scheme, resource.X402.Network, paymentPayload.Scheme, paymentPayload.Network)
 	}
 
+	// Claim the authorization nonce before verification, so that concurrent
+	// requests carrying the same X-Payment cannot both pass verification
+	authorization, err := seller.ParseAuthorization(&paymentPayload)
+	if err != nil {
+		return err
+	}
+	validBefore, err := seller.ValidBeforeUnix(authorization)
+	if err != nil {
+		return err
+	}
+	nonceStore := opts.NonceStore
+	if err := nonceStore.Claim(paymentPayload.Network, authorization.From, authorization.Nonce, validBefore); err != nil {
+		return fmt.Errorf("nonce %s from %s: %w", authorization.Nonce, authorization.From, err)
+	}
+	defer func() {
+		// The authorization was not used on-chain, allow it to be presented again
+		if err != nil {
+			nonceStore.Release(paymentPayload.Network, authorization.From, authorization.Nonce)
+		}
+	}()
+
 	// Convert X402Config to PaymentRequirements
 	requirements := types.PaymentRequirements{
 		Scheme:            resource.X402.Scheme,
@@ -164,6 +288,31 @@ func processPayment(c *gin.Context, facilitator facilitator.PaymentFacilitator,
 		return fmt.Errorf("payment is invalid: %s", verifyResp.InvalidReason)
 	}
 
+	// Count the request by the verified payer before the payment is settled
+	if !applyPayerRateLimit(c, verifyResp.Payer) {
+		return errPayerRateLimited
+	}
+
+	// In async mode, durably queue the settlement and serve the request right away. Credit top-ups are
+	// always settled first, because the credits and API key they grant cannot be taken back.
+	if opts.SettlementQueue != nil && resource.Billing != "topup" {
+		item, err := opts.SettlementQueue.Enqueue(resource.Resource, verifyResp.Payer, paymentPayload, requirements)
+		if err != nil {
+			return fmt.Errorf("failed to queue payment settlement: %w", err)
+		}
+
+		log.Info().
+			Str("resource", resource.Resource).
+			Str("payer", verifyResp.Payer).
+			Str("wallet_address", c.GetString("wallet_address")).
+			Str("settlement_id", item.ID).
+			Msg("Payment verified, settlement queued")
+
+		c.Set("payment_payer", verifyResp.Payer)
+		c.Set("payment_settlement_id", item.ID)
+		return nil
+	}
+
 	// Settle payment
 	settleResp, err := facilitator.Settle(ctx, &verifyReq)
 	if err != nil {
@@ -177,6 +326,7 @@ func processPayment(c *gin.Context, facilitator facilitator.PaymentFacilitator,
 	log.Info().
 		Str("resource", resource.Resource).
 		Str("payer", settleResp.Payer).
+		Str("wallet_address", c.GetString("wallet_address")).
 		Str("transaction", settleResp.Transaction).
 		Msg("Payment processed successfully")
 
@@ -0,0 +1,117 @@
+package pricing
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// CurrencyUSD is the currency code used for fiat prices such as "$0.10" or "0.10 USD"
+const CurrencyUSD = "USD"
+
+// Price represents a human readable price, e.g. "0.10 USDC" or "$0.10"
+type Price struct {
+	Amount   *big.Rat // Exact decimal amount in human units
+	Currency string   // Upper-cased token symbol, or CurrencyUSD for fiat prices
+}
+
+// String returns the canonical representation of the price
+func (p *Price) String() string {
+	return fmt.Sprintf("%s %s", formatRat(p.Amount), p.Currency)
+}
+
+// ParsePrice parses a price string
+// Supported formats: "$0.10", "0.10 USD", "0.10 USDC"
+func ParsePrice(s string) (*Price, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("price is empty")
+	}
+
+	var amount, currency string
+	if strings.HasPrefix(s, "$") {
+		amount = strings.TrimSpace(strings.TrimPrefix(s, "$"))
+		currency = CurrencyUSD
+	} else {
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid price %q: expected format \"<amount> <symbol>\" or \"$<amount>\"", s)
+		}
+		amount = fields[0]
+		currency = strings.ToUpper(fields[1])
+	}
+
+	value, err := parseDecimal(amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price %q: %w", s, err)
+	}
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid price %q: amount must be positive", s)
+	}
+
+	return &Price{Amount: value, Currency: currency}, nil
+}
+
+// parseDecimal parses a plain decimal string (no exponent, no fractions) into an exact rational
+func parseDecimal(s string) (*big.Rat, error) {
+	if s == "" {
+		return nil, fmt.Errorf("amount is empty")
+	}
+	for i, r := range s {
+		if (r < '0' || r > '9') && r != '.' && !(i == 0 && r == '-') {
+			return nil, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+	if strings.Count(s, ".") > 1 {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return value, nil
+}
+
+// ToBaseUnits converts a human amount into integer token base units using the token decimals
+// It returns an error if the conversion would lose precision
+func ToBaseUnits(amount *big.Rat, decimals int64) (*big.Int, error) {
+	if decimals < 0 {
+		return nil, fmt.Errorf("token decimals must be non-negative")
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil)
+	units := new(big.Rat).Mul(amount, new(big.Rat).SetInt(scale))
+	if !units.IsInt() {
+		return nil, fmt.Errorf("amount %s cannot be represented with %d decimals without losing precision", formatRat(amount), decimals)
+	}
+
+	return new(big.Int).Set(units.Num()), nil
+}
+
+// FromBaseUnits converts integer token base units into a human amount using the token decimals
+func FromBaseUnits(units *big.Int, decimals int64) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil)
+	return new(big.Rat).SetFrac(units, scale)
+}
+
+// FormatDecimal formats an exact amount as a decimal string, e.g. "0.105"
+func FormatDecimal(r *big.Rat) string {
+	return formatRat(r)
+}
+
+// formatRat formats a rational as a decimal string, using exact digits when the value terminates
+func formatRat(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// Find the number of decimals needed for an exact representation (bounded)
+	for prec := 1; prec <= 36; prec++ {
+		scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(prec)), nil)
+		if new(big.Rat).Mul(r, new(big.Rat).SetInt(scale)).IsInt() {
+			return r.FloatString(prec)
+		}
+	}
+	return r.FloatString(36)
+}
@@ -0,0 +1,184 @@
+package pricing
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-agent-guide/internal/config"
+)
+
+// RateTable is a static table of USD exchange rates for tokens
+// USD-pegged tokens are priced at 1 USD without needing an explicit rate
+type RateTable struct {
+	mu     sync.RWMutex
+	rates  map[string]*big.Rat
+	pegged map[string]bool
+}
+
+// NewRateTable creates a rate table from the pricing configuration
+func NewRateTable(cfg config.PricingConfig) (*RateTable, error) {
+	t := &RateTable{
+		rates:  make(map[string]*big.Rat),
+		pegged: make(map[string]bool),
+	}
+
+	for _, symbol := range cfg.USDPegged {
+		t.pegged[strings.ToUpper(symbol)] = true
+	}
+
+	for symbol, rate := range cfg.Rates {
+		if err := t.SetRate(symbol, rate); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// SetRate sets the USD rate for a token symbol (price of one whole token in USD)
+func (t *RateTable) SetRate(symbol, rate string) error {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return fmt.Errorf("token symbol is required")
+	}
+	if symbol == CurrencyUSD {
+		return fmt.Errorf("cannot set a rate for %s", CurrencyUSD)
+	}
+
+	value, err := parseDecimal(strings.TrimSpace(rate))
+	if err != nil {
+		return fmt.Errorf("invalid rate for %s: %w", symbol, err)
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("invalid rate for %s: rate must be positive", symbol)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rates[symbol] = value
+	return nil
+}
+
+// DeleteRate removes the USD rate for a token symbol
+// It returns false if no rate was configured for the symbol
+func (t *RateTable) DeleteRate(symbol string) bool {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.rates[symbol]; !exists {
+		return false
+	}
+	delete(t.rates, symbol)
+	return true
+}
+
+// Without returns a copy of the table without the rate of a token symbol
+// It is used to check what deleting a rate would break before deleting it.
+func (t *RateTable) Without(symbol string) *RateTable {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	copied := &RateTable{
+		rates:  make(map[string]*big.Rat, len(t.rates)),
+		pegged: t.pegged,
+	}
+	for s, rate := range t.rates {
+		if s != symbol {
+			copied.rates[s] = rate
+		}
+	}
+	return copied
+}
+
+// Rates returns a snapshot of the configured rates as decimal strings
+func (t *RateTable) Rates() map[string]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	rates := make(map[string]string, len(t.rates))
+	for symbol, rate := range t.rates {
+		rates[symbol] = formatRat(rate)
+	}
+	return rates
+}
+
+// PeggedSymbols returns the sorted list of USD-pegged token symbols
+func (t *RateTable) PeggedSymbols() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	symbols := make([]string, 0, len(t.pegged))
+	for symbol := range t.pegged {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// USDRate returns the USD price of one whole token
+// Explicit rates take precedence over the USD-pegged list
+func (t *RateTable) USDRate(symbol string) (*big.Rat, error) {
+	symbol = strings.ToUpper(symbol)
+	if symbol == CurrencyUSD {
+		return big.NewRat(1, 1), nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if rate, exists := t.rates[symbol]; exists {
+		return new(big.Rat).Set(rate), nil
+	}
+	if t.pegged[symbol] {
+		return big.NewRat(1, 1), nil
+	}
+	return nil, fmt.Errorf("no USD rate configured for token %s", symbol)
+}
+
+// ToUSD converts an amount of token base units into USD
+func (t *RateTable) ToUSD(units *big.Int, network *config.ChainNetwork) (*big.Rat, error) {
+	rate, err := t.USDRate(network.Symbol())
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Mul(FromBaseUnits(units, network.TokenDecimals), rate), nil
+}
+
+// PriceToUSD converts a price into USD using the rate of its currency
+func (t *RateTable) PriceToUSD(price *Price) (*big.Rat, error) {
+	rate, err := t.USDRate(price.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Mul(price.Amount, rate), nil
+}
+
+// AmountForNetwork converts a price into the token base units of the given network
+// Prices quoted in another currency are converted through USD using the rate table
+func (t *RateTable) AmountForNetwork(price *Price, network *config.ChainNetwork) (string, error) {
+	amount := price.Amount
+	symbol := network.Symbol()
+
+	if !strings.EqualFold(price.Currency, symbol) {
+		sourceRate, err := t.USDRate(price.Currency)
+		if err != nil {
+			return "", err
+		}
+		targetRate, err := t.USDRate(symbol)
+		if err != nil {
+			return "", err
+		}
+		amount = new(big.Rat).Quo(new(big.Rat).Mul(amount, sourceRate), targetRate)
+	}
+
+	units, err := ToBaseUnits(amount, network.TokenDecimals)
+	if err != nil {
+		return "", fmt.Errorf("price %s on network %s: %w", price.String(), network.Name, err)
+	}
+	return units.String(), nil
+}
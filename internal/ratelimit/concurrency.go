@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Concurrency limit scopes
+const (
+	ScopeResource = "resource" // Requests to one resource
+	ScopeTarget   = "target"   // Requests to one upstream host, across resources
+)
+
+// DefaultQueueTimeout is how long a request waits for a slot when the limit sets no timeout
+const DefaultQueueTimeout = 5 * time.Second
+
+var (
+	// ErrQueueFull is returned when all slots are taken and the wait queue is full
+	ErrQueueFull = errors.New("concurrency limit reached and queue is full")
+	// ErrQueueTimeout is returned when a request waited longer than the queue timeout
+	ErrQueueTimeout = errors.New("timed out waiting for a concurrency slot")
+)
+
+var (
+	concurrencyInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "concurrency_in_flight",
+			Help: "Number of requests holding a concurrency slot",
+		},
+		[]string{"scope", "name"},
+	)
+
+	concurrencyQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "concurrency_queue_depth",
+			Help: "Number of requests waiting for a concurrency slot",
+		},
+		[]string{"scope", "name"},
+	)
+
+	concurrencyShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "concurrency_shed_total",
+			Help: "Total number of requests shed by concurrency limits",
+		},
+		[]string{"scope", "name", "reason"},
+	)
+)
+
+// ShedError is returned when a limiter sheds a request
+type ShedError struct {
+	Scope, Name string
+	RetryAfter  time.Duration // When a slot is likely to be free again
+	Err         error         // ErrQueueFull or ErrQueueTimeout
+}
+
+func (e *ShedError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Scope, e.Name, e.Err)
+}
+
+func (e *ShedError) Unwrap() error {
+	return e.Err
+}
+
+// ConcurrencyLimit represents a bound on in-flight requests with a wait queue
+type ConcurrencyLimit struct {
+	MaxInFlight  int           `json:"maxInFlight"`
+	MaxQueue     int           `json:"maxQueue"`               // Requests that may wait for a slot; 0 sheds as soon as all slots are taken
+	QueueTimeout time.Duration `json:"queueTimeout,omitempty"` // How long a request may wait (default: DefaultQueueTimeout)
+}
+
+// ConcurrencyLimiter bounds the in-flight requests of one resource or upstream target
+type ConcurrencyLimiter struct {
+	scope, name string
+	limit       ConcurrencyLimit
+	slots       chan struct{}
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// NewConcurrencyLimiter creates a limiter; scope and name label its metrics
+func NewConcurrencyLimiter(scope, name string, limit ConcurrencyLimit) *ConcurrencyLimiter {
+	if limit.QueueTimeout <= 0 {
+		limit.QueueTimeout = DefaultQueueTimeout
+	}
+	return &ConcurrencyLimiter{
+		scope: scope,
+		name:  name,
+		limit: limit,
+		slots: make(chan struct{}, limit.MaxInFlight),
+	}
+}
+
+// Limit returns the settings of the limiter
+func (l *ConcurrencyLimiter) Limit() ConcurrencyLimit {
+	return l.limit
+}
+
+// Acquire takes a slot, waiting in the queue if all slots are taken
+// The returned function releases the slot. It returns a *ShedError when the request is shed,
+// or the context error if the request is cancelled while waiting.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.waiting >= l.limit.MaxQueue {
+		l.mu.Unlock()
+		return nil, l.shed(ErrQueueFull, "queue_full")
+	}
+	l.waiting++
+	concurrencyQueueDepth.WithLabelValues(l.scope, l.name).Set(float64(l.waiting))
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		concurrencyQueueDepth.WithLabelValues(l.scope, l.name).Set(float64(l.waiting))
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(l.limit.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), nil
+	case <-timer.C:
+		return nil, l.shed(ErrQueueTimeout, "queue_timeout")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// shed counts a shed request and returns its error
+// Clients are asked to retry after one queue timeout, the longest a queued request waits for a slot.
+func (l *ConcurrencyLimiter) shed(err error, reason string) error {
+	concurrencyShedTotal.WithLabelValues(l.scope, l.name, reason).Inc()
+	return &ShedError{Scope: l.scope, Name: l.name, RetryAfter: l.limit.QueueTimeout, Err: err}
+}
+
+// acquired records a taken slot and returns its release function
+func (l *ConcurrencyLimiter) acquired() func() {
+	concurrencyInFlight.WithLabelValues(l.scope, l.name).Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-l.slots
+			concurrencyInFlight.WithLabelValues(l.scope, l.name).Dec()
+		})
+	}
+}
+
+// ConcurrencyLimiters holds the limiters of resources, which are rebuilt on every resource reload,
+// so that a limiter and its slots survive as long as its settings do not change
+type ConcurrencyLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*ConcurrencyLimiter
+}
+
+// NewConcurrencyLimiters creates an empty limiter registry
+func NewConcurrencyLimiters() *ConcurrencyLimiters {
+	return &ConcurrencyLimiters{limiters: make(map[string]*ConcurrencyLimiter)}
+}
+
+// Get returns the limiter of scope and name, replacing it if its settings changed
+// Requests holding slots of a replaced limiter release them to the old limiter.
+func (r *ConcurrencyLimiters) Get(scope, name string, limit ConcurrencyLimit) *ConcurrencyLimiter {
+	key := scope + "|" + name
+	if limit.QueueTimeout <= 0 {
+		limit.QueueTimeout = DefaultQueueTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limiter, exists := r.limiters[key]
+	if !exists || limiter.limit != limit {
+		limiter = NewConcurrencyLimiter(scope, name, limit)
+		r.limiters[key] = limiter
+	}
+	return limiter
+}
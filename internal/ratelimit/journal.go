@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/store"
+
+	"github.com/rs/zerolog/log"
+)
+
+// flushInterval is how often changed quota counters are written to the journal
+// A crash loses at most this much quota usage.
+const flushInterval = time.Second
+
+// compactAfter is the number of appended records after which the journal is rewritten
+const compactAfter = 10000
+
+// counterRecord is the journal record of a quota counter
+type counterRecord struct {
+	Key       string    `json:"key"`
+	Count     int64     `json:"count"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// JournalStore keeps token buckets in memory and persists quota counters in a journal,
+// so quotas survive a restart
+type JournalStore struct {
+	*MemoryStore
+	journal *store.Journal
+
+	flushMu  sync.Mutex
+	dirty    map[string]bool // Counters changed since the last flush, guarded by MemoryStore.mu
+	appended int             // Records appended since the last rewrite
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewJournalStore opens the quota journal at path and starts writing changed counters to it
+func NewJournalStore(path string) (*JournalStore, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &JournalStore{
+		MemoryStore: NewMemoryStore(),
+		journal:     journal,
+		dirty:       make(map[string]bool),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	// Records are snapshots; the last one of a counter wins
+	now := time.Now()
+	err = journal.Replay(func(data json.RawMessage) error {
+		var record counterRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil
+		}
+		if now.Before(record.ExpiresAt) {
+			s.counters[record.Key] = &counter{count: record.Count, expiresAt: record.ExpiresAt}
+		} else {
+			delete(s.counters, record.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load quota counters: %w", err)
+	}
+	if err := s.compact(); err != nil {
+		journal.Close()
+		return nil, err
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Add adds n to a quota counter and returns the new count
+func (s *JournalStore) Add(key string, n int64, expiresAt time.Time) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty[key] = true
+	return s.addLocked(key, n, expiresAt)
+}
+
+// Close writes pending counters and closes the journal
+func (s *JournalStore) Close() error {
+	close(s.stop)
+	<-s.done
+	s.flush()
+	return s.journal.Close()
+}
+
+// run flushes changed counters until the store is closed
+func (s *JournalStore) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush appends a snapshot of each changed counter and compacts the journal when it has grown
+func (s *JournalStore) flush() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	records := make([]counterRecord, 0, len(s.dirty))
+	for key := range s.dirty {
+		if c, exists := s.counters[key]; exists {
+			records = append(records, counterRecord{Key: key, Count: c.count, ExpiresAt: c.expiresAt})
+		}
+	}
+	s.dirty = make(map[string]bool)
+	s.mu.Unlock()
+
+	for i := range records {
+		if err := s.journal.Append(&records[i]); err != nil {
+			log.Error().Err(err).Str("counter", records[i].Key).Msg("Failed to write quota counter")
+		}
+	}
+	s.appended += len(records)
+
+	if s.appended >= compactAfter {
+		if err := s.compact(); err != nil {
+			log.Error().Err(err).Msg("Failed to compact quota journal")
+		}
+	}
+}
+
+// compact rewrites the journal with one record per live counter
+func (s *JournalStore) compact() error {
+	now := time.Now()
+
+	s.mu.Lock()
+	records := make([]interface{}, 0, len(s.counters))
+	for key, c := range s.counters {
+		if now.Before(c.expiresAt) {
+			records = append(records, &counterRecord{Key: key, Count: c.count, ExpiresAt: c.expiresAt})
+		}
+	}
+	s.mu.Unlock()
+
+	if err := s.journal.Rewrite(records); err != nil {
+		return fmt.Errorf("failed to compact quota journal: %w", err)
+	}
+	s.appended = 0
+	return nil
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets and expired counters are dropped
+const sweepInterval = time.Minute
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // When the bucket is full again; it can be forgotten after that
+}
+
+// counter is a quota counter
+type counter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryStore keeps buckets and quota counters in memory; quotas restart with the gateway
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+	}
+}
+
+// Take removes a token from the bucket of key
+func (s *MemoryStore) Take(key string, rate float64, burst int, now time.Time) BucketResult {
+	if burst < 1 {
+		burst = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked(now)
+
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+
+	// Refill for the time since the last request
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.last = now
+	}
+
+	result := BucketResult{Allowed: b.tokens >= 1}
+	if result.Allowed {
+		b.tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second))
+	b.full = now.Add(result.Reset)
+	return result
+}
+
+// Used returns the count of a quota counter
+func (s *MemoryStore) Used(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, exists := s.counters[key]; exists {
+		return c.count
+	}
+	return 0
+}
+
+// Add adds n to a quota counter and returns the new count
+func (s *MemoryStore) Add(key string, n int64, expiresAt time.Time) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addLocked(key, n, expiresAt)
+}
+
+// Close does nothing; memory stores hold no resources
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// addLocked adds n to a quota counter; callers must hold s.mu
+func (s *MemoryStore) addLocked(key string, n int64, expiresAt time.Time) int64 {
+	c, exists := s.counters[key]
+	if !exists {
+		c = &counter{expiresAt: expiresAt}
+		s.counters[key] = c
+	}
+	c.count += n
+	return c.count
+}
+
+// sweepLocked drops full buckets and expired counters at most once per sweepInterval; callers must hold s.mu
+func (s *MemoryStore) sweepLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.After(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, c := range s.counters {
+		if !now.Before(c.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Keys that requests are counted by
+const (
+	KeyIP       = "ip"       // Client IP address
+	KeyAPIKey   = "api_key"  // Consumer API key, falling back to the client IP
+	KeyIdentity = "identity" // Authenticated consumer, JWT subject or wallet, falling back to the client IP
+	KeyPayer    = "payer"    // Payer of the x402 payment or wallet, falling back to the client IP
+)
+
+// Quota periods, in UTC
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Limit represents the rate limit and quotas of a resource
+type Limit struct {
+	Key     string  `json:"key"`               // What requests are counted by: ip, api_key, identity or payer
+	Rate    float64 `json:"rate,omitempty"`    // Sustained requests per second; 0 disables the token bucket
+	Burst   int     `json:"burst,omitempty"`   // Bucket size, the number of requests allowed at once
+	Daily   int64   `json:"daily,omitempty"`   // Served requests per UTC day; 0 is unlimited
+	Monthly int64   `json:"monthly,omitempty"` // Served requests per UTC month; 0 is unlimited
+}
+
+// ValidKey reports whether key is a known rate limit key
+func ValidKey(key string) bool {
+	switch key {
+	case KeyIP, KeyAPIKey, KeyIdentity, KeyPayer:
+		return true
+	}
+	return false
+}
+
+// BucketResult is the outcome of taking a token from a bucket
+type BucketResult struct {
+	Allowed    bool
+	Remaining  int           // Whole tokens left after this request
+	RetryAfter time.Duration // Until the next token, if not allowed
+	Reset      time.Duration // Until the bucket is full again
+}
+
+// Store keeps token buckets and quota counters
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Take removes a token from the bucket of key, refilled at rate tokens per second up to burst
+	Take(key string, rate float64, burst int, now time.Time) BucketResult
+	// Used returns the count of a quota counter
+	Used(counter string) int64
+	// Add adds n to a quota counter that can be forgotten after expiresAt, and returns the new count
+	Add(counter string, n int64, expiresAt time.Time) int64
+	// Close releases the store
+	Close() error
+}
+
+// Window returns the quota counter suffix and end of the period containing now
+func Window(period string, now time.Time) (string, time.Time, error) {
+	now = now.UTC()
+	switch period {
+	case PeriodDay:
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1), nil
+	case PeriodMonth:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01"), start.AddDate(0, 1, 0), nil
+	default:
+		return "", time.Time{}, fmt.Errorf("unknown quota period %q", period)
+	}
+}
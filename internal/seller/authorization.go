@@ -0,0 +1,39 @@
+package seller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+)
+
+// ParseAuthorization extracts the EIP-3009 authorization from an exact EVM payment payload
+func ParseAuthorization(payload *types.PaymentPayload) (*types.Authorization, error) {
+	data, err := json.Marshal(payload.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payment payload: %w", err)
+	}
+
+	var exact types.ExactEVMPayload
+	if err := json.Unmarshal(data, &exact); err != nil {
+		return nil, fmt.Errorf("failed to decode exact EVM payload: %w", err)
+	}
+
+	auth := exact.Authorization
+	if auth.From == "" || auth.Nonce == "" {
+		return nil, fmt.Errorf("payment authorization is missing from or nonce")
+	}
+
+	return &auth, nil
+}
+
+// ValidBeforeUnix parses the validBefore timestamp of an authorization
+func ValidBeforeUnix(auth *types.Authorization) (int64, error) {
+	validBefore, err := strconv.ParseInt(strings.TrimSpace(auth.ValidBefore), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid validBefore %q: %w", auth.ValidBefore, err)
+	}
+	return validBefore, nil
+}
@@ -0,0 +1,399 @@
+package seller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// CreditDecimals is the precision of credit balances: credits are micro-USD
+const CreditDecimals = 6
+
+// CreditsKeyHeader is the header carrying the API key bound to a prepaid credit account
+const CreditsKeyHeader = "X-Credits-Key"
+
+// creditKeyPrefix is the prefix of API keys bound to credit accounts
+const creditKeyPrefix = "agc_"
+
+// Credit ledger entry types
+const (
+	CreditTopup      = "topup"
+	CreditDebit      = "debit"
+	CreditRefund     = "refund"
+	CreditKeyIssued  = "key_issued"
+	CreditKeyRevoked = "key_revoked"
+)
+
+var (
+	// ErrInsufficientCredits is returned when a debit exceeds the account balance
+	ErrInsufficientCredits = errors.New("insufficient credits")
+
+	// ErrInvalidCreditKey is returned when an API key is not bound to any credit account
+	ErrInvalidCreditKey = errors.New("invalid credits API key")
+
+	// ErrCreditAccountNotFound is returned when no account exists for an address
+	ErrCreditAccountNotFound = errors.New("credit account not found")
+)
+
+// CreditEntry is a ledger entry of a credit account
+type CreditEntry struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Address     string    `json:"address"`
+	Amount      int64     `json:"amount"`  // Micro-USD, positive for top-ups, debits and refunds
+	Balance     int64     `json:"balance"` // Balance after the entry, in micro-USD
+	Resource    string    `json:"resource,omitempty"`
+	Transaction string    `json:"transaction,omitempty"`
+	KeyHash     string    `json:"keyHash,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// CreditAccount is the current state of a prepaid credit account
+type CreditAccount struct {
+	Address   string    `json:"address"`
+	Balance   int64     `json:"balance"` // Micro-USD
+	HasKey    bool      `json:"hasKey"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// creditAccount is the in-memory state of an account
+type creditAccount struct {
+	address   string
+	balance   int64
+	keyHash   string
+	updatedAt time.Time
+}
+
+// CreditLedger keeps prepaid credit balances tied to payer addresses
+// All changes are appended to a persistent ledger journal; balances are rebuilt by replay.
+type CreditLedger struct {
+	mu       sync.Mutex
+	journal  *store.Journal
+	accounts map[string]*creditAccount // address -> account
+	keys     map[string]string         // key hash -> address
+}
+
+// NewCreditLedger opens the credit ledger journal at path and rebuilds balances
+func NewCreditLedger(path string) (*CreditLedger, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &CreditLedger{
+		journal:  journal,
+		accounts: make(map[string]*creditAccount),
+		keys:     make(map[string]string),
+	}
+
+	err = journal.Replay(func(data json.RawMessage) error {
+		var entry CreditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil
+		}
+		l.apply(&entry)
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load credit ledger: %w", err)
+	}
+
+	log.Info().Int("accounts", len(l.accounts)).Str("path", path).Msg("Credit ledger loaded")
+
+	return l, nil
+}
+
+// Topup credits an account after a settled payment
+// If the account has no API key yet, a new key is issued and returned once
+func (l *CreditLedger) Topup(address string, amount int64, resource, transaction string) (*CreditAccount, string, error) {
+	if amount <= 0 {
+		return nil, "", fmt.Errorf("top-up amount must be positive")
+	}
+	address = strings.ToLower(address)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account := l.accounts[address]
+	balance := amount
+	if account != nil {
+		balance += account.balance
+	}
+
+	if err := l.appendLocked(&CreditEntry{
+		Type:        CreditTopup,
+		Address:     address,
+		Amount:      amount,
+		Balance:     balance,
+		Resource:    resource,
+		Transaction: transaction,
+	}); err != nil {
+		return nil, "", err
+	}
+
+	var apiKey string
+	if l.accounts[address].keyHash == "" {
+		key, err := generateCreditKey()
+		if err != nil {
+			return nil, "", err
+		}
+		if err := l.appendLocked(&CreditEntry{
+			Type:    CreditKeyIssued,
+			Address: address,
+			Balance: balance,
+			KeyHash: hashCreditKey(key),
+		}); err != nil {
+			return nil, "", err
+		}
+		apiKey = key
+	}
+
+	return l.accounts[address].snapshot(), apiKey, nil
+}
+
+// Debit charges an account by API key
+// It returns ErrInsufficientCredits (with the current balance) if the balance is too low
+func (l *CreditLedger) Debit(apiKey string, amount int64, resource string) (*CreditAccount, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	address, exists := l.keys[hashCreditKey(apiKey)]
+	if !exists {
+		return nil, ErrInvalidCreditKey
+	}
+	account := l.accounts[address]
+
+	if account.balance < amount {
+		return account.snapshot(), ErrInsufficientCredits
+	}
+
+	if err := l.appendLocked(&CreditEntry{
+		Type:     CreditDebit,
+		Address:  address,
+		Amount:   amount,
+		Balance:  account.balance - amount,
+		Resource: resource,
+	}); err != nil {
+		return nil, err
+	}
+
+	return account.snapshot(), nil
+}
+
+// Refund credits back a debit to an account, such as when the upstream failed to serve the request
+func (l *CreditLedger) Refund(address string, amount int64, resource string) (*CreditAccount, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account, exists := l.accounts[strings.ToLower(address)]
+	if !exists {
+		return nil, ErrCreditAccountNotFound
+	}
+
+	if err := l.appendLocked(&CreditEntry{
+		Type:     CreditRefund,
+		Address:  account.address,
+		Amount:   amount,
+		Balance:  account.balance + amount,
+		Resource: resource,
+	}); err != nil {
+		return nil, err
+	}
+
+	return account.snapshot(), nil
+}
+
+// AccountByKey returns the account bound to an API key
+func (l *CreditLedger) AccountByKey(apiKey string) (*CreditAccount, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	address, exists := l.keys[hashCreditKey(apiKey)]
+	if !exists {
+		return nil, ErrInvalidCreditKey
+	}
+	return l.accounts[address].snapshot(), nil
+}
+
+// Account returns the account of an address
+func (l *CreditLedger) Account(address string) (*CreditAccount, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account, exists := l.accounts[strings.ToLower(address)]
+	if !exists {
+		return nil, ErrCreditAccountNotFound
+	}
+	return account.snapshot(), nil
+}
+
+// Accounts returns all accounts sorted by address
+func (l *CreditLedger) Accounts() []*CreditAccount {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	accounts := make([]*CreditAccount, 0, len(l.accounts))
+	for _, account := range l.accounts {
+		accounts = append(accounts, account.snapshot())
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Address < accounts[j].Address
+	})
+	return accounts
+}
+
+// RevokeKey revokes the API key of an account; the next top-up issues a new key
+func (l *CreditLedger) RevokeKey(address string) error {
+	address = strings.ToLower(address)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account, exists := l.accounts[address]
+	if !exists {
+		return ErrCreditAccountNotFound
+	}
+	if account.keyHash == "" {
+		return nil
+	}
+
+	return l.appendLocked(&CreditEntry{
+		Type:    CreditKeyRevoked,
+		Address: address,
+		Balance: account.balance,
+		KeyHash: account.keyHash,
+	})
+}
+
+// Entries returns the ledger entries of an address, oldest first
+func (l *CreditLedger) Entries(address string, limit int) ([]CreditEntry, error) {
+	address = strings.ToLower(address)
+
+	var entries []CreditEntry
+	err := l.journal.Replay(func(data json.RawMessage) error {
+		var entry CreditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil
+		}
+		if entry.Address == address {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// Close closes the ledger journal
+func (l *CreditLedger) Close() error {
+	return l.journal.Close()
+}
+
+// appendLocked persists an entry and applies it; callers must hold l.mu
+func (l *CreditLedger) appendLocked(entry *CreditEntry) error {
+	entry.ID = uuid.New().String()
+	entry.Time = time.Now().UTC()
+
+	if err := l.journal.Append(entry); err != nil {
+		return fmt.Errorf("failed to persist credit ledger entry: %w", err)
+	}
+	l.apply(entry)
+	return nil
+}
+
+// apply updates the in-memory state with a ledger entry
+func (l *CreditLedger) apply(entry *CreditEntry) {
+	account, exists := l.accounts[entry.Address]
+	if !exists {
+		account = &creditAccount{address: entry.Address}
+		l.accounts[entry.Address] = account
+	}
+
+	switch entry.Type {
+	case CreditTopup, CreditDebit, CreditRefund:
+		account.balance = entry.Balance
+	case CreditKeyIssued:
+		if account.keyHash != "" {
+			delete(l.keys, account.keyHash)
+		}
+		account.keyHash = entry.KeyHash
+		l.keys[entry.KeyHash] = entry.Address
+	case CreditKeyRevoked:
+		delete(l.keys, entry.KeyHash)
+		if account.keyHash == entry.KeyHash {
+			account.keyHash = ""
+		}
+	}
+	account.updatedAt = entry.Time
+}
+
+// snapshot returns the public view of an account
+func (a *creditAccount) snapshot() *CreditAccount {
+	return &CreditAccount{
+		Address:   a.address,
+		Balance:   a.balance,
+		HasKey:    a.keyHash != "",
+		UpdatedAt: a.updatedAt,
+	}
+}
+
+// CreditsFromUSD converts a USD amount into credits, rounding down (used for top-ups)
+func CreditsFromUSD(usd *big.Rat) int64 {
+	scaled := new(big.Rat).Mul(usd, new(big.Rat).SetInt(creditScale()))
+	return new(big.Int).Quo(scaled.Num(), scaled.Denom()).Int64()
+}
+
+// CreditsCostFromUSD converts a USD amount into credits, rounding up (used for debits)
+func CreditsCostFromUSD(usd *big.Rat) int64 {
+	scaled := new(big.Rat).Mul(usd, new(big.Rat).SetInt(creditScale()))
+	quo, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	return quo.Int64()
+}
+
+// FormatCredits formats micro-USD credits as a USD decimal string
+func FormatCredits(credits int64) string {
+	return new(big.Rat).SetFrac(big.NewInt(credits), creditScale()).FloatString(CreditDecimals)
+}
+
+// creditScale returns 10^CreditDecimals
+func creditScale() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(CreditDecimals), nil)
+}
+
+// generateCreditKey generates a random API key for a credit account
+func generateCreditKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return creditKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// hashCreditKey returns the stored hash of an API key
+func hashCreditKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package seller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/store"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNonceReplayed is returned when a payment authorization has already been claimed
+var ErrNonceReplayed = errors.New("payment authorization has already been used")
+
+// nonceRecord is a journal record of a claimed or released authorization nonce
+type nonceRecord struct {
+	Op          string    `json:"op"` // "claim" or "release"
+	Network     string    `json:"network"`
+	From        string    `json:"from"`
+	Nonce       string    `json:"nonce"`
+	ValidBefore int64     `json:"validBefore,omitempty"`
+	ClaimedAt   time.Time `json:"claimedAt,omitempty"`
+}
+
+// NonceStore records payment authorizations keyed on (network, from, nonce)
+// A claim is atomic, so concurrent requests carrying the same X-Payment cannot both pass.
+// Claims are persisted in an append-only journal and expire once validBefore has passed.
+type NonceStore struct {
+	mu        sync.Mutex
+	journal   *store.Journal
+	entries   map[string]nonceRecord
+	lastPrune time.Time
+}
+
+// nonceStorePruneInterval is how often expired entries are dropped and the journal compacted
+const nonceStorePruneInterval = 10 * time.Minute
+
+// NewNonceStore opens the nonce store journal at path and loads unexpired claims
+func NewNonceStore(path string) (*NonceStore, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &NonceStore{
+		journal: journal,
+		entries: make(map[string]nonceRecord),
+	}
+
+	err = journal.Replay(func(data json.RawMessage) error {
+		var record nonceRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil
+		}
+		key := nonceKey(record.Network, record.From, record.Nonce)
+		switch record.Op {
+		case "claim":
+			s.entries[key] = record
+		case "release":
+			delete(s.entries, key)
+		}
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load nonce store: %w", err)
+	}
+
+	if err := s.prune(time.Now()); err != nil {
+		journal.Close()
+		return nil, err
+	}
+
+	log.Info().Int("count", len(s.entries)).Str("path", path).Msg("Nonce store loaded")
+
+	return s, nil
+}
+
+// Claim atomically records an authorization nonce
+// It returns ErrNonceReplayed if the nonce is already claimed and not yet expired
+func (s *NonceStore) Claim(network, from, nonce string, validBefore int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > nonceStorePruneInterval {
+		if err := s.prune(now); err != nil {
+			log.Warn().Err(err).Msg("Failed to prune nonce store")
+		}
+	}
+
+	key := nonceKey(network, from, nonce)
+	if existing, exists := s.entries[key]; exists && existing.ValidBefore >= now.Unix() {
+		return ErrNonceReplayed
+	}
+
+	record := nonceRecord{
+		Op:          "claim",
+		Network:     network,
+		From:        strings.ToLower(from),
+		Nonce:       strings.ToLower(nonce),
+		ValidBefore: validBefore,
+		ClaimedAt:   now.UTC(),
+	}
+	if err := s.journal.Append(record); err != nil {
+		return fmt.Errorf("failed to persist nonce claim: %w", err)
+	}
+
+	s.entries[key] = record
+	return nil
+}
+
+// Release removes a claim, e.g. when verification showed the authorization was never valid
+func (s *NonceStore) Release(network, from, nonce string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := nonceKey(network, from, nonce)
+	if _, exists := s.entries[key]; !exists {
+		return
+	}
+
+	record := nonceRecord{
+		Op:      "release",
+		Network: network,
+		From:    strings.ToLower(from),
+		Nonce:   strings.ToLower(nonce),
+	}
+	if err := s.journal.Append(record); err != nil {
+		log.Warn().Err(err).Msg("Failed to persist nonce release")
+		return
+	}
+
+	delete(s.entries, key)
+}
+
+// Count returns the number of live claims
+func (s *NonceStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Close closes the underlying journal
+func (s *NonceStore) Close() error {
+	return s.journal.Close()
+}
+
+// prune drops expired claims and compacts the journal; callers must hold s.mu (or own s exclusively)
+func (s *NonceStore) prune(now time.Time) error {
+	s.lastPrune = now
+
+	records := make([]interface{}, 0, len(s.entries))
+	for key, record := range s.entries {
+		if record.ValidBefore < now.Unix() {
+			delete(s.entries, key)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if err := s.journal.Rewrite(records); err != nil {
+		return fmt.Errorf("failed to compact nonce store: %w", err)
+	}
+	return nil
+}
+
+// nonceKey builds the map key for an authorization
+func nonceKey(network, from, nonce string) string {
+	return network + "|" + strings.ToLower(from) + "|" + strings.ToLower(nonce)
+}
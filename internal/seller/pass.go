@@ -0,0 +1,339 @@
+package seller
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// AccessPassHeader is the header carrying an access pass token
+const AccessPassHeader = "X-Access-Pass"
+
+// AccessPassExpiresHeader is the response header carrying the expiry of a newly issued pass
+const AccessPassExpiresHeader = "X-Access-Pass-Expires"
+
+var (
+	// ErrInvalidPass is returned for malformed tokens or tokens with a bad signature
+	ErrInvalidPass = errors.New("invalid access pass")
+
+	// ErrPassExpired is returned when a pass has expired
+	ErrPassExpired = errors.New("access pass has expired")
+
+	// ErrPassRevoked is returned when a pass has been revoked
+	ErrPassRevoked = errors.New("access pass has been revoked")
+
+	// ErrPassScope is returned when a pass does not grant access to the requested resource
+	ErrPassScope = errors.New("access pass is not valid for this resource")
+
+	// ErrPassNotFound is returned when a pass ID is unknown
+	ErrPassNotFound = errors.New("access pass not found")
+)
+
+// Pass is a time-based access pass issued after a payment
+type Pass struct {
+	ID           string     `json:"id"`
+	Payer        string     `json:"payer"`
+	Scope        string     `json:"scope"`                  // "resource:<path>" or "group:<name>"
+	SettlementID string     `json:"settlementId,omitempty"` // Queued settlement of the payment, in async mode
+	IssuedAt     int64      `json:"issuedAt"`
+	ExpiresAt    int64      `json:"expiresAt"`
+	Revoked      bool       `json:"revoked"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+}
+
+// passClaims are the JWT claims of an access pass token
+type passClaims struct {
+	ID        string `json:"jti"`
+	Payer     string `json:"sub"`
+	Scope     string `json:"scope"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// passRecord is a journal record of an issued or revoked pass
+type passRecord struct {
+	Op   string `json:"op"` // "issue" or "revoke"
+	Pass Pass   `json:"pass"`
+}
+
+// passHeader is the fixed JWT header of access pass tokens
+var passHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// PassIssuer issues and validates signed access pass tokens
+// Tokens are HS256 JWTs; issued passes are journaled so they can be listed and revoked after a restart.
+type PassIssuer struct {
+	key     []byte
+	journal *store.Journal
+
+	mu     sync.RWMutex
+	passes map[string]*Pass
+}
+
+// NewPassIssuer creates a pass issuer with the given signing key and journal path
+// If the key is empty, a random key is generated and passes do not survive a restart
+func NewPassIssuer(signingKey, path string) (*PassIssuer, error) {
+	key := []byte(signingKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate pass signing key: %w", err)
+		}
+		log.Warn().Msg("No access pass signing key configured, using a random key; issued passes are invalidated on restart")
+	} else if len(key) < 32 {
+		return nil, fmt.Errorf("access pass signing key must be at least 32 bytes")
+	}
+
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PassIssuer{
+		key:     key,
+		journal: journal,
+		passes:  make(map[string]*Pass),
+	}
+
+	err = journal.Replay(func(data json.RawMessage) error {
+		var record passRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil
+		}
+		pass := record.Pass
+		p.passes[pass.ID] = &pass
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load access passes: %w", err)
+	}
+
+	// Drop expired passes and compact the journal
+	now := time.Now().Unix()
+	records := make([]interface{}, 0, len(p.passes))
+	for id, pass := range p.passes {
+		if pass.ExpiresAt < now {
+			delete(p.passes, id)
+			continue
+		}
+		records = append(records, passRecord{Op: "issue", Pass: *pass})
+	}
+	if err := journal.Rewrite(records); err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to compact access passes: %w", err)
+	}
+
+	return p, nil
+}
+
+// Issue issues a pass for the payer, valid for the given duration
+// settlementID is the queued settlement of the payment in async mode, or empty if the payment is settled.
+func (p *PassIssuer) Issue(payer, scope, settlementID string, duration time.Duration) (string, *Pass, error) {
+	now := time.Now()
+	pass := &Pass{
+		ID:           uuid.New().String(),
+		Payer:        strings.ToLower(payer),
+		Scope:        scope,
+		SettlementID: settlementID,
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.Add(duration).Unix(),
+	}
+
+	claims, err := json.Marshal(passClaims{
+		ID:        pass.ID,
+		Payer:     pass.Payer,
+		Scope:     pass.Scope,
+		IssuedAt:  pass.IssuedAt,
+		ExpiresAt: pass.ExpiresAt,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode access pass: %w", err)
+	}
+	signingInput := passHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(p.sign(signingInput))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pruneLocked(now.Unix())
+	if err := p.journal.Append(passRecord{Op: "issue", Pass: *pass}); err != nil {
+		return "", nil, fmt.Errorf("failed to persist access pass: %w", err)
+	}
+	p.passes[pass.ID] = pass
+
+	copied := *pass
+	return token, &copied, nil
+}
+
+// Validate checks the token signature, expiry, revocation and scope
+// scopes lists the scopes that grant access to the requested resource
+func (p *PassIssuer) Validate(token string, scopes ...string) (*Pass, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != passHeader {
+		return nil, ErrInvalidPass
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, p.sign(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidPass
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidPass
+	}
+	var parsed passClaims
+	if err := json.Unmarshal(claims, &parsed); err != nil {
+		return nil, ErrInvalidPass
+	}
+
+	if time.Now().Unix() >= parsed.ExpiresAt {
+		return nil, ErrPassExpired
+	}
+
+	p.mu.RLock()
+	stored, exists := p.passes[parsed.ID]
+	revoked := exists && stored.Revoked
+	p.mu.RUnlock()
+	if revoked {
+		return nil, ErrPassRevoked
+	}
+
+	for _, scope := range scopes {
+		if parsed.Scope == scope {
+			return &Pass{
+				ID:        parsed.ID,
+				Payer:     parsed.Payer,
+				Scope:     parsed.Scope,
+				IssuedAt:  parsed.IssuedAt,
+				ExpiresAt: parsed.ExpiresAt,
+			}, nil
+		}
+	}
+	return nil, ErrPassScope
+}
+
+// Revoke revokes a pass by ID
+func (p *PassIssuer) Revoke(id string) (*Pass, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pass, exists := p.passes[id]
+	if !exists {
+		return nil, ErrPassNotFound
+	}
+	if err := p.revokeLocked(pass); err != nil {
+		return nil, err
+	}
+
+	copied := *pass
+	return &copied, nil
+}
+
+// RevokePayer revokes all active passes of a payer and returns how many were revoked
+func (p *PassIssuer) RevokePayer(payer string) (int, error) {
+	payer = strings.ToLower(payer)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	for _, pass := range p.passes {
+		if pass.Payer != payer || pass.Revoked {
+			continue
+		}
+		if err := p.revokeLocked(pass); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// RevokeSettlement revokes the active passes bought with a queued payment and returns how many were revoked
+func (p *PassIssuer) RevokeSettlement(settlementID string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	for _, pass := range p.passes {
+		if pass.SettlementID != settlementID || pass.Revoked {
+			continue
+		}
+		if err := p.revokeLocked(pass); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// List returns unexpired passes, optionally filtered by payer, newest first
+func (p *PassIssuer) List(payer string) []*Pass {
+	payer = strings.ToLower(payer)
+	now := time.Now().Unix()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	passes := make([]*Pass, 0, len(p.passes))
+	for _, pass := range p.passes {
+		if pass.ExpiresAt < now || (payer != "" && pass.Payer != payer) {
+			continue
+		}
+		copied := *pass
+		passes = append(passes, &copied)
+	}
+	sort.Slice(passes, func(i, j int) bool {
+		return passes[i].IssuedAt > passes[j].IssuedAt
+	})
+	return passes
+}
+
+// Close closes the pass journal
+func (p *PassIssuer) Close() error {
+	return p.journal.Close()
+}
+
+// revokeLocked marks a pass as revoked and persists it; callers must hold p.mu
+func (p *PassIssuer) revokeLocked(pass *Pass) error {
+	now := time.Now().UTC()
+	revoked := *pass
+	revoked.Revoked = true
+	revoked.RevokedAt = &now
+
+	if err := p.journal.Append(passRecord{Op: "revoke", Pass: revoked}); err != nil {
+		return fmt.Errorf("failed to persist access pass revocation: %w", err)
+	}
+	*pass = revoked
+	return nil
+}
+
+// pruneLocked drops expired passes from memory; callers must hold p.mu
+func (p *PassIssuer) pruneLocked(now int64) {
+	for id, pass := range p.passes {
+		if pass.ExpiresAt < now {
+			delete(p.passes, id)
+		}
+	}
+}
+
+// sign computes the HMAC-SHA256 signature of the signing input
+func (p *PassIssuer) sign(signingInput string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,528 @@
+package seller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/store"
+	"github.com/agent-guide/go-x402-facilitator/pkg/facilitator"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Settlement item statuses
+const (
+	SettlementPending   = "pending"
+	SettlementInFlight  = "in_flight"
+	SettlementSettled   = "settled"
+	SettlementFailed    = "failed"
+	SettlementAbandoned = "abandoned"
+)
+
+// ErrSettlementNotFound is returned when a settlement item does not exist
+var ErrSettlementNotFound = errors.New("settlement item not found")
+
+// SettlementItem is a verified payment waiting to be settled on-chain
+type SettlementItem struct {
+	ID            string                    `json:"id"`
+	Status        string                    `json:"status"`
+	Network       string                    `json:"network"`
+	Resource      string                    `json:"resource"`
+	Payer         string                    `json:"payer"`
+	Payload       types.PaymentPayload      `json:"paymentPayload"`
+	Requirements  types.PaymentRequirements `json:"paymentRequirements"`
+	Attempts      int                       `json:"attempts"`
+	LastError     string                    `json:"lastError,omitempty"`
+	Transaction   string                    `json:"transaction,omitempty"`
+	NextAttemptAt time.Time                 `json:"nextAttemptAt"`
+	CreatedAt     time.Time                 `json:"createdAt"`
+	UpdatedAt     time.Time                 `json:"updatedAt"`
+}
+
+// SettlementStats summarizes the settlement queue
+type SettlementStats struct {
+	Depth     int            `json:"depth"` // Items still to be settled (pending and in flight)
+	ByStatus  map[string]int `json:"byStatus"`
+	ByNetwork map[string]int `json:"byNetwork"` // Queue depth per network
+}
+
+// SettlementQueue settles verified payments in the background
+// Every state change is appended to a durable journal, so queued items survive a restart.
+// A worker pool settles items with exponential backoff and a per-network concurrency limit.
+// Access passes bought with an item are revoked when the item fails or is abandoned.
+// Settled and abandoned items are kept for the configured retention, then evicted when the
+// journal is compacted.
+type SettlementQueue struct {
+	cfg         config.SettlementConfig
+	facilitator facilitator.PaymentFacilitator
+	journal     *store.Journal
+	passes      *PassIssuer
+
+	mu        sync.Mutex
+	items     map[string]*SettlementItem
+	inFlight  map[string]int // network -> in-flight settlements
+	lastPrune time.Time
+
+	work   chan *SettlementItem
+	wakeup chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// settlementPruneInterval is how often finished items are evicted and the journal compacted
+const settlementPruneInterval = 10 * time.Minute
+
+// NewSettlementQueue opens the settlement journal at path and recovers unsettled items
+func NewSettlementQueue(path string, cfg config.SettlementConfig, f facilitator.PaymentFacilitator, passes *PassIssuer) (*SettlementQueue, error) {
+	journal, err := store.OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &SettlementQueue{
+		cfg:         cfg,
+		facilitator: f,
+		journal:     journal,
+		passes:      passes,
+		items:       make(map[string]*SettlementItem),
+		inFlight:    make(map[string]int),
+		work:        make(chan *SettlementItem),
+		wakeup:      make(chan struct{}, 1),
+	}
+
+	err = journal.Replay(func(data json.RawMessage) error {
+		var item SettlementItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil
+		}
+		q.items[item.ID] = &item
+		return nil
+	})
+	if err != nil {
+		journal.Close()
+		return nil, fmt.Errorf("failed to load settlement queue: %w", err)
+	}
+
+	// Requeue items that were in flight when the process stopped
+	for _, item := range q.items {
+		if item.Status == SettlementInFlight {
+			item.Status = SettlementPending
+			item.NextAttemptAt = time.Now()
+		}
+	}
+	if err := q.prune(time.Now()); err != nil {
+		journal.Close()
+		return nil, err
+	}
+
+	log.Info().Int("count", len(q.items)).Str("path", path).Msg("Settlement queue loaded")
+
+	return q, nil
+}
+
+// Start starts the scheduler and worker pool
+func (q *SettlementQueue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+
+	q.wg.Add(1)
+	go q.scheduler(ctx)
+}
+
+// Stop stops the workers; items in flight are retried after the next start
+func (q *SettlementQueue) Stop() {
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.wg.Wait()
+
+	if err := q.journal.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close settlement journal")
+	}
+}
+
+// Enqueue durably appends a verified payment to the queue
+func (q *SettlementQueue) Enqueue(resource, payer string, payload types.PaymentPayload, requirements types.PaymentRequirements) (*SettlementItem, error) {
+	now := time.Now().UTC()
+	item := &SettlementItem{
+		ID:            uuid.New().String(),
+		Status:        SettlementPending,
+		Network:       requirements.Network,
+		Resource:      resource,
+		Payer:         payer,
+		Payload:       payload,
+		Requirements:  requirements,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	q.mu.Lock()
+	if err := q.journal.Append(item); err != nil {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("failed to persist settlement item: %w", err)
+	}
+	q.items[item.ID] = item
+	snapshot := item.snapshot()
+	q.mu.Unlock()
+
+	q.notify()
+	return snapshot, nil
+}
+
+// List returns queued items and items finished within the retention, optionally filtered by status, oldest first
+func (q *SettlementQueue) List(status string) []*SettlementItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]*SettlementItem, 0, len(q.items))
+	for _, item := range q.items {
+		if status != "" && item.Status != status {
+			continue
+		}
+		items = append(items, item.snapshot())
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items
+}
+
+// Get returns a queued item, or an item finished within the retention, by ID
+func (q *SettlementQueue) Get(id string) (*SettlementItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, exists := q.items[id]
+	if !exists {
+		return nil, ErrSettlementNotFound
+	}
+	return item.snapshot(), nil
+}
+
+// Stats returns queue depth per status and network
+func (q *SettlementQueue) Stats() SettlementStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := SettlementStats{
+		ByStatus:  make(map[string]int),
+		ByNetwork: make(map[string]int),
+	}
+	for _, item := range q.items {
+		stats.ByStatus[item.Status]++
+		if item.Status == SettlementPending || item.Status == SettlementInFlight {
+			stats.Depth++
+			stats.ByNetwork[item.Network]++
+		}
+	}
+	return stats
+}
+
+// Retry moves a failed item back to pending with a fresh attempt budget
+func (q *SettlementQueue) Retry(id string) (*SettlementItem, error) {
+	q.mu.Lock()
+	item, exists := q.items[id]
+	if !exists {
+		q.mu.Unlock()
+		return nil, ErrSettlementNotFound
+	}
+	if item.Status != SettlementFailed && item.Status != SettlementPending {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("cannot retry settlement in status %s", item.Status)
+	}
+
+	item.Status = SettlementPending
+	item.Attempts = 0
+	item.NextAttemptAt = time.Now().UTC()
+	if err := q.persistLocked(item); err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	snapshot := item.snapshot()
+	q.mu.Unlock()
+
+	q.notify()
+	return snapshot, nil
+}
+
+// Abandon gives up on settling a pending or failed item
+func (q *SettlementQueue) Abandon(id string) (*SettlementItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, exists := q.items[id]
+	if !exists {
+		return nil, ErrSettlementNotFound
+	}
+	if item.Status != SettlementFailed && item.Status != SettlementPending {
+		return nil, fmt.Errorf("cannot abandon settlement in status %s", item.Status)
+	}
+
+	item.Status = SettlementAbandoned
+	if err := q.persistLocked(item); err != nil {
+		return nil, err
+	}
+	snapshot := item.snapshot()
+
+	q.revokePasses(snapshot)
+	return snapshot, nil
+}
+
+// scheduler dispatches due items to workers, respecting the per-network concurrency limit
+func (q *SettlementQueue) scheduler(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		q.pruneIfDue()
+
+		for _, item := range q.due() {
+			select {
+			case q.work <- item:
+			case <-ctx.Done():
+				q.release(item, nil)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wakeup:
+		}
+	}
+}
+
+// due marks pending items whose backoff has elapsed as in flight and returns them
+func (q *SettlementQueue) due() []*SettlementItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var pending []*SettlementItem
+	for _, item := range q.items {
+		if item.Status == SettlementPending && !item.NextAttemptAt.After(now) {
+			pending = append(pending, item)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].NextAttemptAt.Before(pending[j].NextAttemptAt)
+	})
+
+	var due []*SettlementItem
+	for _, item := range pending {
+		if q.inFlight[item.Network] >= q.cfg.NetworkConcurrency {
+			continue
+		}
+		q.inFlight[item.Network]++
+		item.Status = SettlementInFlight
+		due = append(due, item)
+	}
+	return due
+}
+
+// worker settles items dispatched by the scheduler
+func (q *SettlementQueue) worker(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-q.work:
+			q.settle(ctx, item)
+		}
+	}
+}
+
+// settle performs one settlement attempt for an item
+func (q *SettlementQueue) settle(ctx context.Context, item *SettlementItem) {
+	q.mu.Lock()
+	req := types.VerifyRequest{
+		PaymentPayload:      item.Payload,
+		PaymentRequirements: item.Requirements,
+	}
+	q.mu.Unlock()
+
+	settleCtx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+	defer cancel()
+
+	resp, err := q.facilitator.Settle(settleCtx, &req)
+	if err == nil && !resp.Success {
+		err = fmt.Errorf("settlement failed: %s", resp.ErrorReason)
+	}
+	if ctx.Err() != nil {
+		// Shutting down, the item is retried after restart
+		q.release(item, nil)
+		return
+	}
+
+	if err != nil {
+		q.release(item, err)
+		return
+	}
+
+	q.mu.Lock()
+	q.inFlight[item.Network]--
+	item.Status = SettlementSettled
+	item.Attempts++
+	item.Transaction = resp.Transaction
+	item.LastError = ""
+	if err := q.persistLocked(item); err != nil {
+		log.Error().Err(err).Str("id", item.ID).Msg("Failed to persist settled item")
+	}
+	q.mu.Unlock()
+
+	log.Info().
+		Str("id", item.ID).
+		Str("resource", item.Resource).
+		Str("payer", resp.Payer).
+		Str("transaction", resp.Transaction).
+		Msg("Queued payment settled successfully")
+
+	q.notify()
+}
+
+// release returns an in-flight item to the queue after a failed attempt
+// A nil error means the attempt was interrupted and does not count
+func (q *SettlementQueue) release(item *SettlementItem, attemptErr error) {
+	q.mu.Lock()
+	q.inFlight[item.Network]--
+	item.Status = SettlementPending
+
+	if attemptErr != nil {
+		item.Attempts++
+		item.LastError = attemptErr.Error()
+		if item.Attempts >= q.cfg.MaxAttempts {
+			item.Status = SettlementFailed
+		} else {
+			item.NextAttemptAt = time.Now().UTC().Add(q.backoff(item.Attempts))
+		}
+
+		log.Warn().
+			Err(attemptErr).
+			Str("id", item.ID).
+			Str("network", item.Network).
+			Int("attempts", item.Attempts).
+			Str("status", item.Status).
+			Msg("Queued payment settlement attempt failed")
+	}
+
+	if err := q.persistLocked(item); err != nil {
+		log.Error().Err(err).Str("id", item.ID).Msg("Failed to persist settlement item")
+	}
+	snapshot := item.snapshot()
+	q.mu.Unlock()
+
+	if snapshot.Status == SettlementFailed {
+		q.revokePasses(snapshot)
+	}
+	q.notify()
+}
+
+// revokePasses revokes the access passes bought with an item that will not be settled
+func (q *SettlementQueue) revokePasses(item *SettlementItem) {
+	if q.passes == nil {
+		return
+	}
+	count, err := q.passes.RevokeSettlement(item.ID)
+	if err != nil {
+		log.Error().Err(err).Str("id", item.ID).Msg("Failed to revoke access passes of unsettled payment")
+		return
+	}
+	if count > 0 {
+		log.Warn().
+			Str("id", item.ID).
+			Str("payer", item.Payer).
+			Str("status", item.Status).
+			Int("passes", count).
+			Msg("Access passes of unsettled payment revoked")
+	}
+}
+
+// backoff returns the retry delay after the given number of attempts
+func (q *SettlementQueue) backoff(attempts int) time.Duration {
+	delay := q.cfg.InitialBackoff
+	for i := 1; i < attempts && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxBackoff {
+		delay = q.cfg.MaxBackoff
+	}
+	return delay
+}
+
+// persistLocked appends the current item state to the journal; callers must hold q.mu
+func (q *SettlementQueue) persistLocked(item *SettlementItem) error {
+	item.UpdatedAt = time.Now().UTC()
+	if err := q.journal.Append(item); err != nil {
+		return fmt.Errorf("failed to persist settlement item: %w", err)
+	}
+	return nil
+}
+
+// pruneIfDue prunes the queue if settlementPruneInterval has passed since the last prune
+func (q *SettlementQueue) pruneIfDue() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(q.lastPrune) < settlementPruneInterval {
+		return
+	}
+	if err := q.prune(now); err != nil {
+		log.Warn().Err(err).Msg("Failed to prune settlement queue")
+	}
+}
+
+// prune evicts settled and abandoned items older than the retention and compacts the journal
+// callers must hold q.mu (or own q exclusively)
+func (q *SettlementQueue) prune(now time.Time) error {
+	q.lastPrune = now
+
+	records := make([]interface{}, 0, len(q.items))
+	for id, item := range q.items {
+		finished := item.Status == SettlementSettled || item.Status == SettlementAbandoned
+		if finished && now.Sub(item.UpdatedAt) >= q.cfg.Retention {
+			delete(q.items, id)
+			continue
+		}
+		records = append(records, item)
+	}
+
+	if err := q.journal.Rewrite(records); err != nil {
+		return fmt.Errorf("failed to compact settlement queue: %w", err)
+	}
+	return nil
+}
+
+// notify wakes up the scheduler without blocking; safe to call while holding q.mu
+func (q *SettlementQueue) notify() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// snapshot returns a copy of the item that is safe to hand out
+func (item *SettlementItem) snapshot() *SettlementItem {
+	copied := *item
+	return &copied
+}
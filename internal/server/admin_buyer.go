@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-agent-guide/internal/auth"
+	"go-agent-guide/internal/buyer"
+	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/pricing"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buyerBalanceTimeout bounds the RPC calls made to read buyer wallet balances
+const buyerBalanceTimeout = 5 * time.Second
+
+// buyerWalletResponse describes a buyer wallet and its token balance
+type buyerWalletResponse struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Token   string `json:"token"`
+	Balance string `json:"balance,omitempty"` // Token base units
+	Amount  string `json:"amount,omitempty"`  // Human amount, e.g. "12.5"
+	Error   string `json:"error,omitempty"`
+}
+
+// ListBuyerWallets handles GET /admin/buyer/wallets
+// It returns the buyer wallet address of each network and its token balance
+func (s *AdminServer) ListBuyerWallets(c *gin.Context) {
+	wallets := s.services.BuyerWallets.List()
+	responses := make([]buyerWalletResponse, len(wallets))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), buyerBalanceTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, wallet := range wallets {
+		chainNetwork := s.resourceGateway.FindChainNetwork(wallet.Network)
+		responses[i] = buyerWalletResponse{
+			Network: wallet.Network,
+			Address: wallet.Address.Hex(),
+			Token:   chainNetwork.Symbol(),
+		}
+
+		wg.Add(1)
+		go func(response *buyerWalletResponse) {
+			defer wg.Done()
+			balance, err := s.services.BuyerWallets.TokenBalance(ctx, wallet)
+			if err != nil {
+				response.Error = err.Error()
+				return
+			}
+			response.Balance = balance.String()
+			response.Amount = pricing.FormatDecimal(pricing.FromBaseUnits(balance, chainNetwork.TokenDecimals))
+		}(&responses[i])
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, gin.H{
+		"wallets": responses,
+	})
+}
+
+// ListBuyerBudgets handles GET /admin/buyer/budgets
+// It returns the rolling spend of outgoing payments against the global and per-resource budgets
+func (s *AdminServer) ListBuyerBudgets(c *gin.Context) {
+	var proxyResources []*gateway.ResourceConfig
+	if s.services.ForwardProxy != nil {
+		proxyResources = s.services.ForwardProxy.Resources()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"budgets": s.resourceGateway.BudgetUsage(proxyResources...),
+	})
+}
+
+// ListWalletBalances handles GET /admin/buyer/balances
+// It returns the last polled token balances of the buyer and facilitator wallets
+func (s *AdminServer) ListWalletBalances(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"balances":     s.services.BuyerBalances.List(),
+		"pollInterval": s.config.Buyer.Balance.PollInterval.String(),
+	})
+}
+
+// buyerPaymentColumns are the CSV columns of the buyer payment export
+var buyerPaymentColumns = []string{
+	"id", "time", "client", "resource", "method", "url", "scheme", "network", "asset", "pay_to",
+	"payer", "amount", "usd", "nonce", "status", "upstream_status", "transaction", "completed_at",
+}
+
+// ListBuyerPayments handles GET /admin/buyer/payments
+// Filters: client, resource, network, pay_to, status, from and to (RFC 3339 or YYYY-MM-DD), limit.
+// format=csv exports the matching payments as CSV instead of JSON
+func (s *AdminServer) ListBuyerPayments(c *gin.Context) {
+	filter := buyer.PaymentFilter{
+		Client:   c.Query("client"),
+		Resource: c.Query("resource"),
+		Network:  c.Query("network"),
+		PayTo:    c.Query("pay_to"),
+		Status:   c.Query("status"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c.Query("from")); err != nil {
+		respondInvalidQuery(c, "from", err)
+		return
+	}
+	if filter.To, err = parseTimeQuery(c.Query("to")); err != nil {
+		respondInvalidQuery(c, "to", err)
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			respondInvalidQuery(c, "limit", fmt.Errorf("must be a non-negative integer"))
+			return
+		}
+	}
+
+	payments := s.services.BuyerPayments.List(filter)
+
+	switch c.DefaultQuery("format", "json") {
+	case "csv":
+		writeBuyerPaymentsCSV(c, payments)
+	case "json":
+		total := new(big.Rat)
+		for _, payment := range payments {
+			if usd, ok := new(big.Rat).SetString(payment.USD); ok && payment.Status != buyer.PaymentFailed {
+				total.Add(total, usd)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"payments": payments,
+			"count":    len(payments),
+			"totalUsd": pricing.FormatDecimal(total),
+		})
+	default:
+		respondInvalidQuery(c, "format", fmt.Errorf("must be json or csv"))
+	}
+}
+
+// GetBuyerPayment handles GET /admin/buyer/payments/:id
+func (s *AdminServer) GetBuyerPayment(c *gin.Context) {
+	payment, err := s.services.BuyerPayments.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "payment_not_found",
+			Message: err.Error(),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, payment)
+}
+
+// buyerUsageColumns are the CSV columns of the buyer usage report
+var buyerUsageColumns = []string{"day", "client", "resource", "payments", "usd", "unpriced"}
+
+// GetBuyerUsage handles GET /admin/buyer/usage
+// It returns the spend per UTC day, client and resource, excluding failed payments.
+// Filters: client, resource, from and to (RFC 3339 or YYYY-MM-DD); format=csv exports CSV instead of JSON
+func (s *AdminServer) GetBuyerUsage(c *gin.Context) {
+	filter := buyer.PaymentFilter{
+		Client:   c.Query("client"),
+		Resource: c.Query("resource"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c.Query("from")); err != nil {
+		respondInvalidQuery(c, "from", err)
+		return
+	}
+	if filter.To, err = parseTimeQuery(c.Query("to")); err != nil {
+		respondInvalidQuery(c, "to", err)
+		return
+	}
+
+	usage := s.services.BuyerPayments.Usage(filter)
+
+	switch c.DefaultQuery("format", "json") {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="buyer-usage.csv"`)
+		c.Status(http.StatusOK)
+
+		writer := csv.NewWriter(c.Writer)
+		writer.Write(buyerUsageColumns)
+		for _, row := range usage {
+			writer.Write([]string{
+				row.Day, row.Client, row.Resource, strconv.Itoa(row.Payments), row.USD, strconv.Itoa(row.Unpriced),
+			})
+		}
+		writer.Flush()
+	case "json":
+		total := new(big.Rat)
+		for _, row := range usage {
+			if usd, ok := new(big.Rat).SetString(row.USD); ok {
+				total.Add(total, usd)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"usage":    usage,
+			"totalUsd": pricing.FormatDecimal(total),
+		})
+	default:
+		respondInvalidQuery(c, "format", fmt.Errorf("must be json or csv"))
+	}
+}
+
+// writeBuyerPaymentsCSV writes payments as a CSV attachment
+func writeBuyerPaymentsCSV(c *gin.Context, payments []*buyer.Payment) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="buyer-payments.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(buyerPaymentColumns)
+	for _, p := range payments {
+		var transaction, completedAt, upstreamStatus string
+		if p.Settlement != nil {
+			transaction = p.Settlement.Transaction
+		}
+		if p.CompletedAt != nil {
+			completedAt = p.CompletedAt.Format(time.RFC3339)
+		}
+		if p.UpstreamStatus != 0 {
+			upstreamStatus = strconv.Itoa(p.UpstreamStatus)
+		}
+		writer.Write([]string{
+			p.ID, p.Time.Format(time.RFC3339), p.Client, p.Resource, p.Method, p.URL, p.Scheme, p.Network, p.Asset, p.PayTo,
+			p.Payer, p.Amount, p.USD, p.Nonce, p.Status, upstreamStatus, transaction, completedAt,
+		})
+	}
+	writer.Flush()
+}
+
+// parseTimeQuery parses an optional RFC 3339 timestamp or YYYY-MM-DD date (UTC)
+func parseTimeQuery(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+	return t, nil
+}
+
+// respondInvalidQuery writes a 400 response for an invalid query parameter
+func respondInvalidQuery(c *gin.Context, name string, err error) {
+	c.JSON(http.StatusBadRequest, types.ErrorResponse{
+		Error:   "invalid_query",
+		Message: fmt.Sprintf("Invalid %s: %s", name, err.Error()),
+		Code:    http.StatusBadRequest,
+	})
+}
+
+// approvalDecisionRequest is the optional body of an approve or deny request
+type approvalDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListBuyerApprovals handles GET /admin/buyer/approvals?status=pending
+func (s *AdminServer) ListBuyerApprovals(c *gin.Context) {
+	approvals := s.services.BuyerApprovals.List(c.Query("status"))
+	c.JSON(http.StatusOK, gin.H{
+		"approvals": approvals,
+		"count":     len(approvals),
+	})
+}
+
+// GetBuyerApproval handles GET /admin/buyer/approvals/:id
+func (s *AdminServer) GetBuyerApproval(c *gin.Context) {
+	approval, err := s.services.BuyerApprovals.Get(c.Param("id"))
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, approval)
+}
+
+// ApproveBuyerPayment handles POST /admin/buyer/approvals/:id/approve
+// The parked request is signed and retried
+func (s *AdminServer) ApproveBuyerPayment(c *gin.Context) {
+	s.decideBuyerApproval(c, s.services.BuyerApprovals.Approve)
+}
+
+// DenyBuyerPayment handles POST /admin/buyer/approvals/:id/deny
+// The parked request is answered with buyer_payment_denied
+func (s *AdminServer) DenyBuyerPayment(c *gin.Context) {
+	s.decideBuyerApproval(c, s.services.BuyerApprovals.Deny)
+}
+
+// decideBuyerApproval applies an operator decision with an optional {"reason": "..."} body
+func (s *AdminServer) decideBuyerApproval(c *gin.Context, decide func(id, by, reason string) (*buyer.Approval, error)) {
+	var req approvalDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, types.ErrorResponse{
+				Error:   "invalid_request",
+				Message: fmt.Sprintf("Invalid request body: %s", err.Error()),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	decidedBy := "admin"
+	if value, exists := c.Get("admin_principal"); exists {
+		decidedBy = "admin:" + value.(*auth.AdminPrincipal).Name
+	}
+	approval, err := decide(c.Param("id"), decidedBy, req.Reason)
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, approval)
+}
+
+// respondApprovalError writes an error response for approval operations
+func respondApprovalError(c *gin.Context, err error) {
+	if errors.Is(err, buyer.ErrApprovalNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "approval_not_found",
+			Message: err.Error(),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusConflict, types.ErrorResponse{
+		Error:   "approval_already_decided",
+		Message: err.Error(),
+		Code:    http.StatusConflict,
+	})
+}
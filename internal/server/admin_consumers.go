@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-agent-guide/internal/auth"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// issueConsumerKeyRequest represents the body of an issue-key request
+type issueConsumerKeyRequest struct {
+	Consumer  string            `json:"consumer" binding:"required"`
+	Scopes    []string          `json:"scopes" binding:"required"`
+	Metadata  map[string]string `json:"metadata"`
+	ExpiresAt *time.Time        `json:"expiresAt"` // Absolute expiry
+	ExpiresIn string            `json:"expiresIn"` // Or a lifetime such as "720h"
+}
+
+// updateConsumerKeyRequest represents the body of an update-key request; omitted fields are left unchanged
+type updateConsumerKeyRequest struct {
+	Scopes    []string          `json:"scopes"`
+	Metadata  map[string]string `json:"metadata"`
+	ExpiresAt *time.Time        `json:"expiresAt"`
+	ExpiresIn string            `json:"expiresIn"`
+	NoExpiry  bool              `json:"noExpiry"` // Remove the expiry
+}
+
+// IssueConsumerKey handles POST /admin/consumers/keys
+// The API key is only returned in this response; the gateway stores its hash
+func (s *AdminServer) IssueConsumerKey(c *gin.Context) {
+	var req issueConsumerKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	expiresAt, err := consumerKeyExpiry(req.ExpiresAt, req.ExpiresIn)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	key, apiKey, err := s.services.ConsumerKeys.Issue(req.Consumer, req.Scopes, req.Metadata, expiresAt)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	log.Info().Str("consumer_id", key.Consumer).Str("key_id", key.ID).Strs("scopes", key.Scopes).Msg("Consumer key issued")
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    key,
+		"apiKey": apiKey,
+	})
+}
+
+// ListConsumerKeys handles GET /admin/consumers/keys?consumer=...
+func (s *AdminServer) ListConsumerKeys(c *gin.Context) {
+	keys, err := s.services.ConsumerKeys.List(c.Query("consumer"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"keys":  keys,
+		"count": len(keys),
+	})
+}
+
+// GetConsumerKey handles GET /admin/consumers/keys/:id
+func (s *AdminServer) GetConsumerKey(c *gin.Context) {
+	key, err := s.services.ConsumerKeys.Get(c.Param("id"))
+	if err != nil {
+		respondConsumerKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// UpdateConsumerKey handles PATCH /admin/consumers/keys/:id
+// It changes the scopes, metadata or expiry of a key
+func (s *AdminServer) UpdateConsumerKey(c *gin.Context) {
+	var req updateConsumerKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	update := auth.ConsumerKeyUpdate{
+		Scopes:   req.Scopes,
+		Metadata: req.Metadata,
+	}
+	if req.NoExpiry {
+		update.ExpiresAt = &time.Time{}
+	} else {
+		expiresAt, err := consumerKeyExpiry(req.ExpiresAt, req.ExpiresIn)
+		if err != nil {
+			respondInvalidRequest(c, err)
+			return
+		}
+		update.ExpiresAt = expiresAt
+	}
+
+	key, err := s.services.ConsumerKeys.Update(c.Param("id"), update)
+	if err != nil {
+		respondConsumerKeyError(c, err)
+		return
+	}
+
+	log.Info().Str("consumer_id", key.Consumer).Str("key_id", key.ID).Msg("Consumer key updated")
+	c.JSON(http.StatusOK, key)
+}
+
+// RevokeConsumerKey handles DELETE /admin/consumers/keys/:id
+func (s *AdminServer) RevokeConsumerKey(c *gin.Context) {
+	key, err := s.services.ConsumerKeys.Revoke(c.Param("id"))
+	if err != nil {
+		respondConsumerKeyError(c, err)
+		return
+	}
+
+	log.Warn().Str("consumer_id", key.Consumer).Str("key_id", key.ID).Msg("Consumer key revoked")
+	c.JSON(http.StatusOK, key)
+}
+
+// consumerKeyExpiry resolves an absolute expiry or a lifetime into an expiry time, nil if neither is set
+func consumerKeyExpiry(expiresAt *time.Time, expiresIn string) (*time.Time, error) {
+	if expiresAt != nil && expiresIn != "" {
+		return nil, fmt.Errorf("expiresAt and expiresIn are mutually exclusive")
+	}
+	if expiresIn != "" {
+		lifetime, err := time.ParseDuration(expiresIn)
+		if err != nil || lifetime <= 0 {
+			return nil, fmt.Errorf("invalid expiresIn %q", expiresIn)
+		}
+		expiry := time.Now().UTC().Add(lifetime)
+		return &expiry, nil
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expiresAt must be in the future")
+	}
+	return expiresAt, nil
+}
+
+// respondConsumerKeyError maps consumer key store errors to responses
+func respondConsumerKeyError(c *gin.Context, err error) {
+	if errors.Is(err, auth.ErrConsumerKeyNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "consumer_key_not_found",
+			Message: err.Error(),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+	respondInvalidRequest(c, err)
+}
+
+// respondInvalidRequest responds with 400 for an invalid request body
+func respondInvalidRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, types.ErrorResponse{
+		Error:   "invalid_request",
+		Message: fmt.Sprintf("Invalid request: %s", err.Error()),
+		Code:    http.StatusBadRequest,
+	})
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-agent-guide/internal/seller"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// creditAccountView is the admin representation of a credit account
+type creditAccountView struct {
+	*seller.CreditAccount
+	BalanceUSD string `json:"balanceUsd"`
+}
+
+// ListCreditAccounts handles GET /admin/credits/accounts
+func (s *AdminServer) ListCreditAccounts(c *gin.Context) {
+	accounts := s.services.CreditLedger.Accounts()
+
+	views := make([]creditAccountView, 0, len(accounts))
+	for _, account := range accounts {
+		views = append(views, creditAccountView{
+			CreditAccount: account,
+			BalanceUSD:    seller.FormatCredits(account.Balance),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts": views,
+		"count":    len(views),
+	})
+}
+
+// GetCreditAccount handles GET /admin/credits/accounts/:address?limit=100
+// It returns the account balance and its most recent ledger entries
+func (s *AdminServer) GetCreditAccount(c *gin.Context) {
+	address := c.Param("address")
+
+	account, err := s.services.CreditLedger.Account(address)
+	if err != nil {
+		respondCreditsError(c, err)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		limit = 100
+	}
+
+	entries, err := s.services.CreditLedger.Entries(address, limit)
+	if err != nil {
+		respondCreditsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account": creditAccountView{
+			CreditAccount: account,
+			BalanceUSD:    seller.FormatCredits(account.Balance),
+		},
+		"entries": entries,
+	})
+}
+
+// RevokeCreditKey handles DELETE /admin/credits/accounts/:address/key
+func (s *AdminServer) RevokeCreditKey(c *gin.Context) {
+	address := c.Param("address")
+
+	if err := s.services.CreditLedger.RevokeKey(address); err != nil {
+		respondCreditsError(c, err)
+		return
+	}
+
+	log.Warn().Str("address", address).Msg("Credits API key revoked")
+	c.Status(http.StatusNoContent)
+}
+
+// respondCreditsError writes an error response for credit ledger operations
+func respondCreditsError(c *gin.Context, err error) {
+	if errors.Is(err, seller.ErrCreditAccountNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "credit_account_not_found",
+			Message: err.Error(),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+		Error:   "internal_error",
+		Message: err.Error(),
+		Code:    http.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetIPFilter handles GET /admin/ip-filter
+// It returns the IP lists in effect and the state of the lists file
+func (s *AdminServer) GetIPFilter(c *gin.Context) {
+	c.JSON(http.StatusOK, s.services.IPFilter.Status())
+}
+
+// ReloadIPFilter handles POST /admin/ip-filter/reload
+// It reads the lists file without waiting for the next change check
+func (s *AdminServer) ReloadIPFilter(c *gin.Context) {
+	if err := s.services.IPFilter.Reload(); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "ip_filter_reload_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	log.Info().Str("admin", c.GetString("admin_identity")).Msg("IP filter lists reloaded")
+	c.JSON(http.StatusOK, s.services.IPFilter.Status())
+}
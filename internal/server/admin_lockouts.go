@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-agent-guide/internal/auth"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// unlockRequest represents the body of an unlock request
+type unlockRequest struct {
+	Scope string `json:"scope" binding:"required,oneof=gateway admin"`
+	Key   string `json:"key" binding:"required"` // "ip:<address>" or "credential:<prefix>"
+}
+
+// ListLockouts handles GET /admin/lockouts
+// It returns the client IPs and credentials locked after failed authentication
+func (s *AdminServer) ListLockouts(c *gin.Context) {
+	lockouts := s.services.AuthFailures.Lockouts()
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+		"count":    len(lockouts),
+	})
+}
+
+// ListLockoutEvents handles GET /admin/lockouts/events?limit=...
+// It returns recent lockout and unlock events, newest first
+func (s *AdminServer) ListLockoutEvents(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 0 {
+		respondInvalidQuery(c, "limit", fmt.Errorf("must be a non-negative integer"))
+		return
+	}
+
+	events := s.services.AuthFailures.Events(limit)
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// UnlockLockout handles POST /admin/lockouts/unlock
+// It lifts a lockout before its duration passes
+func (s *AdminServer) UnlockLockout(c *gin.Context) {
+	var req unlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	if !s.services.AuthFailures.Unlock(req.Scope, req.Key) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "lockout_not_found",
+			Message: fmt.Sprintf("%s is not locked in scope %s", req.Key, req.Scope),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	log.Info().
+		Str("admin", c.GetString("admin_identity")).
+		Str("scope", req.Scope).
+		Str("key", req.Key).
+		Msg("Authentication lockout lifted by admin")
+	c.JSON(http.StatusOK, gin.H{
+		"scope":  req.Scope,
+		"key":    req.Key,
+		"reason": auth.UnlockAdmin,
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go-agent-guide/internal/seller"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// revokePayerPassesRequest represents the body of a revoke-by-payer request
+type revokePayerPassesRequest struct {
+	Payer string `json:"payer" binding:"required"`
+}
+
+// ListPasses handles GET /admin/passes?payer=0x...
+func (s *AdminServer) ListPasses(c *gin.Context) {
+	passes := s.services.PassIssuer.List(c.Query("payer"))
+	c.JSON(http.StatusOK, gin.H{
+		"passes": passes,
+		"count":  len(passes),
+	})
+}
+
+// RevokePass handles DELETE /admin/passes/:id
+func (s *AdminServer) RevokePass(c *gin.Context) {
+	pass, err := s.services.PassIssuer.Revoke(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, seller.ErrPassNotFound) {
+			c.JSON(http.StatusNotFound, types.ErrorResponse{
+				Error:   "pass_not_found",
+				Message: err.Error(),
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	log.Warn().Str("pass_id", pass.ID).Str("payer", pass.Payer).Msg("Access pass revoked")
+	c.JSON(http.StatusOK, pass)
+}
+
+// RevokePayerPasses handles POST /admin/passes/revoke
+// It revokes all active passes issued to a payer address
+func (s *AdminServer) RevokePayerPasses(c *gin.Context) {
+	var req revokePayerPassesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Invalid request body: %s", err.Error()),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	count, err := s.services.PassIssuer.RevokePayer(req.Payer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	log.Warn().Str("payer", req.Payer).Int("count", count).Msg("Access passes revoked for payer")
+	c.JSON(http.StatusOK, gin.H{
+		"payer":   req.Payer,
+		"revoked": count,
+	})
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// setRateRequest represents the body of a rate update request
+type setRateRequest struct {
+	Rate string `json:"rate" binding:"required"` // USD price of one whole token, e.g. "3000.50"
+}
+
+// ListRates handles GET /admin/pricing/rates
+func (s *AdminServer) ListRates(c *gin.Context) {
+	rates := s.resourceGateway.Rates()
+	c.JSON(http.StatusOK, gin.H{
+		"rates":     rates.Rates(),
+		"usdPegged": rates.PeggedSymbols(),
+	})
+}
+
+// SetRate handles PUT /admin/pricing/rates/:symbol
+func (s *AdminServer) SetRate(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	var req setRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Invalid request body: %s", err.Error()),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := s.resourceGateway.Rates().SetRate(symbol, req.Rate); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "invalid_rate",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	log.Info().Str("symbol", symbol).Str("rate", req.Rate).Msg("Pricing rate updated")
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol": symbol,
+		"rate":   s.resourceGateway.Rates().Rates()[symbol],
+	})
+}
+
+// DeleteRate handles DELETE /admin/pricing/rates/:symbol
+// A rate that a priced resource still needs is not deleted, since the resource could no longer be paid for
+func (s *AdminServer) DeleteRate(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	if endpoints := s.resourceGateway.ResourcesUsingRate(symbol); len(endpoints) > 0 {
+		c.JSON(http.StatusConflict, types.ErrorResponse{
+			Error:   "rate_in_use",
+			Message: fmt.Sprintf("Rate for %s is used by the prices of %s", symbol, strings.Join(endpoints, ", ")),
+			Code:    http.StatusConflict,
+		})
+		return
+	}
+
+	if !s.resourceGateway.Rates().DeleteRate(symbol) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "rate_not_found",
+			Message: fmt.Sprintf("No rate configured for %s", symbol),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	log.Info().Str("symbol", symbol).Msg("Pricing rate deleted")
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,10 +3,13 @@ package server
 import (
 	"context"
 	"fmt"
+	"go-agent-guide/internal/auth"
 	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/gateway"
 	"go-agent-guide/internal/middleware"
 	"github.com/agent-guide/go-x402-facilitator/pkg/facilitator"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -17,21 +20,31 @@ import (
 // AdminServer represents the admin HTTP server
 // It handles management endpoints with AdminAuthMiddleware
 type AdminServer struct {
-	config      *config.Config
-	facilitator facilitator.PaymentFacilitator
-	httpServer  *http.Server
+	config          *config.Config
+	facilitator     facilitator.PaymentFacilitator
+	resourceGateway *gateway.ResourceGateway
+	services        *Services
+	httpServer      *http.Server
 }
 
 // NewAdminServer creates a new admin HTTP server
-func NewAdminServer(cfg *config.Config, f facilitator.PaymentFacilitator) *AdminServer {
+func NewAdminServer(cfg *config.Config, services *Services) *AdminServer {
 	return &AdminServer{
-		config:      cfg,
-		facilitator: f,
+		config:          cfg,
+		facilitator:     services.Facilitator,
+		resourceGateway: services.ResourceGateway,
+		services:        services,
 	}
 }
 
 // setupAdminMiddleware configures the middleware for the admin server
-func (s *AdminServer) setupAdminMiddleware(router *gin.Engine) {
+func (s *AdminServer) setupAdminMiddleware(router *gin.Engine) error {
+	// Resolve the client IP from forwarding headers only when the peer is a trusted proxy
+	serverCfg := s.config.AdminServer
+	if err := configureClientIP(router, serverCfg.TrustedProxies, serverCfg.ClientIPHeaders); err != nil {
+		return fmt.Errorf("invalid admin server trusted_proxies: %w", err)
+	}
+
 	// Add logging middleware
 	router.Use(gin.Logger())
 
@@ -47,9 +60,16 @@ func (s *AdminServer) setupAdminMiddleware(router *gin.Engine) {
 	})
 	router.Use(middleware.CorsMiddleware(c))
 
+	// Refuse clients outside the admin IP allow list before authentication
+	router.Use(middleware.AdminIPFilterMiddleware(s.services.IPFilter))
+
 	// Add authentication middleware if enabled
 	if s.config.AdminServer.AuthEnabled {
-		router.Use(middleware.AdminAuthMiddleware(s.config.AdminServer))
+		principals, err := auth.NewAdminPrincipals(s.config.AdminServer)
+		if err != nil {
+			return fmt.Errorf("invalid admin server auth configuration: %w", err)
+		}
+		router.Use(middleware.AdminAuthMiddleware(s.config.AdminServer, principals, s.services.AdminAudit, s.services.AuthFailures))
 	}
 
 	// Add metrics middleware if enabled
@@ -59,6 +79,7 @@ func (s *AdminServer) setupAdminMiddleware(router *gin.Engine) {
 
 	// Add request ID middleware
 	router.Use(middleware.RequestIDMiddleware())
+	return nil
 }
 
 // Start starts the admin HTTP server
@@ -74,7 +95,9 @@ func (s *AdminServer) Start() error {
 	router := gin.New()
 
 	// Add middleware
-	s.setupAdminMiddleware(router)
+	if err := s.setupAdminMiddleware(router); err != nil {
+		return err
+	}
 
 	// Register admin routes
 	router.GET("/health", s.Health)
@@ -85,6 +108,63 @@ func (s *AdminServer) Start() error {
 		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	}
 
+	// Register management API routes; each group requires a role to read and a role to change
+	admin := router.Group("/admin")
+	{
+		pricing := admin.Group("/pricing", s.requireRole(auth.RoleViewer, auth.RoleAdmin))
+		pricing.GET("/rates", s.ListRates)
+		pricing.PUT("/rates/:symbol", s.SetRate)
+		pricing.DELETE("/rates/:symbol", s.DeleteRate)
+
+		settlements := admin.Group("/settlements", s.requireRole(auth.RoleViewer, auth.RoleOperator))
+		settlements.GET("", s.ListSettlements)
+		settlements.GET("/stats", s.SettlementStats)
+		settlements.GET("/:id", s.GetSettlement)
+		settlements.POST("/:id/retry", s.RetrySettlement)
+		settlements.POST("/:id/abandon", s.AbandonSettlement)
+
+		credits := admin.Group("/credits", s.requireRole(auth.RoleViewer, auth.RoleOperator))
+		credits.GET("/accounts", s.ListCreditAccounts)
+		credits.GET("/accounts/:address", s.GetCreditAccount)
+		credits.DELETE("/accounts/:address/key", s.RevokeCreditKey)
+
+		passes := admin.Group("/passes", s.requireRole(auth.RoleViewer, auth.RoleOperator))
+		passes.GET("", s.ListPasses)
+		passes.DELETE("/:id", s.RevokePass)
+		passes.POST("/revoke", s.RevokePayerPasses)
+
+		consumers := admin.Group("/consumers", s.requireRole(auth.RoleOperator, auth.RoleAdmin))
+		consumers.POST("/keys", s.IssueConsumerKey)
+		consumers.GET("/keys", s.ListConsumerKeys)
+		consumers.GET("/keys/:id", s.GetConsumerKey)
+		consumers.PATCH("/keys/:id", s.UpdateConsumerKey)
+		consumers.DELETE("/keys/:id", s.RevokeConsumerKey)
+
+		buyer := admin.Group("/buyer", s.requireRole(auth.RoleViewer, auth.RoleOperator))
+		buyer.GET("/wallets", s.ListBuyerWallets)
+		buyer.GET("/budgets", s.ListBuyerBudgets)
+		buyer.GET("/balances", s.ListWalletBalances)
+		buyer.GET("/payments", s.ListBuyerPayments)
+		buyer.GET("/payments/:id", s.GetBuyerPayment)
+		buyer.GET("/usage", s.GetBuyerUsage)
+		buyer.GET("/approvals", s.ListBuyerApprovals)
+		buyer.GET("/approvals/:id", s.GetBuyerApproval)
+		buyer.POST("/approvals/:id/approve", s.ApproveBuyerPayment)
+		buyer.POST("/approvals/:id/deny", s.DenyBuyerPayment)
+
+		audit := admin.Group("/audit", s.requireRole(auth.RoleAdmin, auth.RoleAdmin))
+		audit.GET("", s.ListAuditLog)
+
+		ipFilter := admin.Group("/ip-filter", s.requireRole(auth.RoleViewer, auth.RoleAdmin))
+		ipFilter.GET("", s.GetIPFilter)
+		ipFilter.POST("/reload", s.ReloadIPFilter)
+
+		lockouts := admin.Group("/lockouts", s.requireRole(auth.RoleViewer, auth.RoleAdmin))
+		lockouts.GET("", s.ListLockouts)
+		lockouts.GET("/events", s.ListLockoutEvents)
+		lockouts.POST("/unlock", s.UnlockLockout)
+	}
+
 	// Create HTTP server
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.AdminServer.Host, s.config.AdminServer.Port),
@@ -96,9 +176,10 @@ func (s *AdminServer) Start() error {
 
 	log.Info().
 		Str("address", s.httpServer.Addr).
+		Bool("tls", s.config.AdminServer.TLS.Enabled).
 		Msg("Starting admin HTTP server")
 
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := listenAndServe(s.httpServer, "admin_server", s.config.AdminServer.TLS); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start admin server: %w", err)
 	}
 
@@ -142,3 +223,24 @@ func (s *AdminServer) Ready(c *gin.Context) {
 		"status": "ready",
 	})
 }
+
+// requireRole returns the role check of an admin route group
+func (s *AdminServer) requireRole(read, write string) gin.HandlerFunc {
+	return middleware.RequireAdminRole(read, write, s.services.AdminAudit)
+}
+
+// ListAuditLog handles GET /admin/audit?limit=100
+// It returns the most recent denied admin requests, newest first
+func (s *AdminServer) ListAuditLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 0 {
+		respondInvalidQuery(c, "limit", fmt.Errorf("must be a non-negative integer"))
+		return
+	}
+
+	entries := s.services.AdminAudit.List(limit)
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
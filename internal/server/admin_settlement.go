@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"go-agent-guide/internal/seller"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ListSettlements handles GET /admin/settlements?status=failed
+func (s *AdminServer) ListSettlements(c *gin.Context) {
+	items := s.services.SettlementQueue.List(c.Query("status"))
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// SettlementStats handles GET /admin/settlements/stats
+func (s *AdminServer) SettlementStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"mode":  s.config.Seller.Settlement.Mode,
+		"stats": s.services.SettlementQueue.Stats(),
+	})
+}
+
+// GetSettlement handles GET /admin/settlements/:id
+func (s *AdminServer) GetSettlement(c *gin.Context) {
+	item, err := s.services.SettlementQueue.Get(c.Param("id"))
+	if err != nil {
+		respondSettlementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// RetrySettlement handles POST /admin/settlements/:id/retry
+func (s *AdminServer) RetrySettlement(c *gin.Context) {
+	item, err := s.services.SettlementQueue.Retry(c.Param("id"))
+	if err != nil {
+		respondSettlementError(c, err)
+		return
+	}
+
+	log.Info().Str("id", item.ID).Msg("Settlement manually retried")
+	c.JSON(http.StatusOK, item)
+}
+
+// AbandonSettlement handles POST /admin/settlements/:id/abandon
+func (s *AdminServer) AbandonSettlement(c *gin.Context) {
+	item, err := s.services.SettlementQueue.Abandon(c.Param("id"))
+	if err != nil {
+		respondSettlementError(c, err)
+		return
+	}
+
+	log.Warn().Str("id", item.ID).Str("payer", item.Payer).Msg("Settlement abandoned")
+	c.JSON(http.StatusOK, item)
+}
+
+// respondSettlementError writes an error response for settlement queue operations
+func respondSettlementError(c *gin.Context, err error) {
+	if errors.Is(err, seller.ErrSettlementNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "settlement_not_found",
+			Message: err.Error(),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusConflict, types.ErrorResponse{
+		Error:   "invalid_settlement_state",
+		Message: err.Error(),
+		Code:    http.StatusConflict,
+	})
+}
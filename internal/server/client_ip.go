@@ -0,0 +1,13 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// configureClientIP makes c.ClientIP() read the client IP headers only on requests from trusted proxies
+// Without trusted proxies the client IP is the peer address, so it cannot be spoofed with X-Forwarded-For.
+func configureClientIP(router *gin.Engine, trustedProxies, headers []string) error {
+	router.ForwardedByClientIP = len(trustedProxies) > 0
+	router.RemoteIPHeaders = headers
+	return router.SetTrustedProxies(trustedProxies)
+}
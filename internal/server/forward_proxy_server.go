@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ForwardProxyServer represents the optional forward-proxy HTTP server
+// Agents send absolute-URL requests or /proxy?url= requests; upstream 402 responses are paid by the buyer
+type ForwardProxyServer struct {
+	config       *config.Config
+	forwardProxy *gateway.ForwardProxy
+	httpServer   *http.Server
+}
+
+// NewForwardProxyServer creates a new forward-proxy HTTP server
+func NewForwardProxyServer(cfg *config.Config, services *Services) *ForwardProxyServer {
+	return &ForwardProxyServer{
+		config:       cfg,
+		forwardProxy: services.ForwardProxy,
+	}
+}
+
+// Start starts the forward-proxy HTTP server
+func (s *ForwardProxyServer) Start() error {
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	// Agents connect directly, so forwarding headers are never trusted
+	if err := configureClientIP(router, nil, nil); err != nil {
+		return err
+	}
+	router.Use(gin.Logger())
+	router.Use(gin.Recovery())
+	router.Use(middleware.RequestIDMiddleware())
+
+	// Absolute-form requests carry arbitrary paths, so every request goes to the proxy handler
+	router.NoRoute(s.forwardProxy.Handle)
+
+	proxyCfg := s.config.ForwardProxy
+	s.httpServer = &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", proxyCfg.Host, proxyCfg.Port),
+		Handler:      router,
+		ReadTimeout:  proxyCfg.ReadTimeout,
+		WriteTimeout: proxyCfg.WriteTimeout,
+		IdleTimeout:  proxyCfg.IdleTimeout,
+	}
+
+	log.Info().
+		Str("address", s.httpServer.Addr).
+		Msg("Starting forward proxy HTTP server")
+
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to start forward proxy server: %w", err)
+	}
+
+	return nil
+}
+
+// Stop stops the forward-proxy HTTP server gracefully
+func (s *ForwardProxyServer) Stop(ctx context.Context) error {
+	log.Info().Msg("Shutting down forward proxy HTTP server")
+
+	if s.httpServer == nil {
+		return nil
+	}
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown forward proxy server: %w", err)
+	}
+
+	log.Info().Msg("Forward proxy HTTP server stopped successfully")
+	return nil
+}
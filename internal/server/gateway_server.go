@@ -8,7 +8,9 @@ import (
 	"go-agent-guide/internal/config"
 	"go-agent-guide/internal/gateway"
 	"go-agent-guide/internal/middleware"
+	"go-agent-guide/internal/seller"
 	"github.com/agent-guide/go-x402-facilitator/pkg/facilitator"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/cors"
@@ -16,23 +18,24 @@ import (
 )
 
 // GatewayServer represents the gateway HTTP server
-// It handles resource requests with ResourceAuthMiddleware and ResourceX402SellerMiddleware
+// It handles resource requests with ResourceAuthMiddleware, ResourceTokenGateMiddleware and ResourceX402SellerMiddleware
 type GatewayServer struct {
 	config          *config.Config
 	facilitator     facilitator.PaymentFacilitator
 	httpServer      *http.Server
+	services        *Services
 	resourceGateway *gateway.ResourceGateway
 	resourceHandler *ResourceHandler
 }
 
 // NewGatewayServer creates a new gateway HTTP server
-func NewGatewayServer(cfg *config.Config, f facilitator.PaymentFacilitator) *GatewayServer {
-	resourceGateway := gateway.NewResourceGateway(f, cfg)
+func NewGatewayServer(cfg *config.Config, services *Services) *GatewayServer {
 	return &GatewayServer{
 		config:          cfg,
-		facilitator:     f,
-		resourceGateway: resourceGateway,
-		resourceHandler: NewResourceHandler(resourceGateway),
+		facilitator:     services.Facilitator,
+		services:        services,
+		resourceGateway: services.ResourceGateway,
+		resourceHandler: NewResourceHandler(services.ResourceGateway, services.CreditLedger),
 	}
 }
 
@@ -45,14 +48,40 @@ func (s *GatewayServer) Start() error {
 	router := gin.New()
 
 	// Add basic middleware
-	s.setupGatewayMiddleware(router)
+	if err := s.setupGatewayMiddleware(router); err != nil {
+		return err
+	}
 
 	// Create resource-specific middlewares (auth and payment)
-	authMiddleware := middleware.ResourceAuthMiddleware(s.resourceGateway)
-	x402SellerMiddleware := middleware.ResourceX402SellerMiddleware(s.facilitator, s.resourceGateway)
+	authMiddleware := middleware.ResourceAuthMiddleware(s.resourceGateway, middleware.AuthOptions{
+		ConsumerKeys: s.services.ConsumerKeys,
+		WalletAuth:   s.services.WalletAuth,
+		Failures:     s.services.AuthFailures,
+	})
+	sellerOptions := middleware.SellerOptions{
+		NonceStore: s.services.NonceStore,
+		Passes:     s.services.PassIssuer,
+	}
+	if s.config.Seller.Settlement.Mode == "async" {
+		sellerOptions.SettlementQueue = s.services.SettlementQueue
+	}
+	x402SellerMiddleware := middleware.ResourceX402SellerMiddleware(s.facilitator, s.resourceGateway, sellerOptions)
+
+	rateLimitMiddleware := middleware.ResourceRateLimitMiddleware(s.resourceGateway, s.services.RateLimits)
+	concurrencyMiddleware := middleware.ResourceConcurrencyMiddleware(s.resourceGateway)
+	tokenGateMiddleware := middleware.ResourceTokenGateMiddleware(s.resourceGateway, s.services.WalletAuth)
+
+	creditsMiddleware := middleware.ResourceCreditsMiddleware(s.resourceGateway, s.services.CreditLedger, s.config.Credits)
+
+	// Register credit balance route
+	router.GET("/credits/balance", s.HandleCreditsBalance)
+
+	// Register wallet sign-in routes
+	router.GET("/auth/challenge", s.HandleWalletChallenge)
+	router.POST("/auth/session", s.HandleWalletSession)
 
 	// Register resource routes
-	s.resourceHandler.RegisterRoutes(router, authMiddleware, x402SellerMiddleware)
+	s.resourceHandler.RegisterRoutes(router, authMiddleware, rateLimitMiddleware, concurrencyMiddleware, tokenGateMiddleware, creditsMiddleware, x402SellerMiddleware)
 
 	// Create HTTP server
 	s.httpServer = &http.Server{
@@ -65,9 +94,10 @@ func (s *GatewayServer) Start() error {
 
 	log.Info().
 		Str("address", s.httpServer.Addr).
+		Bool("tls", s.config.GatewayServer.TLS.Enabled).
 		Msg("Starting gateway HTTP server")
 
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := listenAndServe(s.httpServer, "gateway_server", s.config.GatewayServer.TLS); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start gateway server: %w", err)
 	}
 
@@ -90,8 +120,45 @@ func (s *GatewayServer) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HandleCreditsBalance handles the /credits/balance endpoint
+func (s *GatewayServer) HandleCreditsBalance(c *gin.Context) {
+	apiKey := c.GetHeader(seller.CreditsKeyHeader)
+	if apiKey == "" {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "missing_credits_key",
+			Message: "Credits API key is required in the " + seller.CreditsKeyHeader + " header",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	account, err := s.services.CreditLedger.AccountByKey(apiKey)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   "invalid_credits_key",
+			Message: "Invalid or revoked credits API key",
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"address":       account.Address,
+		"balance":       seller.FormatCredits(account.Balance),
+		"currency":      "USD",
+		"topupResource": s.config.Credits.TopupResource,
+		"updatedAt":     account.UpdatedAt,
+	})
+}
+
 // setupGatewayMiddleware configures the middleware for the gateway server
-func (s *GatewayServer) setupGatewayMiddleware(router *gin.Engine) {
+func (s *GatewayServer) setupGatewayMiddleware(router *gin.Engine) error {
+	// Resolve the client IP from forwarding headers only when the peer is a trusted proxy
+	serverCfg := s.config.GatewayServer
+	if err := configureClientIP(router, serverCfg.TrustedProxies, serverCfg.ClientIPHeaders); err != nil {
+		return fmt.Errorf("invalid gateway server trusted_proxies: %w", err)
+	}
+
 	// Add logging middleware
 	router.Use(gin.Logger())
 
@@ -109,4 +176,8 @@ func (s *GatewayServer) setupGatewayMiddleware(router *gin.Engine) {
 
 	// Add request ID middleware
 	router.Use(middleware.RequestIDMiddleware())
+
+	// Refuse clients outside the IP allow lists before any authentication or payment
+	router.Use(middleware.GatewayIPFilterMiddleware(s.services.IPFilter, s.resourceGateway))
+	return nil
 }
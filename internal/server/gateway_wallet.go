@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-agent-guide/internal/auth"
+	"github.com/agent-guide/go-x402-facilitator/pkg/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// walletSignInStatement is the statement of the sign-in messages prepared by /auth/challenge
+const walletSignInStatement = "Sign in to the agent gateway."
+
+// walletSessionRequest represents the body of a wallet sign-in request
+type walletSessionRequest struct {
+	Message   string `json:"message" binding:"required"`   // EIP-4361 message containing a challenge nonce
+	Signature string `json:"signature" binding:"required"` // EIP-191 personal_sign signature of the message, 0x-prefixed hex
+}
+
+// HandleWalletChallenge handles GET /auth/challenge?address=...&chainId=...
+// It issues a sign-in nonce; with an address, the nonce is bound to it and a ready-to-sign message is returned
+func (s *GatewayServer) HandleWalletChallenge(c *gin.Context) {
+	domain := s.services.WalletAuth.Domain()
+	if domain == "" {
+		respondWalletSignInDisabled(c)
+		return
+	}
+
+	address := c.Query("address")
+	challenge, err := s.services.WalletAuth.Challenge(address)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	uri := scheme + "://" + domain
+
+	response := gin.H{
+		"nonce":     challenge.Nonce,
+		"domain":    domain,
+		"uri":       uri,
+		"chainIds":  s.services.WalletAuth.ChainIDs(),
+		"issuedAt":  challenge.IssuedAt,
+		"expiresAt": challenge.ExpiresAt,
+	}
+
+	if address != "" {
+		chainID := uint64(1)
+		if chainIDs := s.services.WalletAuth.ChainIDs(); len(chainIDs) > 0 {
+			chainID = chainIDs[0]
+		}
+		if value := c.Query("chainId"); value != "" {
+			if chainID, err = strconv.ParseUint(value, 10, 64); err != nil {
+				respondInvalidRequest(c, err)
+				return
+			}
+		}
+
+		expiresAt := challenge.ExpiresAt
+		message := &auth.SIWEMessage{
+			Domain:         domain,
+			Address:        common.HexToAddress(address),
+			Statement:      walletSignInStatement,
+			URI:            uri,
+			Version:        "1",
+			ChainID:        chainID,
+			Nonce:          challenge.Nonce,
+			IssuedAt:       challenge.IssuedAt.Truncate(time.Second),
+			ExpirationTime: &expiresAt,
+		}
+		response["address"] = challenge.Address
+		response["message"] = message.String()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleWalletSession handles POST /auth/session
+// It verifies a signed sign-in message and returns a session token bound to the wallet address
+func (s *GatewayServer) HandleWalletSession(c *gin.Context) {
+	if s.services.WalletAuth.Domain() == "" {
+		respondWalletSignInDisabled(c)
+		return
+	}
+
+	var req walletSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	session, err := s.services.WalletAuth.Login(req.Message, req.Signature)
+	if err != nil {
+		code := "invalid_signin"
+		if errors.Is(err, auth.ErrWalletSignature) {
+			code = "invalid_signature"
+		}
+		log.Debug().Err(err).Str("client_ip", c.ClientIP()).Msg("Wallet sign-in rejected")
+		c.JSON(http.StatusUnauthorized, types.ErrorResponse{
+			Error:   code,
+			Message: err.Error(),
+			Code:    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	log.Info().Str("wallet_address", session.Address).Uint64("chain_id", session.ChainID).Msg("Wallet signed in")
+	c.JSON(http.StatusOK, session)
+}
+
+// respondWalletSignInDisabled writes a 503 response when no wallet_auth domain is configured
+func respondWalletSignInDisabled(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, types.ErrorResponse{
+		Error:   "wallet_signin_disabled",
+		Message: "Wallet sign-in requires wallet_auth.domain to be configured",
+		Code:    http.StatusServiceUnavailable,
+	})
+}
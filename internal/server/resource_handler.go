@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/seller"
 	"github.com/agent-guide/go-x402-facilitator/pkg/types"
 
 	"github.com/gin-gonic/gin"
@@ -16,17 +17,20 @@ import (
 // ResourceHandler handles HTTP routes for resources
 type ResourceHandler struct {
 	resourceGateway *gateway.ResourceGateway
+	creditLedger    *seller.CreditLedger
 }
 
 // NewResourceHandler creates a new resource handler
-func NewResourceHandler(resourceGateway *gateway.ResourceGateway) *ResourceHandler {
+func NewResourceHandler(resourceGateway *gateway.ResourceGateway, creditLedger *seller.CreditLedger) *ResourceHandler {
 	return &ResourceHandler{
 		resourceGateway: resourceGateway,
+		creditLedger:    creditLedger,
 	}
 }
 
 // RegisterRoutes registers all API routes
-func (h *ResourceHandler) RegisterRoutes(router *gin.Engine, authMiddleware, payMiddleware gin.HandlerFunc) {
+// Resource middlewares are applied in the given order (e.g. auth, credits, payment)
+func (h *ResourceHandler) RegisterRoutes(router *gin.Engine, resourceMiddlewares ...gin.HandlerFunc) {
 	discover := router.Group("/discover")
 	{
 		discover.GET("/resources", h.HandleDiscoverResources)
@@ -49,9 +53,8 @@ func (h *ResourceHandler) RegisterRoutes(router *gin.Engine, authMiddleware, pay
 		// Create a route group for each resource
 		resourceGroup := router.Group(normalizedPath)
 		{
-			// Apply auth middleware first, then payment middleware
-			resourceGroup.Use(authMiddleware)
-			resourceGroup.Use(payMiddleware)
+			// Apply auth middleware first, then payment middlewares
+			resourceGroup.Use(resourceMiddlewares...)
 			// Register both exact path and wildcard path to avoid 301 redirect
 			// Exact path: matches /api/premium-data
 			resourceGroup.Any("", h.HandleResourceRequest)
@@ -92,10 +95,77 @@ func (h *ResourceHandler) HandleResourceRequest(c *gin.Context) {
 		return
 	}
 
+	// Credit top-up resources are served by the gateway itself
+	if resource.Billing == "topup" {
+		h.handleCreditsTopup(c, resource)
+		return
+	}
+
 	// All middlewares passed, proxy the request
 	h.resourceGateway.ProxyRequest(c, resource)
 }
 
+// handleCreditsTopup credits the payer with the USD value of the payment made to a top-up resource
+func (h *ResourceHandler) handleCreditsTopup(c *gin.Context, resource *gateway.ResourceConfig) {
+	payer := c.GetString("payment_payer")
+	if payer == "" || resource.X402 == nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Top-up resource requires the x402-seller middleware",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	usd, err := h.resourceGateway.PaymentValueUSD(resource.X402)
+	if err != nil {
+		log.Error().Err(err).Str("payer", payer).Msg("Failed to compute top-up value, payment was not credited")
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to compute top-up value",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// Top-ups are settled before they are credited, also in async mode
+	reference := c.GetString("payment_transaction")
+
+	credited := seller.CreditsFromUSD(usd)
+	account, apiKey, err := h.creditLedger.Topup(payer, credited, resource.Resource, reference)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("payer", payer).
+			Str("reference", reference).
+			Msg("Failed to record credits top-up, payment was not credited")
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to record credits top-up",
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	log.Info().
+		Str("payer", payer).
+		Str("credited", seller.FormatCredits(credited)).
+		Str("balance", seller.FormatCredits(account.Balance)).
+		Msg("Credits topped up")
+
+	response := gin.H{
+		"address":  account.Address,
+		"credited": seller.FormatCredits(credited),
+		"balance":  seller.FormatCredits(account.Balance),
+		"currency": "USD",
+	}
+	if apiKey != "" {
+		// The key is only stored as a hash and returned once
+		response["apiKey"] = apiKey
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // DiscoverResources handles the /resources/discover endpoint
 func (h *ResourceHandler) HandleDiscoverResources(c *gin.Context) {
 	// Parse query parameters
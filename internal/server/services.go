@@ -0,0 +1,223 @@
+package server
+
+import (
+	"fmt"
+
+	"go-agent-guide/internal/auth"
+	"go-agent-guide/internal/buyer"
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/gateway"
+	"go-agent-guide/internal/ipfilter"
+	"go-agent-guide/internal/ratelimit"
+	"go-agent-guide/internal/seller"
+	"github.com/agent-guide/go-x402-facilitator/pkg/facilitator"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Services holds the components shared by the gateway and admin servers
+type Services struct {
+	Facilitator     facilitator.PaymentFacilitator
+	ResourceGateway *gateway.ResourceGateway
+	ForwardProxy    *gateway.ForwardProxy // Nil unless forward_proxy.enabled
+	NonceStore      *seller.NonceStore
+	SettlementQueue *seller.SettlementQueue
+	CreditLedger    *seller.CreditLedger
+	PassIssuer      *seller.PassIssuer
+	ConsumerKeys    *auth.ConsumerKeys
+	AdminAudit      *auth.AuditLog
+	WalletAuth      *auth.WalletAuth
+	IPFilter        *ipfilter.Filter
+	AuthFailures    *auth.FailureTracker
+	RateLimits      ratelimit.Store
+	BuyerWallets    *buyer.Wallets
+	BuyerBudgets    *buyer.BudgetTracker
+	BuyerPayments   *buyer.PaymentLedger
+	BuyerApprovals  *buyer.ApprovalQueue
+	BuyerBalances   *buyer.BalanceTracker
+}
+
+// NewServices creates the shared components from configuration
+func NewServices(cfg *config.Config, f facilitator.PaymentFacilitator) (*Services, error) {
+	walletAuth, err := auth.NewWalletAuth(cfg.WalletAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet authenticator: %w", err)
+	}
+
+	ipFilter, err := ipfilter.NewFilter(cfg.IPFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IP filter: %w", err)
+	}
+
+	authFailures := auth.NewFailureTracker(cfg.BruteForce)
+
+	buyerWallets, err := buyer.NewWallets(cfg.Buyer, cfg.Facilitator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load buyer wallets: %w", err)
+	}
+
+	buyerBudgets, err := buyer.NewBudgetTracker(cfg.Storage.Path("buyer_spend.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buyer budget tracker: %w", err)
+	}
+
+	buyerPayments, err := buyer.NewPaymentLedger(cfg.Storage.Path("buyer_payments.jsonl"))
+	if err != nil {
+		buyerBudgets.Close()
+		return nil, fmt.Errorf("failed to create buyer payment ledger: %w", err)
+	}
+
+	buyerApprovals := buyer.NewApprovalQueue(cfg.Buyer.Approval)
+	buyerBalances := buyer.NewBalanceTracker(cfg.Buyer.Balance, cfg.Facilitator, buyerWallets)
+
+	resourceGateway, err := gateway.NewResourceGateway(f, cfg, gateway.BuyerOptions{
+		Wallets:   buyerWallets,
+		Budgets:   buyerBudgets,
+		Payments:  buyerPayments,
+		Approvals: buyerApprovals,
+		Balances:  buyerBalances,
+	})
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		return nil, fmt.Errorf("failed to create resource gateway: %w", err)
+	}
+
+	var forwardProxy *gateway.ForwardProxy
+	if cfg.ForwardProxy.Enabled {
+		forwardProxy, err = gateway.NewForwardProxy(resourceGateway, cfg.ForwardProxy)
+		if err != nil {
+			buyerBudgets.Close()
+			buyerPayments.Close()
+			return nil, fmt.Errorf("failed to create forward proxy: %w", err)
+		}
+	}
+
+	nonceStore, err := seller.NewNonceStore(cfg.Storage.Path("nonces.jsonl"))
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		return nil, fmt.Errorf("failed to create nonce store: %w", err)
+	}
+
+	passIssuer, err := seller.NewPassIssuer(cfg.Passes.SigningKey, cfg.Storage.Path("passes.jsonl"))
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		nonceStore.Close()
+		return nil, fmt.Errorf("failed to create access pass issuer: %w", err)
+	}
+
+	// The queue always runs, so items queued in async mode are settled after a switch to sync mode
+	settlementQueue, err := seller.NewSettlementQueue(cfg.Storage.Path("settlements.jsonl"), cfg.Seller.Settlement, f, passIssuer)
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		nonceStore.Close()
+		passIssuer.Close()
+		return nil, fmt.Errorf("failed to create settlement queue: %w", err)
+	}
+
+	creditLedger, err := seller.NewCreditLedger(cfg.Storage.Path("credits.jsonl"))
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		nonceStore.Close()
+		passIssuer.Close()
+		settlementQueue.Stop()
+		return nil, fmt.Errorf("failed to create credit ledger: %w", err)
+	}
+
+	consumerKeys, err := auth.NewConsumerKeys(cfg.Storage.Path("consumer_keys.db"), cfg.Storage.Path("consumer_keys.jsonl"))
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		nonceStore.Close()
+		settlementQueue.Stop()
+		creditLedger.Close()
+		passIssuer.Close()
+		return nil, fmt.Errorf("failed to create consumer key store: %w", err)
+	}
+
+	adminAudit, err := auth.NewAuditLog(cfg.Storage.Path("admin_audit.jsonl"))
+	if err != nil {
+		buyerBudgets.Close()
+		buyerPayments.Close()
+		nonceStore.Close()
+		settlementQueue.Stop()
+		creditLedger.Close()
+		passIssuer.Close()
+		consumerKeys.Close()
+		return nil, fmt.Errorf("failed to create admin audit log: %w", err)
+	}
+
+	var rateLimits ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.QuotaStore == "journal" {
+		rateLimits, err = ratelimit.NewJournalStore(cfg.Storage.Path("quotas.jsonl"))
+		if err != nil {
+			buyerBudgets.Close()
+			buyerPayments.Close()
+			nonceStore.Close()
+			settlementQueue.Stop()
+			creditLedger.Close()
+			passIssuer.Close()
+			consumerKeys.Close()
+			adminAudit.Close()
+			return nil, fmt.Errorf("failed to create quota store: %w", err)
+		}
+	}
+
+	settlementQueue.Start()
+	buyerBalances.Start(resourceGateway.Rates())
+
+	return &Services{
+		Facilitator:     f,
+		ResourceGateway: resourceGateway,
+		ForwardProxy:    forwardProxy,
+		NonceStore:      nonceStore,
+		SettlementQueue: settlementQueue,
+		CreditLedger:    creditLedger,
+		PassIssuer:      passIssuer,
+		ConsumerKeys:    consumerKeys,
+		AdminAudit:      adminAudit,
+		WalletAuth:      walletAuth,
+		IPFilter:        ipFilter,
+		AuthFailures:    authFailures,
+		RateLimits:      rateLimits,
+		BuyerWallets:    buyerWallets,
+		BuyerBudgets:    buyerBudgets,
+		BuyerPayments:   buyerPayments,
+		BuyerApprovals:  buyerApprovals,
+		BuyerBalances:   buyerBalances,
+	}, nil
+}
+
+// Close releases resources held by the shared components
+func (s *Services) Close() {
+	s.BuyerBalances.Stop()
+	s.SettlementQueue.Stop()
+	if err := s.NonceStore.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close nonce store")
+	}
+	if err := s.CreditLedger.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close credit ledger")
+	}
+	if err := s.PassIssuer.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close access pass issuer")
+	}
+	if err := s.ConsumerKeys.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close consumer key store")
+	}
+	if err := s.AdminAudit.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close admin audit log")
+	}
+	if err := s.RateLimits.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close quota store")
+	}
+	if err := s.BuyerBudgets.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close buyer budget tracker")
+	}
+	if err := s.BuyerPayments.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close buyer payment ledger")
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+
+	"go-agent-guide/internal/config"
+	"go-agent-guide/internal/tlsreload"
+)
+
+// listenAndServe serves plain HTTP, or HTTPS with a reloading certificate when tls.enabled is set
+// name is the config section of the server, used in logs and metrics.
+func listenAndServe(httpServer *http.Server, name string, tlsConfig config.TLSConfig) error {
+	if !tlsConfig.Enabled {
+		return httpServer.ListenAndServe()
+	}
+
+	reloader, err := tlsreload.NewReloader(name, tlsConfig)
+	if err != nil {
+		return err
+	}
+	httpServer.TLSConfig = reloader.TLSConfig()
+	return httpServer.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Journal is an append-only file of JSON records, one record per line
+// Each append is synced to disk before returning so that records survive a crash
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenJournal opens (or creates) the journal at path
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+
+	return &Journal{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Path returns the journal file path
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append writes a record to the end of the journal
+func (j *Journal) Append(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write journal record: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// Replay calls fn for every record in the journal, in order
+// An invalid last line (e.g. from a crash during append) is ignored and cut off the file, so later
+// appends start on a new line. An invalid line anywhere else means the journal is corrupt and is an error.
+func (j *Journal) Replay(fn func(data json.RawMessage) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.Open(j.path)
+	if err != nil {
+		return fmt.Errorf("failed to open journal %s: %w", j.path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var offset int64 // End of the last complete line
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read journal %s: %w", j.path, err)
+		}
+		if len(line) == 0 {
+			return nil
+		}
+		complete := err == nil
+
+		record := bytes.TrimSpace(line)
+		if len(record) > 0 && !json.Valid(record) {
+			if _, peekErr := reader.Peek(1); complete && peekErr != io.EOF {
+				return fmt.Errorf("corrupt journal %s: invalid record on line %d", j.path, lineNumber)
+			}
+			if err := os.Truncate(j.path, offset); err != nil {
+				return fmt.Errorf("failed to truncate journal %s: %w", j.path, err)
+			}
+			return nil
+		}
+
+		if len(record) > 0 {
+			if err := fn(json.RawMessage(record)); err != nil {
+				return err
+			}
+		}
+		if !complete {
+			// A whole record without its newline; terminate it so the next append starts a new line
+			if _, err := j.file.Write([]byte{'\n'}); err != nil {
+				return fmt.Errorf("failed to repair journal %s: %w", j.path, err)
+			}
+			return nil
+		}
+		offset += int64(len(line))
+	}
+}
+
+// Rewrite atomically replaces the journal content with the given records
+// It is used to compact the journal once older records are no longer needed
+func (j *Journal) Rewrite(records []interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create journal snapshot: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to write journal snapshot: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write journal snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync journal snapshot: %w", err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	// Reopen the file handle on the new journal
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to reopen journal %s: %w", j.path, err)
+	}
+	j.file.Close()
+	j.file = file
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
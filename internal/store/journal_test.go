@@ -0,0 +1,77 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// replayAll opens the journal at path and returns its records
+func replayAll(t *testing.T, path string) (*Journal, []string, error) {
+	t.Helper()
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	t.Cleanup(func() { journal.Close() })
+
+	var records []string
+	err = journal.Replay(func(data json.RawMessage) error {
+		records = append(records, string(data))
+		return nil
+	})
+	return journal, records, err
+}
+
+func TestJournalReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"records", "{\"n\":1}\n\n{\"n\":2}\n", []string{`{"n":1}`, `{"n":2}`}, false},
+		{"truncated last line", "{\"n\":1}\n{\"n\":", []string{`{"n":1}`}, false},
+		{"invalid last line", "{\"n\":1}\n{\"n\"\n", []string{`{"n":1}`}, false},
+		{"invalid line before the end", "{\"n\":1}\n{\"n\"\n{\"n\":3}\n", nil, true},
+		{"last record without newline", "{\"n\":1}\n{\"n\":2}", []string{`{"n":1}`, `{"n":2}`}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			journal, records, err := replayAll(t, path)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "line 2") {
+					t.Fatalf("Replay error = %v, want a corrupt record on line 2", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Replay: %v", err)
+			}
+			if !reflect.DeepEqual(records, tt.want) {
+				t.Fatalf("records = %v, want %v", records, tt.want)
+			}
+
+			// Records appended after a repaired tail replay cleanly
+			if err := journal.Append(map[string]int{"n": 9}); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			journal.Close()
+			_, records, err = replayAll(t, path)
+			if err != nil {
+				t.Fatalf("Replay after append: %v", err)
+			}
+			if want := append(tt.want, `{"n":9}`); !reflect.DeepEqual(records, want) {
+				t.Fatalf("records after append = %v, want %v", records, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-agent-guide/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultReloadInterval is how often the certificate files are checked for changes when no interval is configured
+const DefaultReloadInterval = 10 * time.Second
+
+var (
+	tlsReloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tls_reloads_total",
+			Help: "Total number of TLS certificate loads by result",
+		},
+		[]string{"server", "result"},
+	)
+
+	tlsCertificateExpiry = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_certificate_expiry_timestamp_seconds",
+			Help: "Expiry of the TLS certificate in use, as a Unix timestamp",
+		},
+		[]string{"server"},
+	)
+)
+
+// Reloader serves the TLS configuration of a listener and reloads its certificate, key and
+// client CA bundle when the files change on disk
+type Reloader struct {
+	server string
+	cfg    config.TLSConfig
+	base   *tls.Config // Version, cipher and client auth settings; certificates are added on load
+	files  []string
+
+	current atomic.Pointer[tls.Config]
+
+	mu        sync.Mutex // Guards the file state below
+	checkedAt time.Time
+	modTimes  []time.Time
+	lastError string
+}
+
+// NewReloader creates a reloader from the tls config of a server and loads its files
+// server names the listener in logs and metrics.
+func NewReloader(server string, cfg config.TLSConfig) (*Reloader, error) {
+	minVersion, err := config.ParseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s tls: %w", server, err)
+	}
+	cipherSuites, err := config.ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s tls: %w", server, err)
+	}
+
+	r := &Reloader{
+		server: server,
+		cfg:    cfg,
+		base: &tls.Config{
+			MinVersion:   minVersion,
+			CipherSuites: cipherSuites,
+			NextProtos:   []string{"h2", "http/1.1"},
+		},
+		files: []string{cfg.CertFile, cfg.KeyFile},
+	}
+	if cfg.ClientCAFile != "" {
+		r.base.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.ClientAuth == "optional" {
+			r.base.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		r.files = append(r.files, cfg.ClientCAFile)
+	}
+	if r.cfg.ReloadInterval <= 0 {
+		r.cfg.ReloadInterval = DefaultReloadInterval
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the configuration for an http.Server
+// Every handshake uses the certificate and client CA bundle loaded last.
+func (r *Reloader) TLSConfig() *tls.Config {
+	cfg := r.base.Clone()
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &r.load().Certificates[0], nil
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return r.load(), nil
+	}
+	return cfg
+}
+
+// Reload reads the certificate, key and client CA bundle and replaces the configuration in effect
+// If a file cannot be read or parsed, the previous configuration stays in effect.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return r.failLocked(err)
+	}
+	cfg, leaf, err := r.loadFiles()
+	if err != nil {
+		return r.failLocked(err)
+	}
+
+	r.current.Store(cfg)
+	r.modTimes, r.lastError = modTimes, ""
+	tlsReloadsTotal.WithLabelValues(r.server, "success").Inc()
+	tlsCertificateExpiry.WithLabelValues(r.server).Set(float64(leaf.NotAfter.Unix()))
+
+	event := log.Info()
+	if time.Now().After(leaf.NotAfter) {
+		event = log.Warn()
+	}
+	event.
+		Str("server", r.server).
+		Str("cert_file", r.cfg.CertFile).
+		Str("subject", leaf.Subject.String()).
+		Time("not_after", leaf.NotAfter).
+		Bool("client_auth", r.cfg.ClientCAFile != "").
+		Msg("Loaded TLS certificate")
+	return nil
+}
+
+// load returns the configuration in effect, reloading the files if any of them changed
+func (r *Reloader) load() *tls.Config {
+	if r.mu.TryLock() {
+		if time.Since(r.checkedAt) >= r.cfg.ReloadInterval {
+			r.checkedAt = time.Now()
+			if modTimes, err := r.stat(); err != nil {
+				r.failLocked(err)
+			} else if !equalTimes(modTimes, r.modTimes) {
+				r.mu.Unlock()
+				r.Reload()
+				return r.current.Load()
+			}
+		}
+		r.mu.Unlock()
+	}
+	return r.current.Load()
+}
+
+// stat returns the modification times of the files
+func (r *Reloader) stat() ([]time.Time, error) {
+	modTimes := make([]time.Time, len(r.files))
+	for i, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s tls file: %w", r.server, err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// loadFiles parses the files into a complete configuration and returns it with the leaf certificate
+func (r *Reloader) loadFiles() (*tls.Config, *x509.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load %s tls certificate: %w", r.server, err)
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s tls certificate: %w", r.server, err)
+		}
+	}
+
+	cfg := r.base.Clone()
+	cfg.Certificates = []tls.Certificate{cert}
+	if r.cfg.ClientCAFile != "" {
+		bundle, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s tls client_ca_file: %w", r.server, err)
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(bundle) {
+			return nil, nil, fmt.Errorf("invalid %s tls client_ca_file: no PEM certificates found", r.server)
+		}
+	}
+	return cfg, leaf, nil
+}
+
+// failLocked records a failed reload; callers must hold r.mu
+func (r *Reloader) failLocked(err error) error {
+	tlsReloadsTotal.WithLabelValues(r.server, "error").Inc()
+	// At startup there is no previous certificate; the error is returned to the server instead
+	if r.current.Load() != nil && r.lastError != err.Error() {
+		log.Error().Err(err).Str("server", r.server).Msg("Failed to reload TLS certificate, keeping previous certificate")
+	}
+	r.lastError = err.Error()
+	return err
+}
+
+// equalTimes reports whether two lists of modification times are the same
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,339 @@
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-agent-guide/internal/config"
+)
+
+// testCA is a certificate authority that issues server and client certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf for 127.0.0.1 named name
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key := newKey(t)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// clientCertificate returns a client certificate issued by ca
+func (ca *testCA) clientCertificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, name, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load client certificate: %v", err)
+	}
+	return cert
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+// writeFile writes a file and moves its modification time forward, so a rewrite within the
+// file system's timestamp resolution is still seen as a change
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Duration(len(data)) * time.Millisecond)
+	if info, err := os.Stat(path); err == nil && !info.ModTime().Before(modTime) {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFiles holds the TLS files of a test server
+type testFiles struct {
+	ca   *testCA
+	cert string
+	key  string
+}
+
+// newTestFiles writes a server certificate named name, issued by a new CA, to a temporary directory
+func newTestFiles(t *testing.T, name string) *testFiles {
+	t.Helper()
+	dir := t.TempDir()
+	files := &testFiles{ca: newTestCA(t, "Test CA"), cert: filepath.Join(dir, "cert.pem"), key: filepath.Join(dir, "key.pem")}
+	files.rotate(t, name)
+	return files
+}
+
+// rotate replaces the server certificate with a new one named name
+func (f *testFiles) rotate(t *testing.T, name string) {
+	t.Helper()
+	certPEM, keyPEM := f.ca.issue(t, name, x509.ExtKeyUsageServerAuth)
+	writeFile(t, f.key, keyPEM)
+	writeFile(t, f.cert, certPEM)
+}
+
+// serve starts an HTTPS server with the configuration of r and returns its address
+func serve(t *testing.T, r *Reloader) string {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", r.TLSConfig())
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		ErrorLog: log.New(io.Discard, "", 0), // Refused handshakes are expected
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+// get requests url over a new connection and returns the name of the server certificate
+func get(url string, ca *testCA, client *tls.Config) (string, error) {
+	cfg := &tls.Config{}
+	if client != nil {
+		cfg = client.Clone()
+	}
+	cfg.RootCAs = x509.NewCertPool()
+	cfg.RootCAs.AddCert(ca.cert)
+
+	httpClient := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true},
+	}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestReloaderMinVersion(t *testing.T) {
+	files := newTestFiles(t, "server")
+
+	tests := []struct {
+		minVersion    string
+		clientVersion uint16
+		wantErr       bool
+	}{
+		{"1.2", tls.VersionTLS12, false},
+		{"1.2", tls.VersionTLS13, false},
+		{"1.3", tls.VersionTLS12, true},
+		{"1.3", tls.VersionTLS13, false},
+	}
+	for _, tt := range tests {
+		r, err := NewReloader("gateway", config.TLSConfig{CertFile: files.cert, KeyFile: files.key, MinVersion: tt.minVersion})
+		if err != nil {
+			t.Fatalf("NewReloader: %v", err)
+		}
+		url := serve(t, r)
+
+		_, err = get(url, files.ca, &tls.Config{MinVersion: tt.clientVersion, MaxVersion: tt.clientVersion})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("min_version %s, client %x: error = %v, want error %v", tt.minVersion, tt.clientVersion, err, tt.wantErr)
+		}
+	}
+
+	if _, err := NewReloader("gateway", config.TLSConfig{CertFile: files.cert, KeyFile: files.key, MinVersion: "1.1"}); err == nil {
+		t.Error("NewReloader accepted min_version 1.1")
+	}
+}
+
+func TestReloaderClientCertificates(t *testing.T) {
+	files := newTestFiles(t, "server")
+	clientCA := newTestCA(t, "Client CA")
+	caFile := filepath.Join(t.TempDir(), "clients.pem")
+	writeFile(t, caFile, clientCA.pem)
+
+	trusted := clientCA.clientCertificate(t, "agent")
+	untrusted := newTestCA(t, "Other CA").clientCertificate(t, "intruder")
+
+	tests := []struct {
+		clientAuth string
+		cert       *tls.Certificate
+		wantErr    bool
+	}{
+		{"require", nil, true},
+		{"require", &trusted, false},
+		{"require", &untrusted, true},
+		{"optional", nil, false},
+		{"optional", &trusted, false},
+		{"optional", &untrusted, true},
+	}
+	for _, tt := range tests {
+		r, err := NewReloader("gateway", config.TLSConfig{
+			CertFile:     files.cert,
+			KeyFile:      files.key,
+			MinVersion:   "1.2",
+			ClientCAFile: caFile,
+			ClientAuth:   tt.clientAuth,
+		})
+		if err != nil {
+			t.Fatalf("NewReloader: %v", err)
+		}
+		url := serve(t, r)
+
+		client := &tls.Config{}
+		name := "no certificate"
+		if cert := tt.cert; cert != nil {
+			// Send the certificate even if the server does not list its CA as acceptable
+			client.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return cert, nil
+			}
+			name = cert.Leaf.Subject.CommonName
+		}
+		if _, err := get(url, files.ca, client); (err != nil) != tt.wantErr {
+			t.Errorf("client_auth %s with %s: error = %v, want error %v", tt.clientAuth, name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReloaderSwitchesCertificate(t *testing.T) {
+	files := newTestFiles(t, "first")
+	r, err := NewReloader("gateway", config.TLSConfig{
+		CertFile:       files.cert,
+		KeyFile:        files.key,
+		MinVersion:     "1.2",
+		ReloadInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	url := serve(t, r)
+
+	if name, err := get(url, files.ca, nil); err != nil || name != "first" {
+		t.Fatalf("certificate = %q, %v, want first", name, err)
+	}
+
+	files.rotate(t, "second")
+	time.Sleep(5 * time.Millisecond)
+	if name, err := get(url, files.ca, nil); err != nil || name != "second" {
+		t.Fatalf("certificate after rewrite = %q, %v, want second", name, err)
+	}
+}
+
+func TestReloaderKeepsCertificateOnBrokenFile(t *testing.T) {
+	files := newTestFiles(t, "first")
+	r, err := NewReloader("gateway", config.TLSConfig{
+		CertFile:       files.cert,
+		KeyFile:        files.key,
+		MinVersion:     "1.2",
+		ReloadInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	url := serve(t, r)
+
+	// A certificate file caught halfway through a write
+	writeFile(t, files.cert, []byte("-----BEGIN CERTIFICATE-----\nMIIB"))
+	time.Sleep(5 * time.Millisecond)
+	if name, err := get(url, files.ca, nil); err != nil || name != "first" {
+		t.Fatalf("certificate with a broken file = %q, %v, want first", name, err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload succeeded with a broken certificate file")
+	}
+
+	// A certificate that does not match the key
+	certPEM, _ := files.ca.issue(t, "mismatched", x509.ExtKeyUsageServerAuth)
+	writeFile(t, files.cert, certPEM)
+	time.Sleep(5 * time.Millisecond)
+	if name, err := get(url, files.ca, nil); err != nil || name != "first" {
+		t.Fatalf("certificate with a mismatched key = %q, %v, want first", name, err)
+	}
+
+	// Once the files are fixed the new certificate is served
+	files.rotate(t, "second")
+	time.Sleep(5 * time.Millisecond)
+	if name, err := get(url, files.ca, nil); err != nil || name != "second" {
+		t.Fatalf("certificate after the fix = %q, %v, want second", name, err)
+	}
+}
+
+func TestNewReloaderRequiresValidFiles(t *testing.T) {
+	files := newTestFiles(t, "server")
+	broken := filepath.Join(t.TempDir(), "broken.pem")
+	writeFile(t, broken, []byte("not a certificate"))
+
+	for name, cfg := range map[string]config.TLSConfig{
+		"missing certificate": {CertFile: filepath.Join(t.TempDir(), "missing.pem"), KeyFile: files.key, MinVersion: "1.2"},
+		"broken certificate":  {CertFile: broken, KeyFile: files.key, MinVersion: "1.2"},
+		"broken client CA":    {CertFile: files.cert, KeyFile: files.key, MinVersion: "1.2", ClientCAFile: broken},
+	} {
+		if _, err := NewReloader("gateway", cfg); err == nil {
+			t.Errorf("%s: NewReloader succeeded, want an error", name)
+		}
+	}
+}